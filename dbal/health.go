@@ -0,0 +1,17 @@
+package dbal
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/healthx"
+)
+
+// ReadyChecker returns a healthx.ReadyChecker which pings the driver. Driver.Ping does not accept a context, so a
+// ping which exceeds the timeout is abandoned rather than canceled.
+func ReadyChecker(d Driver, opts ...healthx.CheckerOption) healthx.ReadyChecker {
+	return healthx.NewReadyChecker(func(context.Context) error {
+		return errors.Wrap(d.Ping(), "unable to ping the database driver")
+	}, opts...)
+}
@@ -0,0 +1,23 @@
+package dbal
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ory/x/healthx"
+)
+
+type fakeDriver struct{ err error }
+
+func (d *fakeDriver) CanHandle(string) bool { return true }
+
+func (d *fakeDriver) Ping() error { return d.err }
+
+func TestReadyChecker(t *testing.T) {
+	r := httptest.NewRequest("GET", healthx.ReadyCheckPath, nil)
+	assert.NoError(t, ReadyChecker(&fakeDriver{})(r))
+	assert.Error(t, ReadyChecker(&fakeDriver{err: errors.New("connection refused")})(r))
+}
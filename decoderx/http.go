@@ -36,6 +36,9 @@ type (
 		jsonSchemaRef             string
 		jsonSchemaCompiler        *jsonschema.Compiler
 		jsonSchemaValidate        bool
+		jsonSchemaFromStruct      bool
+		jsonSchema                *jsonschema.Schema
+		jsonSchemaPaths           func(depth uint8) ([]jsonschemax.Path, error)
 		maxCircularReferenceDepth uint8
 		handleParseErrors         parseErrorStrategy
 		expectJSONFlattened       bool
@@ -202,6 +205,13 @@ func newHTTPDecoderOptions(fs []HTTPDecoderOption) *httpDecoderOptions {
 	return o
 }
 
+func (o *httpDecoderOptions) listPaths() ([]jsonschemax.Path, error) {
+	if o.jsonSchemaPaths != nil {
+		return o.jsonSchemaPaths(o.maxCircularReferenceDepth)
+	}
+	return jsonschemax.ListPathsWithRecursion(o.jsonSchemaRef, o.jsonSchemaCompiler, o.maxCircularReferenceDepth)
+}
+
 // NewHTTP creates a new HTTP decoder.
 func NewHTTP() *HTTP {
 	return new(HTTP)
@@ -234,9 +244,13 @@ func (t *HTTP) validatePayload(raw json.RawMessage, c *httpDecoderOptions) error
 		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("JSON Schema Validation is required but no compiler was provided."))
 	}
 
-	schema, err := c.jsonSchemaCompiler.Compile(c.jsonSchemaRef)
-	if err != nil {
-		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to load JSON Schema from location: %s", c.jsonSchemaRef).WithDebug(err.Error()))
+	schema := c.jsonSchema
+	if schema == nil {
+		var err error
+		schema, err = c.jsonSchemaCompiler.Compile(c.jsonSchemaRef)
+		if err != nil {
+			return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to load JSON Schema from location: %s", c.jsonSchemaRef).WithDebug(err.Error()))
+		}
 	}
 
 	if err := schema.Validate(bytes.NewBuffer(raw)); err != nil {
@@ -252,6 +266,12 @@ func (t *HTTP) validatePayload(raw json.RawMessage, c *httpDecoderOptions) error
 // Decode takes a HTTP Request Body and decodes it into destination.
 func (t *HTTP) Decode(r *http.Request, destination interface{}, opts ...HTTPDecoderOption) error {
 	c := newHTTPDecoderOptions(opts)
+	if c.jsonSchemaFromStruct {
+		if err := c.useStructSchema(destination); err != nil {
+			return err
+		}
+	}
+
 	if err := t.validateRequest(r, c); err != nil {
 		return err
 	}
@@ -289,7 +309,7 @@ func (t *HTTP) decodeJSONForm(r *http.Request, destination interface{}, o *httpD
 		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to decode HTTP Form Body because no validation schema was provided. This is a code bug."))
 	}
 
-	paths, err := jsonschemax.ListPathsWithRecursion(o.jsonSchemaRef, o.jsonSchemaCompiler, o.maxCircularReferenceDepth)
+	paths, err := o.listPaths()
 	if err != nil {
 		return errors.WithStack(herodot.ErrInternalServerError.WithTrace(err).WithReasonf("Unable to prepare JSON Schema for HTTP Post Body Form parsing: %s", err).WithDebugf("%+v", err))
 	}
@@ -349,7 +369,7 @@ func (t *HTTP) decodeForm(r *http.Request, destination interface{}, o *httpDecod
 		return errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode HTTP %s form body: %s", strings.ToUpper(r.Method), err).WithDebug(err.Error()))
 	}
 
-	paths, err := jsonschemax.ListPathsWithRecursion(o.jsonSchemaRef, o.jsonSchemaCompiler, o.maxCircularReferenceDepth)
+	paths, err := o.listPaths()
 	if err != nil {
 		return errors.WithStack(herodot.ErrInternalServerError.WithTrace(err).WithReasonf("Unable to prepare JSON Schema for HTTP Post Body Form parsing: %s", err).WithDebugf("%+v", err))
 	}
@@ -0,0 +1,649 @@
+package decoderx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/jsonschema/v3"
+
+	"github.com/ory/x/jsonschemax"
+)
+
+type structSchema struct {
+	id       string
+	raw      json.RawMessage
+	compiler *jsonschema.Compiler
+	schema   *jsonschema.Schema
+	paths    sync.Map // map[uint8][]jsonschemax.Path
+}
+
+var (
+	structSchemas sync.Map // map[reflect.Type]*structSchema
+
+	timeType          = reflect.TypeOf(time.Time{})
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// HTTPStructSchemaCompiler configures the HTTP decoder to derive the JSON Schema used for validation
+// and type assertion from the destination's Go type. The destination must be a pointer to a struct.
+//
+// The schema is generated from the following struct tags and is cached per type:
+//
+// - `json:"name,omitempty"` sets the property name. Fields tagged with `json:"-"` are ignored and
+// the `string` option turns the property into a string.
+// - `validate:"required,min=1,max=10"` understands a subset of the validator rules: required, min, max,
+// len, gt, gte, lt, lte, oneof, email, url, uri, uuid, hostname, ipv4, and ipv6. Like in validator, a
+// required string must not be empty, a required bool must be true, and a required number must not be zero.
+// - `jsonschema:"title=Name,description=A name,format=email"` sets JSON Schema keywords directly. Commas
+// in values must be escaped with a backslash. The enum keyword may be repeated. Its required keyword
+// only requires the property to be present.
+//
+// Like HTTPJSONSchemaCompiler, this option enables payload validation, which can be disabled by passing
+// HTTPDecoderSetValidatePayloads(false) after it. It can not be combined with HTTPJSONSchemaCompiler or
+// HTTPRawJSONSchemaCompiler.
+func HTTPStructSchemaCompiler() HTTPDecoderOption {
+	return func(o *httpDecoderOptions) {
+		o.jsonSchemaFromStruct = true
+		o.jsonSchemaValidate = true
+	}
+}
+
+// JSONSchemaFromStruct returns the JSON Schema generated for the type of v. v must be a struct or a pointer
+// to a struct.
+func JSONSchemaFromStruct(v interface{}) (json.RawMessage, error) {
+	s, err := structSchemaFor(reflect.TypeOf(v))
+	if err != nil {
+		return nil, err
+	}
+	return s.raw, nil
+}
+
+func (o *httpDecoderOptions) useStructSchema(destination interface{}) error {
+	if o.jsonSchemaCompiler != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("HTTPStructSchemaCompiler can not be combined with another JSON Schema compiler."))
+	}
+
+	s, err := structSchemaFor(reflect.TypeOf(destination))
+	if err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to generate JSON Schema from the destination type: %s", err).WithDebugf("%+v", err))
+	}
+
+	o.jsonSchemaCompiler = s.compiler
+	o.jsonSchemaRef = s.id
+	o.jsonSchema = s.schema
+	o.jsonSchemaPaths = s.listPaths
+	return nil
+}
+
+// listPaths lists the paths of the schema once per depth.
+func (s *structSchema) listPaths(depth uint8) ([]jsonschemax.Path, error) {
+	if paths, ok := s.paths.Load(depth); ok {
+		return paths.([]jsonschemax.Path), nil
+	}
+
+	paths, err := jsonschemax.ListPathsWithRecursion(s.id, s.compiler, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	s.paths.Store(depth, paths)
+	return paths, nil
+}
+
+func structSchemaFor(t reflect.Type) (*structSchema, error) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, errors.Errorf("expected a struct or a pointer to a struct but got: %v", t)
+	}
+
+	if s, ok := structSchemas.Load(t); ok {
+		return s.(*structSchema), nil
+	}
+
+	g := &schemaGenerator{
+		root:        t,
+		visiting:    map[reflect.Type]bool{},
+		recursive:   map[reflect.Type]bool{},
+		definitions: map[string]interface{}{},
+	}
+
+	schema, err := g.schemaForType(t)
+	if err != nil {
+		return nil, err
+	}
+
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	if len(g.definitions) > 0 {
+		schema["definitions"] = g.definitions
+	}
+
+	raw, err := json.Marshal(schema)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	id := fmt.Sprintf("%x.json", sha256.Sum256(raw))
+	compiler := jsonschema.NewCompiler()
+	compiler.ExtractAnnotations = true
+	if err := compiler.AddResource(id, bytes.NewReader(raw)); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	compiled, err := compiler.Compile(id)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	s, _ := structSchemas.LoadOrStore(t, &structSchema{
+		id:       id,
+		raw:      raw,
+		compiler: compiler,
+		schema:   compiled,
+	})
+	return s.(*structSchema), nil
+}
+
+type schemaGenerator struct {
+	root        reflect.Type
+	visiting    map[reflect.Type]bool
+	recursive   map[reflect.Type]bool
+	definitions map[string]interface{}
+}
+
+// definitionName returns the name of the definition of a named type. The package path is included because
+// t.String() is ambiguous for types of different packages with the same name.
+func definitionName(t reflect.Type) string {
+	return t.PkgPath() + "." + t.Name()
+}
+
+func definitionRef(t reflect.Type) string {
+	return "#/definitions/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(definitionName(t))
+}
+
+func (g *schemaGenerator) schemaForType(t reflect.Type) (map[string]interface{}, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}, nil
+	case t == rawMessageType:
+		return map[string]interface{}{}, nil
+	case t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType):
+		// We can not know what a custom marshaller emits.
+		return map[string]interface{}{}, nil
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return map[string]interface{}{"type": "string"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return map[string]interface{}{"type": "integer", "minimum": 0}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}, nil
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}, nil
+	case reflect.Interface:
+		return map[string]interface{}{}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			// encoding/json encodes byte slices as base64 strings.
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}, nil
+		}
+
+		items, err := g.schemaForType(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+
+		schema := map[string]interface{}{"type": "array", "items": items}
+		if t.Kind() == reflect.Array {
+			schema["minItems"] = t.Len()
+			schema["maxItems"] = t.Len()
+		}
+		return schema, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, errors.Errorf("unable to generate JSON Schema for map with non-string key type: %s", t)
+		}
+
+		values, err := g.schemaForType(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": values}, nil
+	case reflect.Struct:
+		return g.schemaForStruct(t)
+	}
+
+	return nil, errors.Errorf("unable to generate JSON Schema for type: %s", t)
+}
+
+func (g *schemaGenerator) schemaForStruct(t reflect.Type) (map[string]interface{}, error) {
+	if g.visiting[t] {
+		g.recursive[t] = true
+		if t == g.root {
+			return map[string]interface{}{"$ref": "#"}, nil
+		}
+		return map[string]interface{}{"$ref": definitionRef(t)}, nil
+	}
+
+	g.visiting[t] = true
+	defer delete(g.visiting, t)
+
+	properties := map[string]interface{}{}
+	var required []string
+	if err := g.addFields(t, properties, &required); err != nil {
+		return nil, err
+	}
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+
+	if g.recursive[t] && t != g.root {
+		g.definitions[definitionName(t)] = schema
+		return map[string]interface{}{"$ref": definitionRef(t)}, nil
+	}
+
+	return schema, nil
+}
+
+func (g *schemaGenerator) addFields(t reflect.Type, properties map[string]interface{}, required *[]string) error {
+	for _, f := range structFields(t) {
+		var schema map[string]interface{}
+		if hasTagOption(f.opts, "string") {
+			schema = map[string]interface{}{"type": "string"}
+		} else {
+			var err error
+			schema, err = g.schemaForType(f.field.Type)
+			if err != nil {
+				return errors.Wrapf(err, "field %s.%s", f.owner, f.field.Name)
+			}
+		}
+
+		isRequired, err := applyValidateTag(schema, f.field.Type, f.field.Tag.Get("validate"))
+		if err != nil {
+			return errors.Wrapf(err, "field %s.%s", f.owner, f.field.Name)
+		}
+
+		isAlsoRequired, err := applySchemaTag(schema, f.field.Type, f.field.Tag.Get("jsonschema"))
+		if err != nil {
+			return errors.Wrapf(err, "field %s.%s", f.owner, f.field.Name)
+		}
+
+		if isRequired || isAlsoRequired {
+			*required = append(*required, f.name)
+		}
+
+		properties[f.name] = schema
+	}
+
+	return nil
+}
+
+type structField struct {
+	name   string
+	opts   string
+	field  reflect.StructField
+	owner  reflect.Type
+	depth  int
+	tagged bool
+}
+
+// structFields returns the fields encoding/json decodes into t, including the fields of embedded structs.
+// If several fields have the same name, the same rules as in encoding/json apply: the least nested field
+// wins, a tagged field wins over untagged ones of the same depth, and the name is dropped if that is ambiguous.
+func structFields(t reflect.Type) []structField {
+	var fields []structField
+	visited := map[reflect.Type]bool{}
+	next := []reflect.Type{t}
+	for depth := 0; len(next) > 0; depth++ {
+		current := next
+		next = nil
+
+		for _, ct := range current {
+			if visited[ct] {
+				// Already seen at a shallower depth, which dominates.
+				continue
+			}
+
+			for i := 0; i < ct.NumField(); i++ {
+				field := ct.Field(i)
+
+				name, opts := parseJSONTag(field.Tag.Get("json"))
+				if name == "-" && opts == "" {
+					continue
+				}
+
+				if field.Anonymous {
+					ft := field.Type
+					if ft.Kind() == reflect.Ptr {
+						ft = ft.Elem()
+					}
+					if field.PkgPath != "" && (ft.Kind() != reflect.Struct || field.Type.Kind() == reflect.Ptr) {
+						// encoding/json ignores embedded fields of unexported non-struct types and can not
+						// allocate embedded pointers to unexported struct types.
+						continue
+					}
+					if name == "" && ft.Kind() == reflect.Struct {
+						// Embedded structs are flattened like encoding/json does it.
+						next = append(next, ft)
+						continue
+					}
+				} else if field.PkgPath != "" {
+					// unexported
+					continue
+				}
+
+				f := structField{name: name, opts: opts, field: field, owner: ct, depth: depth, tagged: name != ""}
+				if f.name == "" {
+					f.name = field.Name
+				}
+				fields = append(fields, f)
+			}
+		}
+
+		for _, ct := range current {
+			visited[ct] = true
+		}
+	}
+
+	byName := map[string][]structField{}
+	var names []string
+	for _, f := range fields {
+		if _, ok := byName[f.name]; !ok {
+			names = append(names, f.name)
+		}
+		byName[f.name] = append(byName[f.name], f)
+	}
+
+	dominant := make([]structField, 0, len(names))
+	for _, name := range names {
+		if f, ok := dominantField(byName[name]); ok {
+			dominant = append(dominant, f)
+		}
+	}
+	return dominant
+}
+
+// dominantField returns the field which wins among fields with the same name, see structFields.
+func dominantField(fields []structField) (structField, bool) {
+	depth := fields[0].depth
+	for _, f := range fields[1:] {
+		if f.depth < depth {
+			depth = f.depth
+		}
+	}
+
+	var candidates, tagged []structField
+	for _, f := range fields {
+		if f.depth != depth {
+			continue
+		}
+		candidates = append(candidates, f)
+		if f.tagged {
+			tagged = append(tagged, f)
+		}
+	}
+
+	switch {
+	case len(candidates) == 1:
+		return candidates[0], true
+	case len(tagged) == 1:
+		return tagged[0], true
+	}
+	return structField{}, false
+}
+
+func parseJSONTag(tag string) (string, string) {
+	if idx := strings.Index(tag, ","); idx != -1 {
+		return tag[:idx], tag[idx+1:]
+	}
+	return tag, ""
+}
+
+func hasTagOption(opts, option string) bool {
+	for _, o := range strings.Split(opts, ",") {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// constrain returns the schema which keywords should be added to. Keywords next to a $ref are
+// ignored by JSON Schema draft-07, which is why the reference is wrapped in an allOf.
+func constrain(schema map[string]interface{}) map[string]interface{} {
+	if ref, ok := schema["$ref"]; ok {
+		delete(schema, "$ref")
+		schema["allOf"] = []interface{}{map[string]interface{}{"$ref": ref}}
+	}
+	return schema
+}
+
+func elemKind(t reflect.Type) reflect.Kind {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind()
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// lengthKeywords returns the keywords used for min and max constraints of the given kind.
+func lengthKeywords(k reflect.Kind) (string, string, bool) {
+	switch {
+	case k == reflect.String:
+		return "minLength", "maxLength", true
+	case k == reflect.Slice || k == reflect.Array:
+		return "minItems", "maxItems", true
+	case k == reflect.Map || k == reflect.Struct:
+		return "minProperties", "maxProperties", true
+	case isNumberKind(k):
+		return "minimum", "maximum", true
+	}
+	return "", "", false
+}
+
+func applyValidateTag(schema map[string]interface{}, t reflect.Type, tag string) (required bool, err error) {
+	if tag == "" || tag == "-" {
+		return false, nil
+	}
+
+	kind := elemKind(t)
+	for _, rule := range strings.Split(tag, ",") {
+		key, value := rule, ""
+		if idx := strings.Index(rule, "="); idx != -1 {
+			key, value = rule[:idx], rule[idx+1:]
+		}
+
+		switch key {
+		case "dive":
+			// All following rules apply to the elements and not to the field itself.
+			return required, nil
+		case "required":
+			required = true
+			requireNonZero(schema, t)
+		case "email":
+			constrain(schema)["format"] = "email"
+		case "url", "uri":
+			constrain(schema)["format"] = "uri"
+		case "uuid", "uuid4":
+			constrain(schema)["format"] = "uuid"
+		case "hostname":
+			constrain(schema)["format"] = "hostname"
+		case "ipv4", "ipv6":
+			constrain(schema)["format"] = key
+		case "oneof":
+			var enum []interface{}
+			for _, v := range strings.Fields(value) {
+				e, err := parseTagValue(kind, v)
+				if err != nil {
+					return false, errors.Wrapf(err, "validate rule %s", rule)
+				}
+				enum = append(enum, e)
+			}
+			constrain(schema)["enum"] = enum
+		case "min", "max", "len", "gt", "gte", "lt", "lte":
+			minKey, maxKey, ok := lengthKeywords(kind)
+			if !ok {
+				continue
+			}
+
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return false, errors.Wrapf(err, "validate rule %s", rule)
+			}
+
+			s := constrain(schema)
+			number := isNumberKind(kind)
+			switch key {
+			case "min", "gte":
+				s[minKey] = n
+			case "max", "lte":
+				s[maxKey] = n
+			case "len":
+				s[minKey], s[maxKey] = n, n
+			case "gt":
+				if number {
+					s["exclusiveMinimum"] = n
+				} else {
+					s[minKey] = n + 1
+				}
+			case "lt":
+				if number {
+					s["exclusiveMaximum"] = n
+				} else {
+					s[maxKey] = n - 1
+				}
+			}
+		}
+	}
+
+	return required, nil
+}
+
+// requireNonZero adds the keywords which reject the zero value of t, because the required rule of validator
+// rejects zero values while the required keyword of JSON Schema only requires the property to be present.
+// Pointers, slices, and maps must only be non-nil, which JSON Schema already ensures by the type keyword.
+func requireNonZero(schema map[string]interface{}, t reflect.Type) {
+	switch k := t.Kind(); {
+	case k == reflect.String:
+		if s := constrain(schema); s["minLength"] == nil {
+			s["minLength"] = 1
+		}
+	case k == reflect.Bool:
+		constrain(schema)["enum"] = []interface{}{true}
+	case isNumberKind(k):
+		constrain(schema)["not"] = map[string]interface{}{"const": 0}
+	}
+}
+
+func splitSchemaTag(tag string) []string {
+	var parts []string
+	var current strings.Builder
+	for i := 0; i < len(tag); i++ {
+		switch {
+		case tag[i] == '\\' && i+1 < len(tag) && tag[i+1] == ',':
+			current.WriteByte(',')
+			i++
+		case tag[i] == ',':
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(tag[i])
+		}
+	}
+	return append(parts, current.String())
+}
+
+func applySchemaTag(schema map[string]interface{}, t reflect.Type, tag string) (required bool, err error) {
+	if tag == "" {
+		return false, nil
+	}
+
+	kind := elemKind(t)
+	for _, rule := range splitSchemaTag(tag) {
+		key, value := rule, ""
+		if idx := strings.Index(rule, "="); idx != -1 {
+			key, value = rule[:idx], rule[idx+1:]
+		}
+
+		switch key {
+		case "":
+			continue
+		case "required":
+			required = true
+		case "readOnly", "writeOnly":
+			constrain(schema)[key] = true
+		case "title", "description", "format", "pattern":
+			constrain(schema)[key] = value
+		case "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum", "multipleOf",
+			"minLength", "maxLength", "minItems", "maxItems", "minProperties", "maxProperties":
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return false, errors.Wrapf(err, "jsonschema keyword %s", key)
+			}
+			constrain(schema)[key] = n
+		case "default":
+			v, err := parseTagValue(kind, value)
+			if err != nil {
+				return false, errors.Wrapf(err, "jsonschema keyword %s", key)
+			}
+			constrain(schema)["default"] = v
+		case "enum":
+			v, err := parseTagValue(kind, value)
+			if err != nil {
+				return false, errors.Wrapf(err, "jsonschema keyword %s", key)
+			}
+			s := constrain(schema)
+			enum, _ := s["enum"].([]interface{})
+			s["enum"] = append(enum, v)
+		default:
+			return false, errors.Errorf("unknown jsonschema keyword: %s", key)
+		}
+	}
+
+	return required, nil
+}
+
+func parseTagValue(kind reflect.Kind, value string) (interface{}, error) {
+	switch {
+	case kind == reflect.Bool:
+		return strconv.ParseBool(value)
+	case isNumberKind(kind):
+		return strconv.ParseFloat(value, 64)
+	}
+	return value, nil
+}
@@ -0,0 +1,302 @@
+package decoderx
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/jsonschema/v3"
+)
+
+type (
+	structName struct {
+		First string `json:"first" validate:"required"`
+		Last  string `json:"last,omitempty" jsonschema:"title=Last name,description=The last name\\, if any"`
+	}
+
+	structBase struct {
+		ID string `json:"id" validate:"uuid"`
+	}
+
+	structPerson struct {
+		structBase
+		Name       structName        `json:"name"`
+		Age        int               `json:"age" validate:"min=0,max=150"`
+		Ratio      float64           `json:"ratio,omitempty"`
+		Consent    bool              `json:"consent" validate:"required"`
+		Newsletter bool              `json:"newsletter"`
+		Email      string            `json:"email,omitempty" validate:"email"`
+		Role       string            `json:"role,omitempty" validate:"oneof=admin user" jsonschema:"default=user"`
+		Tags       []string          `json:"tags,omitempty" validate:"max=3"`
+		Labels     map[string]string `json:"labels,omitempty"`
+		CreatedAt  *time.Time        `json:"created_at,omitempty"`
+		Ignored    string            `json:"-"`
+		internal   string
+	}
+
+	structNode struct {
+		Value    string        `json:"value"`
+		Children []*structNode `json:"children,omitempty"`
+	}
+
+	structTree struct {
+		Root structLeaf `json:"root"`
+	}
+
+	structLeaf struct {
+		Next *structLeaf `json:"next,omitempty" jsonschema:"description=The next leaf"`
+	}
+
+	structEmbeddedName struct {
+		Name  string `json:"name"`
+		Email string `json:"Email" validate:"email"`
+		Phone string
+	}
+
+	structEmbeddedContact struct {
+		Email string
+		Phone string
+	}
+
+	structEmbeddedConflict struct {
+		Phone int
+	}
+
+	structEmbedding struct {
+		structEmbeddedName
+		*structEmbeddedContact
+		structEmbeddedConflict
+		Name int `json:"name"`
+	}
+
+	structInvalidTag struct {
+		Foo string `jsonschema:"unknown=bar"`
+	}
+)
+
+func TestJSONSchemaFromStruct(t *testing.T) {
+	t.Run("case=generates schema from tags", func(t *testing.T) {
+		raw, err := JSONSchemaFromStruct(new(structPerson))
+		require.NoError(t, err)
+		assert.JSONEq(t, `{
+	"$schema": "http://json-schema.org/draft-07/schema#",
+	"type": "object",
+	"required": ["consent"],
+	"properties": {
+		"id": {"type": "string", "format": "uuid"},
+		"name": {
+			"type": "object",
+			"required": ["first"],
+			"properties": {
+				"first": {"type": "string", "minLength": 1},
+				"last": {"type": "string", "title": "Last name", "description": "The last name, if any"}
+			}
+		},
+		"age": {"type": "integer", "minimum": 0, "maximum": 150},
+		"ratio": {"type": "number"},
+		"consent": {"type": "boolean", "enum": [true]},
+		"newsletter": {"type": "boolean"},
+		"email": {"type": "string", "format": "email"},
+		"role": {"type": "string", "enum": ["admin", "user"], "default": "user"},
+		"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 3},
+		"labels": {"type": "object", "additionalProperties": {"type": "string"}},
+		"created_at": {"type": "string", "format": "date-time"}
+	}
+}`, string(raw))
+	})
+
+	t.Run("case=handles self references", func(t *testing.T) {
+		raw, err := JSONSchemaFromStruct(structNode{})
+		require.NoError(t, err)
+		assert.JSONEq(t, `{
+	"$schema": "http://json-schema.org/draft-07/schema#",
+	"type": "object",
+	"properties": {
+		"value": {"type": "string"},
+		"children": {"type": "array", "items": {"$ref": "#"}}
+	}
+}`, string(raw))
+	})
+
+	t.Run("case=handles nested references", func(t *testing.T) {
+		raw, err := JSONSchemaFromStruct(structTree{})
+		require.NoError(t, err)
+		assert.JSONEq(t, `{
+	"$schema": "http://json-schema.org/draft-07/schema#",
+	"type": "object",
+	"properties": {
+		"root": {"$ref": "#/definitions/github.com~1ory~1x~1decoderx.structLeaf"}
+	},
+	"definitions": {
+		"github.com/ory/x/decoderx.structLeaf": {
+			"type": "object",
+			"properties": {
+				"next": {"allOf": [{"$ref": "#/definitions/github.com~1ory~1x~1decoderx.structLeaf"}], "description": "The next leaf"}
+			}
+		}
+	}
+}`, string(raw))
+	})
+
+	t.Run("case=resolves embedded fields like encoding/json", func(t *testing.T) {
+		// "name" is shadowed by the outer field, "Email" is tagged in only one of the embedded structs, and "Phone"
+		// is ambiguous and therefore ignored.
+		raw, err := JSONSchemaFromStruct(structEmbedding{})
+		require.NoError(t, err)
+		assert.JSONEq(t, `{
+	"$schema": "http://json-schema.org/draft-07/schema#",
+	"type": "object",
+	"properties": {
+		"name": {"type": "integer"},
+		"Email": {"type": "string", "format": "email"}
+	}
+}`, string(raw))
+	})
+
+	t.Run("case=validates nested references", func(t *testing.T) {
+		s, err := structSchemaFor(reflect.TypeOf(structTree{}))
+		require.NoError(t, err)
+
+		c := jsonschema.NewCompiler()
+		require.NoError(t, c.AddResource(s.id, bytes.NewReader(s.raw)))
+		schema, err := c.Compile(s.id)
+		require.NoError(t, err)
+
+		require.NoError(t, schema.Validate(bytes.NewBufferString(`{"root":{"next":{"next":{}}}}`)))
+		require.Error(t, schema.Validate(bytes.NewBufferString(`{"root":{"next":{"next":"foo"}}}`)))
+	})
+
+	t.Run("case=caches schema per type", func(t *testing.T) {
+		a, err := structSchemaFor(reflect.TypeOf(new(structPerson)))
+		require.NoError(t, err)
+		b, err := structSchemaFor(reflect.TypeOf(structPerson{}))
+		require.NoError(t, err)
+		assert.True(t, a == b)
+	})
+
+	t.Run("case=fails on unknown keywords", func(t *testing.T) {
+		_, err := JSONSchemaFromStruct(new(structInvalidTag))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unknown jsonschema keyword: unknown")
+	})
+
+	t.Run("case=fails on non-struct types", func(t *testing.T) {
+		_, err := JSONSchemaFromStruct(new(string))
+		require.Error(t, err)
+	})
+}
+
+func TestHTTPStructSchemaCompiler(t *testing.T) {
+	for k, tc := range []struct {
+		d             string
+		body          string
+		contentType   string
+		options       []HTTPDecoderOption
+		expected      structPerson
+		expectedError string
+	}{
+		{
+			d: "should type assert form data",
+			body: url.Values{
+				"name.first": {"Aeneas"},
+				"age":        {"29"},
+				"ratio":      {"0.9"},
+				"consent":    {"true"},
+				"newsletter": {"false", "true"},
+				"tags":       {"a", "b"},
+			}.Encode(),
+			contentType: httpContentTypeURLEncodedForm,
+			expected: structPerson{
+				Name:       structName{First: "Aeneas"},
+				Age:        29,
+				Ratio:      0.9,
+				Consent:    true,
+				Newsletter: true,
+				Tags:       []string{"a", "b"},
+			},
+		},
+		{
+			d:             "should validate form data",
+			body:          url.Values{"name.first": {"Aeneas"}, "consent": {"true"}, "age": {"200"}}.Encode(),
+			contentType:   httpContentTypeURLEncodedForm,
+			expectedError: "must be <= 150",
+		},
+		{
+			d:           "should decode json",
+			body:        `{"name":{"first":"Aeneas"},"consent":true,"role":"admin"}`,
+			contentType: httpContentTypeJSON,
+			expected:    structPerson{Name: structName{First: "Aeneas"}, Consent: true, Role: "admin"},
+		},
+		{
+			d:             "should validate json",
+			body:          `{"name":{"first":"Aeneas"},"consent":true,"role":"root"}`,
+			contentType:   httpContentTypeJSON,
+			expectedError: "value must be one of",
+		},
+		{
+			d:             "should require fields",
+			body:          `{"name":{},"consent":true}`,
+			contentType:   httpContentTypeJSON,
+			expectedError: `missing properties: "first"`,
+		},
+		{
+			d:             "should reject empty required strings",
+			body:          `{"name":{"first":""},"consent":true}`,
+			contentType:   httpContentTypeJSON,
+			expectedError: "length must be >= 1",
+		},
+		{
+			d:             "should reject false required bools",
+			body:          `{"name":{"first":"Aeneas"},"consent":false}`,
+			contentType:   httpContentTypeJSON,
+			expectedError: "value must be true",
+		},
+		{
+			d:             "should reject other schema compilers",
+			body:          `{"name":{"first":"Aeneas"},"consent":true}`,
+			contentType:   httpContentTypeJSON,
+			options:       []HTTPDecoderOption{HTTPJSONSchemaCompiler("stub/schema.json", nil)},
+			expectedError: "can not be combined",
+		},
+		{
+			d:           "should decode json in form format",
+			body:        `{"name.first":"Aeneas","consent":true}`,
+			contentType: httpContentTypeJSON,
+			options:     []HTTPDecoderOption{HTTPDecoderJSONFollowsFormFormat()},
+			expected:    structPerson{Name: structName{First: "Aeneas"}, Consent: true},
+		},
+	} {
+		t.Run(fmt.Sprintf("case=%d/description=%s", k, tc.d), func(t *testing.T) {
+			var destination structPerson
+			err := NewHTTP().Decode(
+				newRequest(t, "POST", "/", bytes.NewBufferString(tc.body), tc.contentType),
+				&destination,
+				append(tc.options, HTTPStructSchemaCompiler())...,
+			)
+			if tc.expectedError != "" {
+				require.Error(t, err)
+				require.Contains(t, fmt.Sprintf("%+v", err), tc.expectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, destination)
+		})
+	}
+
+	t.Run("case=should fail if destination is not a struct", func(t *testing.T) {
+		var destination map[string]interface{}
+		err := NewHTTP().Decode(
+			newRequest(t, "POST", "/", bytes.NewBufferString(`{}`), httpContentTypeJSON),
+			&destination, HTTPStructSchemaCompiler(),
+		)
+		require.Error(t, err)
+		assert.Contains(t, fmt.Sprintf("%+v", err), "Unable to generate JSON Schema from the destination type")
+	})
+}
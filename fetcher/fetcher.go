@@ -2,6 +2,7 @@ package fetcher
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"io"
 	"net/http"
@@ -30,6 +31,13 @@ func WithClient(hc *http.Client) func(*opts) {
 	}
 }
 
+// WithResilientClient configures the retrying client the fetcher uses, e.g. to limit the number of retries.
+func WithResilientClient(ro ...httpx.ResilientOptions) func(*opts) {
+	return func(o *opts) {
+		o.hc = httpx.NewResilientClient(ro...)
+	}
+}
+
 func newOpts() *opts {
 	return &opts{
 		hc: httpx.NewResilientClient(),
@@ -47,8 +55,13 @@ func NewFetcher(opts ...func(*opts)) *Fetcher {
 
 // Fetch fetches the file contents from the source.
 func (f *Fetcher) Fetch(source string) (*bytes.Buffer, error) {
+	return f.FetchContext(context.Background(), source)
+}
+
+// FetchContext fetches the file contents from the source and uses the context for remote requests.
+func (f *Fetcher) FetchContext(ctx context.Context, source string) (*bytes.Buffer, error) {
 	if strings.HasPrefix(source, "http") || strings.HasPrefix(source, "https") {
-		return f.fetchRemote(source)
+		return f.fetchRemote(ctx, source)
 	} else if strings.HasPrefix(source, "file") {
 		return f.fetchFile(strings.Replace(source, "file://", "", 1))
 	} else if strings.HasPrefix(source, "base64") {
@@ -62,8 +75,13 @@ func (f *Fetcher) Fetch(source string) (*bytes.Buffer, error) {
 	return nil, errors.Errorf("source url uses an unknown scheme: %s", source)
 }
 
-func (f *Fetcher) fetchRemote(source string) (*bytes.Buffer, error) {
-	res, err := f.hc.Get(source)
+func (f *Fetcher) fetchRemote(ctx context.Context, source string) (*bytes.Buffer, error) {
+	req, err := retryablehttp.NewRequest("GET", source, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "rule: %s", source)
+	}
+
+	res, err := f.hc.Do(req.WithContext(ctx))
 	if err != nil {
 		return nil, errors.Wrapf(err, "rule: %s", source)
 	}
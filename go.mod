@@ -33,7 +33,7 @@ require (
 	github.com/jackc/pgx/v4 v4.6.0
 	github.com/jandelgado/gcov2lcov v1.0.4-0.20210120124023-b83752c6dc08
 	github.com/jmoiron/sqlx v1.2.0
-	github.com/julienschmidt/httprouter v1.2.0
+	github.com/julienschmidt/httprouter v1.3.0
 	github.com/knadh/koanf v0.14.1-0.20201201075439-e0853799f9ec
 	github.com/lib/pq v1.3.0
 	github.com/markbates/pkger v0.17.1
@@ -51,6 +51,7 @@ require (
 	github.com/philhofer/fwd v1.0.0 // indirect
 	github.com/pkg/errors v0.9.1
 	github.com/pkg/profile v1.2.1
+	github.com/prometheus/client_golang v1.10.0
 	github.com/rs/cors v1.6.0
 	github.com/rubenv/sql-migrate v0.0.0-20190212093014-1007f53448d7
 	github.com/seatgeek/logrus-gelf-formatter v0.0.0-20210219220335-367fa274be2c
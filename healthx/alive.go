@@ -0,0 +1,239 @@
+package healthx
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultAliveCheckInterval is the interval in which AliveCheckers run in the background.
+	DefaultAliveCheckInterval = 10 * time.Second
+	// DefaultAliveCheckTimeout is the time an AliveChecker may take before it is considered failed.
+	DefaultAliveCheckTimeout = 5 * time.Second
+)
+
+// AliveChecker should return an error if the instance is in a state it can not recover from and should be
+// restarted, for example because of a deadlock. AliveCheckers run in the background, see Handler.RunAliveChecks.
+type AliveChecker func(ctx context.Context) error
+
+// AliveCheckers is a map of AliveCheckers.
+type AliveCheckers map[string]AliveChecker
+
+// WithAliveChecks adds AliveCheckers. They only run once Handler.RunAliveChecks was started.
+func WithAliveChecks(checks AliveCheckers) HandlerOption {
+	return func(h *Handler) {
+		if h.aliveChecks == nil {
+			h.aliveChecks = make(AliveCheckers, len(checks))
+		}
+		for n, c := range checks {
+			h.aliveChecks[n] = c
+		}
+	}
+}
+
+// WithAliveCheckInterval sets the interval in which AliveCheckers run. Defaults to DefaultAliveCheckInterval.
+func WithAliveCheckInterval(interval time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.aliveCheckInterval = interval
+	}
+}
+
+// WithAliveCheckTimeout sets the time each AliveChecker may take. Defaults to DefaultAliveCheckTimeout.
+func WithAliveCheckTimeout(timeout time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.aliveCheckTimeout = timeout
+	}
+}
+
+// WithStartupTasks registers tasks, e.g. migrations or cache warm-up, which must complete before the startup
+// endpoint reports ok. Complete them using Handler.CompleteStartupTask.
+func WithStartupTasks(names ...string) HandlerOption {
+	return func(h *Handler) {
+		h.startup.Lock()
+		defer h.startup.Unlock()
+		if h.startup.pending == nil {
+			h.startup.pending = make(map[string]bool, len(names))
+		}
+		for _, n := range names {
+			h.startup.pending[n] = true
+		}
+	}
+}
+
+type aliveState struct {
+	sync.RWMutex
+	errs map[string]error
+}
+
+type startupState struct {
+	sync.RWMutex
+	pending map[string]bool
+}
+
+// RunAliveChecks runs the AliveCheckers immediately and then in the configured interval until the context is
+// canceled. The alive endpoint fails while at least one AliveChecker fails. It blocks, so run it in a goroutine.
+func (h *Handler) RunAliveChecks(ctx context.Context) {
+	interval := h.aliveCheckInterval
+	if interval <= 0 {
+		interval = DefaultAliveCheckInterval
+	}
+
+	h.evaluateAliveChecks(ctx)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			h.evaluateAliveChecks(ctx)
+		}
+	}
+}
+
+func (h *Handler) evaluateAliveChecks(ctx context.Context) {
+	timeout := h.aliveCheckTimeout
+	if timeout <= 0 {
+		timeout = DefaultAliveCheckTimeout
+	}
+
+	var wg sync.WaitGroup
+	var l sync.Mutex
+	errs := make(map[string]error)
+	for n, c := range h.aliveChecks {
+		wg.Add(1)
+		go func(n string, c AliveChecker) {
+			defer wg.Done()
+			if res := runCheck(ctx, timeout, c); res.err != nil {
+				l.Lock()
+				defer l.Unlock()
+				errs[n] = res.err
+			}
+		}(n, c)
+	}
+	wg.Wait()
+
+	// Results of checks which were interrupted by the shutdown are not meaningful.
+	if ctx.Err() != nil {
+		return
+	}
+
+	h.alive.Lock()
+	defer h.alive.Unlock()
+	h.alive.errs = errs
+}
+
+// AliveHandler returns an ok status unless an AliveChecker failed when it last ran. Errors are only included if
+// shareErrors is true.
+func (h *Handler) AliveHandler(shareErrors bool) httprouter.Handle {
+	return func(rw http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		h.alive.RLock()
+		defer h.alive.RUnlock()
+
+		if len(h.alive.errs) > 0 {
+			notAlive := swaggerNotReadyStatus{Errors: make(map[string]string, len(h.alive.errs))}
+			for n, err := range h.alive.errs {
+				notAlive.Errors[n] = obfuscatedError
+				if shareErrors {
+					notAlive.Errors[n] = err.Error()
+				}
+			}
+			h.H.WriteCode(rw, r, http.StatusServiceUnavailable, &notAlive)
+			return
+		}
+
+		h.H.Write(rw, r, &swaggerHealthStatus{
+			Status: "ok",
+		})
+	}
+}
+
+// CompleteStartupTask marks a task registered with WithStartupTasks as completed.
+func (h *Handler) CompleteStartupTask(name string) {
+	h.startup.Lock()
+	defer h.startup.Unlock()
+	delete(h.startup.pending, name)
+}
+
+// Startup returns an ok status once all startup tasks have completed.
+//
+// swagger:route GET /health/startup health isInstanceStarted
+//
+// Check startup status
+//
+// This endpoint returns a 200 status code once the service has completed all startup tasks, for example
+// running migrations. Use it as a startup probe, liveness and readiness probes are only meaningful afterwards.
+//
+// If the service supports TLS Edge Termination, this endpoint does not require the
+// `X-Forwarded-Proto` header to be set.
+//
+//     Produces:
+//     - application/json
+//
+//     Responses:
+//       200: healthStatus
+//       503: healthNotReadyStatus
+func (h *Handler) Startup(rw http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	h.startup.RLock()
+	defer h.startup.RUnlock()
+
+	if len(h.startup.pending) > 0 {
+		notStarted := swaggerNotReadyStatus{Errors: make(map[string]string, len(h.startup.pending))}
+		for n := range h.startup.pending {
+			notStarted.Errors[n] = "the startup task has not completed yet"
+		}
+		h.H.WriteCode(rw, r, http.StatusServiceUnavailable, &notStarted)
+		return
+	}
+
+	h.H.Write(rw, r, &swaggerHealthStatus{
+		Status: "ok",
+	})
+}
+
+// GoroutineCountAliveChecker fails if more than max goroutines are running, which usually indicates a leak.
+func GoroutineCountAliveChecker(max int) AliveChecker {
+	return func(context.Context) error {
+		if n := runtime.NumGoroutine(); n > max {
+			return errors.Errorf("%d goroutines are running which exceeds the limit of %d", n, max)
+		}
+		return nil
+	}
+}
+
+// Heartbeat detects stuck event loops and deadlocks. The monitored loop calls Beat regularly and Check fails if
+// the last beat is older than the maximum age.
+type Heartbeat struct {
+	maxAge time.Duration
+	l      sync.RWMutex
+	last   time.Time
+}
+
+// NewHeartbeat returns a Heartbeat whose first beat is now.
+func NewHeartbeat(maxAge time.Duration) *Heartbeat {
+	return &Heartbeat{maxAge: maxAge, last: time.Now()}
+}
+
+// Beat records that the monitored loop is making progress.
+func (b *Heartbeat) Beat() {
+	b.l.Lock()
+	defer b.l.Unlock()
+	b.last = time.Now()
+}
+
+// Check is an AliveChecker which fails if the last beat is older than the maximum age.
+func (b *Heartbeat) Check(context.Context) error {
+	b.l.RLock()
+	defer b.l.RUnlock()
+	if since := time.Since(b.last); since > b.maxAge {
+		return errors.Errorf("the last heartbeat was %s ago which exceeds the limit of %s", since.Round(time.Millisecond), b.maxAge)
+	}
+	return nil
+}
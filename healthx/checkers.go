@@ -0,0 +1,146 @@
+package healthx
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultCheckerTimeout is the timeout of the ReadyCheckers returned by the constructors in this package.
+const DefaultCheckerTimeout = 5 * time.Second
+
+type checkerOptions struct {
+	timeout        time.Duration
+	client         *http.Client
+	expectedStatus []int
+	resolver       *net.Resolver
+}
+
+// CheckerOption configures the ReadyCheckers returned by the constructors in this package.
+type CheckerOption func(*checkerOptions)
+
+// CheckerWithTimeout sets the time the check may take. Defaults to DefaultCheckerTimeout.
+func CheckerWithTimeout(timeout time.Duration) CheckerOption {
+	return func(o *checkerOptions) {
+		o.timeout = timeout
+	}
+}
+
+// CheckerWithHTTPClient sets the client used by HTTPReadyChecker. Defaults to http.DefaultClient.
+func CheckerWithHTTPClient(c *http.Client) CheckerOption {
+	return func(o *checkerOptions) {
+		o.client = c
+	}
+}
+
+// CheckerWithExpectedStatus sets the status codes HTTPReadyChecker accepts. Defaults to any 2xx status code.
+func CheckerWithExpectedStatus(codes ...int) CheckerOption {
+	return func(o *checkerOptions) {
+		o.expectedStatus = codes
+	}
+}
+
+// CheckerWithResolver sets the resolver used by DNSReadyChecker. Defaults to net.DefaultResolver.
+func CheckerWithResolver(r *net.Resolver) CheckerOption {
+	return func(o *checkerOptions) {
+		o.resolver = r
+	}
+}
+
+func newCheckerOptions(opts []CheckerOption) *checkerOptions {
+	o := &checkerOptions{
+		timeout:  DefaultCheckerTimeout,
+		client:   http.DefaultClient,
+		resolver: net.DefaultResolver,
+	}
+	for _, f := range opts {
+		f(o)
+	}
+	return o
+}
+
+// NewReadyChecker returns a ReadyChecker which runs check with the configured timeout. Use it to build checkers for
+// dependencies which are not covered by this package.
+func NewReadyChecker(check func(ctx context.Context) error, opts ...CheckerOption) ReadyChecker {
+	o := newCheckerOptions(opts)
+	return func(r *http.Request) error {
+		return runCheck(r.Context(), o.timeout, check).err
+	}
+}
+
+// SQLPinger is implemented by *sql.DB and *sqlx.DB.
+type SQLPinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// SQLReadyChecker returns a ReadyChecker which pings the database.
+func SQLReadyChecker(db SQLPinger, opts ...CheckerOption) ReadyChecker {
+	return NewReadyChecker(func(ctx context.Context) error {
+		return errors.Wrap(db.PingContext(ctx), "unable to ping the database")
+	}, opts...)
+}
+
+// HTTPReadyChecker returns a ReadyChecker which sends a GET request to the URL and expects a 2xx status code, or
+// one of the status codes set with CheckerWithExpectedStatus.
+func HTTPReadyChecker(url string, opts ...CheckerOption) ReadyChecker {
+	o := newCheckerOptions(opts)
+	return NewReadyChecker(func(ctx context.Context) error {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		res, err := o.client.Do(req.WithContext(ctx))
+		if err != nil {
+			return errors.Wrapf(err, "unable to reach %s", url)
+		}
+		defer res.Body.Close()
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+
+		if len(o.expectedStatus) == 0 {
+			if res.StatusCode < 200 || res.StatusCode > 299 {
+				return errors.Errorf("expected %s to respond with a 2xx status code but got %d", url, res.StatusCode)
+			}
+			return nil
+		}
+
+		for _, code := range o.expectedStatus {
+			if res.StatusCode == code {
+				return nil
+			}
+		}
+		return errors.Errorf("expected %s to respond with one of the status codes %v but got %d", url, o.expectedStatus, res.StatusCode)
+	}, opts...)
+}
+
+// TCPReadyChecker returns a ReadyChecker which opens a TCP connection to the address, e.g. "db:5432".
+func TCPReadyChecker(address string, opts ...CheckerOption) ReadyChecker {
+	return NewReadyChecker(func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return errors.Wrapf(err, "unable to connect to %s", address)
+		}
+		return errors.WithStack(conn.Close())
+	}, opts...)
+}
+
+// DNSReadyChecker returns a ReadyChecker which resolves the host name.
+func DNSReadyChecker(host string, opts ...CheckerOption) ReadyChecker {
+	o := newCheckerOptions(opts)
+	return NewReadyChecker(func(ctx context.Context) error {
+		addrs, err := o.resolver.LookupHost(ctx, host)
+		if err != nil {
+			return errors.Wrapf(err, "unable to resolve %s", host)
+		}
+		if len(addrs) == 0 {
+			return errors.Errorf("the host name %s did not resolve to any address", host)
+		}
+		return nil
+	}, opts...)
+}
@@ -0,0 +1,77 @@
+package healthx
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePinger struct{ err error }
+
+func (p *fakePinger) PingContext(ctx context.Context) error { return p.err }
+
+func TestCheckers(t *testing.T) {
+	r := httptest.NewRequest("GET", ReadyCheckPath, nil)
+
+	t.Run("case=sql", func(t *testing.T) {
+		assert.NoError(t, SQLReadyChecker(&fakePinger{})(r))
+
+		err := SQLReadyChecker(&fakePinger{err: errors.New("connection refused")})(r)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unable to ping the database: connection refused")
+	})
+
+	t.Run("case=http", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/slow":
+				select {
+				case <-r.Context().Done():
+				case <-time.After(time.Second):
+				}
+			case "/teapot":
+				w.WriteHeader(http.StatusTeapot)
+			}
+		}))
+		defer ts.Close()
+
+		assert.NoError(t, HTTPReadyChecker(ts.URL)(r))
+
+		err := HTTPReadyChecker(ts.URL + "/teapot")(r)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "2xx status code but got 418")
+		assert.NoError(t, HTTPReadyChecker(ts.URL+"/teapot", CheckerWithExpectedStatus(http.StatusTeapot))(r))
+		assert.Error(t, HTTPReadyChecker(ts.URL, CheckerWithExpectedStatus(http.StatusTeapot))(r))
+
+		err = HTTPReadyChecker(ts.URL+"/slow", CheckerWithTimeout(20*time.Millisecond))(r)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "did not finish within 20ms")
+	})
+
+	t.Run("case=tcp", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := l.Addr().String()
+
+		assert.NoError(t, TCPReadyChecker(addr)(r))
+
+		require.NoError(t, l.Close())
+		err = TCPReadyChecker(addr)(r)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unable to connect to "+addr)
+	})
+
+	t.Run("case=dns", func(t *testing.T) {
+		assert.NoError(t, DNSReadyChecker("localhost")(r))
+
+		err := DNSReadyChecker("does-not-exist.invalid", CheckerWithTimeout(time.Second))(r)
+		require.Error(t, err)
+	})
+}
@@ -25,16 +25,31 @@ package healthx
 type swaggerHealthStatus struct {
 	// Status always contains "ok".
 	Status string `json:"status"`
+
+	// Checks contains the status of each ready check.
+	Checks map[string]swaggerReadyCheckStatus `json:"checks,omitempty"`
 }
 
 // swagger:model healthNotReadyStatus
 type swaggerNotReadyStatus struct {
 	// Errors contains a list of errors that caused the not ready status.
 	Errors map[string]string `json:"errors"`
+
+	// Checks contains the status of each ready check.
+	Checks map[string]swaggerReadyCheckStatus `json:"checks,omitempty"`
 }
 
-// swagger:model version
-type swaggerVersion struct {
-	// Version is the service's version.
-	Version string `json:"version"`
+// swagger:model healthReadyCheckStatus
+type swaggerReadyCheckStatus struct {
+	// Status is one of "ok", "error", and "timeout".
+	Status string `json:"status"`
+
+	// Critical is false if a failure of this check does not cause the not ready status.
+	Critical bool `json:"critical"`
+
+	// LatencyMS is the duration of the check in milliseconds.
+	LatencyMS float64 `json:"latency_ms"`
+
+	// Error is the reason the check failed. It is obfuscated unless errors are shared.
+	Error string `json:"error,omitempty"`
 }
@@ -22,6 +22,7 @@ package healthx
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 
@@ -33,11 +34,14 @@ const (
 	AliveCheckPath = "/health/alive"
 	// ReadyCheckPath is the path where information about the rady state of the instance is provided.
 	ReadyCheckPath = "/health/ready"
+	// StartupCheckPath is the path where information about the startup state of the instance is provided.
+	StartupCheckPath = "/health/startup"
 	// VersionPath is the path where information about the software version of the instance is provided.
 	VersionPath = "/version"
 )
 
-// RoutesToObserve returns a string of all the available routes of this module.
+// RoutesToObserve returns a string of all the available routes of this module. The startup route is opt-in and
+// therefore not included, see StartupRoutesToObserve.
 func RoutesToObserve() []string {
 	return []string{
 		AliveCheckPath,
@@ -46,6 +50,13 @@ func RoutesToObserve() []string {
 	}
 }
 
+// StartupRoutesToObserve returns the routes registered by SetStartupRoutes.
+func StartupRoutesToObserve() []string {
+	return []string{
+		StartupCheckPath,
+	}
+}
+
 // ReadyChecker should return an error if the component is not ready yet.
 type ReadyChecker func(r *http.Request) error
 
@@ -62,39 +73,69 @@ type Handler struct {
 	H             herodot.Writer
 	VersionString string
 	ReadyChecks   ReadyCheckers
+
+	readyCheckTimeout  time.Duration
+	readyCheckCacheTTL time.Duration
+	nonCritical        map[string]bool
+	cache              readyCheckCache
+
+	aliveChecks        AliveCheckers
+	aliveCheckInterval time.Duration
+	aliveCheckTimeout  time.Duration
+	alive              aliveState
+	startup            startupState
+
+	gitHash        string
+	buildTime      string
+	dependencyInfo bool
 }
 
 // NewHandler instantiates a handler.
+//
+// AliveCheckers added with WithAliveChecks do not run until Handler.RunAliveChecks is started, usually in a
+// goroutine bound to the lifetime of the server. Until then the alive endpoint reports ok.
 func NewHandler(
 	h herodot.Writer,
 	version string,
 	readyChecks ReadyCheckers,
+	opts ...HandlerOption,
 ) *Handler {
-	return &Handler{
+	handler := &Handler{
 		H:             h,
 		VersionString: version,
 		ReadyChecks:   readyChecks,
 	}
+	for _, o := range opts {
+		o(handler)
+	}
+	return handler
 }
 
 // SetHealthRoutes registers this handler's routes for health checking.
 func (h *Handler) SetHealthRoutes(r *httprouter.Router, shareErrors bool) {
-	r.GET(AliveCheckPath, h.Alive)
+	r.GET(AliveCheckPath, h.AliveHandler(shareErrors))
 	r.GET(ReadyCheckPath, h.Ready(shareErrors))
 }
 
+// SetStartupRoutes registers the startup check route. It is opt-in because existing deployments may already serve
+// StartupCheckPath themselves.
+func (h *Handler) SetStartupRoutes(r *httprouter.Router) {
+	r.GET(StartupCheckPath, h.Startup)
+}
+
 // SetHealthRoutes registers this handler's routes for health checking.
 func (h *Handler) SetVersionRoutes(r *httprouter.Router) {
 	r.GET(VersionPath, h.Version)
 }
 
-// Alive returns an ok status if the instance is ready to handle HTTP requests.
+// Alive returns an ok status if the instance is ready to handle HTTP requests and no AliveChecker failed. Errors
+// are obfuscated, use AliveHandler to share them.
 //
 // swagger:route GET /health/alive health isInstanceAlive
 //
 // Check alive status
 //
-// This endpoint returns a 200 status code when the HTTP server is up running.
+// This endpoint returns a 200 status code when the HTTP server is up running and no liveness check failed.
 // This status does currently not include checks whether the database connection is working.
 //
 // If the service supports TLS Edge Termination, this endpoint does not require the
@@ -109,20 +150,21 @@ func (h *Handler) SetVersionRoutes(r *httprouter.Router) {
 //     Responses:
 //       200: healthStatus
 //       500: genericError
-func (h *Handler) Alive(rw http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	h.H.Write(rw, r, &swaggerHealthStatus{
-		Status: "ok",
-	})
+//       503: healthNotReadyStatus
+func (h *Handler) Alive(rw http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	h.AliveHandler(false)(rw, r, ps)
 }
 
-// Ready returns an ok status if the instance is ready to handle HTTP requests and all ReadyCheckers are ok.
+// Ready returns an ok status if the instance is ready to handle HTTP requests and all critical ReadyCheckers are ok.
+// The checks run in parallel, each with a timeout, and their status and latency are included in the response.
+// Errors are only included if shareErrors is true.
 //
 // swagger:route GET /health/ready health isInstanceReady
 //
 // Check readiness status
 //
 // This endpoint returns a 200 status code when the HTTP server is up running and the environment dependencies (e.g.
-// the database) are responsive as well.
+// the database) are responsive as well. The response contains the status and latency of each check.
 //
 // If the service supports TLS Edge Termination, this endpoint does not require the
 // `X-Forwarded-Proto` header to be set.
@@ -138,38 +180,33 @@ func (h *Handler) Alive(rw http.ResponseWriter, r *http.Request, _ httprouter.Pa
 //       503: healthNotReadyStatus
 func (h *Handler) Ready(shareErrors bool) httprouter.Handle {
 	return func(rw http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-		var notReady = swaggerNotReadyStatus{
-			Errors: map[string]string{},
-		}
+		checks, errs := h.runReadyChecks(r).statuses(shareErrors)
 
-		for n, c := range h.ReadyChecks {
-			if err := c(r); err != nil {
-				if shareErrors {
-					notReady.Errors[n] = err.Error()
-				} else {
-					notReady.Errors[n] = "error may contain sensitive information and was obfuscated"
-				}
-			}
-		}
-
-		if len(notReady.Errors) > 0 {
-			h.H.WriteCode(rw, r, http.StatusServiceUnavailable, notReady)
+		if len(errs) > 0 {
+			h.H.WriteCode(rw, r, http.StatusServiceUnavailable, &swaggerNotReadyStatus{
+				Errors: errs,
+				Checks: checks,
+			})
 			return
 		}
 
 		h.H.Write(rw, r, &swaggerHealthStatus{
 			Status: "ok",
+			Checks: checks,
 		})
 	}
 }
 
-// Version returns this service's versions.
+// Version returns this service's version and build information. It responds with plain text instead of JSON if
+// requested using `?format=text` or the Accept header.
 //
 // swagger:route GET /version version getVersion
 //
 // Get service version
 //
-// This endpoint returns the service version typically notated using semantic versioning.
+// This endpoint returns the service version typically notated using semantic versioning, the git hash, build time,
+// Go version, operating system, and architecture. The versions of the module dependencies are only included if
+// enabled.
 //
 // If the service supports TLS Edge Termination, this endpoint does not require the
 // `X-Forwarded-Proto` header to be set.
@@ -183,7 +220,15 @@ func (h *Handler) Ready(shareErrors bool) httprouter.Handle {
 //	   Responses:
 // 			200: version
 func (h *Handler) Version(rw http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	h.H.Write(rw, r, &swaggerVersion{
-		Version: h.VersionString,
-	})
+	info := NewBuildInfo(h.VersionString, h.gitHash, h.buildTime)
+	if h.dependencyInfo {
+		info = info.WithDependencies()
+	}
+	if wantsPlainText(r) {
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = rw.Write([]byte(info.String()))
+		return
+	}
+
+	h.H.Write(rw, r, info)
 }
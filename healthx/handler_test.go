@@ -21,12 +21,17 @@
 package healthx
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/stretchr/testify/assert"
@@ -59,7 +64,7 @@ func TestHealth(t *testing.T) {
 	require.NoError(t, json.NewDecoder(response.Body).Decode(&healthBody))
 	assert.EqualValues(t, "ok", healthBody.Status)
 
-	var versionBody swaggerVersion
+	var versionBody BuildInfo
 	response, err = c.Get(ts.URL + VersionPath)
 	require.NoError(t, err)
 	require.EqualValues(t, http.StatusOK, response.StatusCode)
@@ -69,10 +74,11 @@ func TestHealth(t *testing.T) {
 	response, err = c.Get(ts.URL + ReadyCheckPath)
 	require.NoError(t, err)
 	require.EqualValues(t, http.StatusServiceUnavailable, response.StatusCode)
-	out, err := ioutil.ReadAll(response.Body)
-	require.NoError(t, err)
-	assert.EqualValues(t, "ok", healthBody.Status)
-	assert.Equal(t, `{"errors":{"test":"not alive"}}`, string(out))
+	var notReadyBody swaggerNotReadyStatus
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&notReadyBody))
+	assert.Equal(t, map[string]string{"test": "not alive"}, notReadyBody.Errors)
+	assert.Equal(t, CheckStatusError, notReadyBody.Checks["test"].Status)
+	assert.Equal(t, "not alive", notReadyBody.Checks["test"].Error)
 
 	alive = nil
 	response, err = c.Get(ts.URL + ReadyCheckPath)
@@ -81,3 +87,340 @@ func TestHealth(t *testing.T) {
 	require.NoError(t, json.NewDecoder(response.Body).Decode(&versionBody))
 	require.EqualValues(t, versionBody.Version, handler.VersionString)
 }
+
+func TestReadyChecks(t *testing.T) {
+	newServer := func(t *testing.T, shareErrors bool, checks ReadyCheckers, opts ...HandlerOption) *httptest.Server {
+		router := httprouter.New()
+		NewHandler(herodot.NewJSONWriter(nil), "test version", checks, opts...).SetHealthRoutes(router, shareErrors)
+		ts := httptest.NewServer(router)
+		t.Cleanup(ts.Close)
+		return ts
+	}
+
+	getReady := func(t *testing.T, ts *httptest.Server) (int, *swaggerNotReadyStatus) {
+		res, err := http.Get(ts.URL + ReadyCheckPath)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		var body swaggerNotReadyStatus
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		return res.StatusCode, &body
+	}
+
+	t.Run("case=runs checks in parallel with a timeout", func(t *testing.T) {
+		block := make(chan struct{})
+		defer close(block)
+
+		ts := newServer(t, true, ReadyCheckers{
+			"fast": func(*http.Request) error { return nil },
+			"respects context": func(r *http.Request) error {
+				<-r.Context().Done()
+				return r.Context().Err()
+			},
+			"ignores context": func(*http.Request) error {
+				<-block
+				return nil
+			},
+		}, WithReadyCheckTimeout(50*time.Millisecond))
+
+		start := time.Now()
+		code, body := getReady(t, ts)
+		assert.True(t, time.Since(start) < time.Second, "%s", time.Since(start))
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+
+		assert.Equal(t, CheckStatusOK, body.Checks["fast"].Status)
+		assert.Equal(t, CheckStatusTimeout, body.Checks["respects context"].Status)
+		assert.Equal(t, CheckStatusTimeout, body.Checks["ignores context"].Status)
+		assert.True(t, body.Checks["ignores context"].LatencyMS >= 50, "%f", body.Checks["ignores context"].LatencyMS)
+		assert.Len(t, body.Errors, 2)
+	})
+
+	t.Run("case=non-critical checks do not fail readiness", func(t *testing.T) {
+		ts := newServer(t, false, ReadyCheckers{
+			"database": func(*http.Request) error { return nil },
+			"cache":    func(*http.Request) error { return errors.New("secret connection string") },
+		}, WithNonCriticalReadyChecks("cache"))
+
+		code, body := getReady(t, ts)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Empty(t, body.Errors)
+		assert.True(t, body.Checks["database"].Critical)
+		assert.False(t, body.Checks["cache"].Critical)
+		assert.Equal(t, CheckStatusError, body.Checks["cache"].Status)
+		assert.Equal(t, obfuscatedError, body.Checks["cache"].Error)
+	})
+
+	t.Run("case=obfuscates errors", func(t *testing.T) {
+		ts := newServer(t, false, ReadyCheckers{
+			"database": func(*http.Request) error { return errors.New("secret connection string") },
+		})
+
+		code, body := getReady(t, ts)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, map[string]string{"database": obfuscatedError}, body.Errors)
+		assert.Equal(t, obfuscatedError, body.Checks["database"].Error)
+	})
+
+	t.Run("case=reports panics", func(t *testing.T) {
+		ts := newServer(t, true, ReadyCheckers{
+			"database": func(*http.Request) error { panic("nil pointer") },
+		})
+
+		code, body := getReady(t, ts)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Contains(t, body.Errors["database"], "nil pointer")
+	})
+
+	t.Run("case=caches results", func(t *testing.T) {
+		var calls int32
+		ts := newServer(t, true, ReadyCheckers{
+			"database": func(*http.Request) error {
+				atomic.AddInt32(&calls, 1)
+				return nil
+			},
+		}, WithReadyCheckCacheTTL(100*time.Millisecond))
+
+		for i := 0; i < 3; i++ {
+			code, _ := getReady(t, ts)
+			assert.Equal(t, http.StatusOK, code)
+		}
+		assert.EqualValues(t, 1, atomic.LoadInt32(&calls))
+
+		time.Sleep(100 * time.Millisecond)
+		getReady(t, ts)
+		assert.EqualValues(t, 2, atomic.LoadInt32(&calls))
+	})
+
+	t.Run("case=cached results do not depend on the first client", func(t *testing.T) {
+		h := NewHandler(herodot.NewJSONWriter(nil), "test version", ReadyCheckers{
+			"database": func(r *http.Request) error {
+				select {
+				case <-r.Context().Done():
+					return r.Context().Err()
+				case <-time.After(20 * time.Millisecond):
+					return nil
+				}
+			},
+		}, WithReadyCheckCacheTTL(time.Minute))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		rec := httptest.NewRecorder()
+		h.Ready(true)(rec, httptest.NewRequest("GET", ReadyCheckPath, nil).WithContext(ctx), nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		rec = httptest.NewRecorder()
+		h.Ready(true)(rec, httptest.NewRequest("GET", ReadyCheckPath, nil), nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
+
+func TestRunCheck(t *testing.T) {
+	block := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	t.Run("case=reports timeouts", func(t *testing.T) {
+		res := runCheck(context.Background(), 10*time.Millisecond, block)
+		assert.Equal(t, CheckStatusTimeout, res.status)
+	})
+
+	t.Run("case=does not report canceled checks as timed out", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		res := runCheck(ctx, time.Minute, block)
+		assert.Equal(t, CheckStatusError, res.status)
+		assert.NotContains(t, res.err.Error(), "did not finish")
+	})
+}
+
+func TestAliveChecks(t *testing.T) {
+	var failing atomic.Value
+	failing.Store(false)
+
+	h := NewHandler(herodot.NewJSONWriter(nil), "test version", nil,
+		WithAliveChecks(AliveCheckers{
+			"deadlock": func(context.Context) error {
+				if failing.Load().(bool) {
+					return errors.New("deadlock detected")
+				}
+				return nil
+			},
+		}),
+		WithAliveCheckInterval(10*time.Millisecond),
+	)
+	router := httprouter.New()
+	h.SetHealthRoutes(router, true)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.RunAliveChecks(ctx)
+
+	aliveStatus := func() int {
+		res, err := http.Get(ts.URL + AliveCheckPath)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		return res.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, aliveStatus())
+
+	failing.Store(true)
+	assert.Eventually(t, func() bool { return aliveStatus() == http.StatusServiceUnavailable }, time.Second, 10*time.Millisecond)
+
+	res, err := http.Get(ts.URL + AliveCheckPath)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	var body swaggerNotReadyStatus
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+	assert.Equal(t, map[string]string{"deadlock": "deadlock detected"}, body.Errors)
+
+	failing.Store(false)
+	assert.Eventually(t, func() bool { return aliveStatus() == http.StatusOK }, time.Second, 10*time.Millisecond)
+}
+
+func TestBuiltinAliveCheckers(t *testing.T) {
+	t.Run("case=goroutine count", func(t *testing.T) {
+		assert.NoError(t, GoroutineCountAliveChecker(100000)(context.Background()))
+		assert.Error(t, GoroutineCountAliveChecker(1)(context.Background()))
+	})
+
+	t.Run("case=heartbeat", func(t *testing.T) {
+		b := NewHeartbeat(50 * time.Millisecond)
+		assert.NoError(t, b.Check(context.Background()))
+
+		time.Sleep(60 * time.Millisecond)
+		assert.Error(t, b.Check(context.Background()))
+
+		b.Beat()
+		assert.NoError(t, b.Check(context.Background()))
+	})
+}
+
+func TestStartup(t *testing.T) {
+	h := NewHandler(herodot.NewJSONWriter(nil), "test version", nil, WithStartupTasks("migrations", "cache"))
+	router := httprouter.New()
+	h.SetHealthRoutes(router, true)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + StartupCheckPath)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	assert.Equal(t, http.StatusNotFound, res.StatusCode, "the startup route is opt-in")
+	assert.NotContains(t, RoutesToObserve(), StartupCheckPath)
+
+	h.SetStartupRoutes(router)
+
+	startup := func() (int, map[string]string) {
+		res, err := http.Get(ts.URL + StartupCheckPath)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		var body swaggerNotReadyStatus
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		return res.StatusCode, body.Errors
+	}
+
+	code, errs := startup()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Len(t, errs, 2)
+
+	h.CompleteStartupTask("migrations")
+	code, errs = startup()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Len(t, errs, 1)
+	assert.Contains(t, errs, "cache")
+
+	h.CompleteStartupTask("cache")
+	code, _ = startup()
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestVersion(t *testing.T) {
+	h := NewHandler(herodot.NewJSONWriter(nil), "v1.2.3", nil, WithBuildInfo("abcdef", "2021-01-01T00:00:00Z"))
+	router := httprouter.New()
+	h.SetVersionRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	t.Run("case=json", func(t *testing.T) {
+		res, err := http.Get(ts.URL + VersionPath)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		var body BuildInfo
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		assert.Equal(t, "v1.2.3", body.Version)
+		assert.Equal(t, "abcdef", body.GitHash)
+		assert.Equal(t, "2021-01-01T00:00:00Z", body.BuildTime)
+		assert.Equal(t, runtime.Version(), body.GoVersion)
+		assert.Equal(t, runtime.GOOS, body.OS)
+		assert.Equal(t, runtime.GOARCH, body.Arch)
+		assert.Empty(t, body.Module)
+		assert.Empty(t, body.Dependencies)
+	})
+
+	t.Run("case=json with dependencies", func(t *testing.T) {
+		if _, ok := debug.ReadBuildInfo(); !ok {
+			t.Skip("the test binary was built without module support")
+		}
+
+		router := httprouter.New()
+		NewHandler(herodot.NewJSONWriter(nil), "v1.2.3", nil, WithDependencyInfo()).SetVersionRoutes(router)
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+
+		res, err := http.Get(ts.URL + VersionPath)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		var body BuildInfo
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		assert.Equal(t, "v1.2.3", body.Version)
+		assert.Contains(t, body.Dependencies, "github.com/stretchr/testify")
+	})
+
+	for _, tc := range []struct {
+		name   string
+		query  string
+		accept string
+	}{
+		{name: "query", query: "?format=text"},
+		{name: "accept", accept: "text/plain"},
+	} {
+		t.Run("case=text/"+tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", ts.URL+VersionPath+tc.query, nil)
+			require.NoError(t, err)
+			req.Header.Set("Accept", tc.accept)
+
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			body, err := ioutil.ReadAll(res.Body)
+			require.NoError(t, err)
+
+			assert.Contains(t, res.Header.Get("Content-Type"), "text/plain")
+			assert.Contains(t, string(body), "Version:")
+			assert.Contains(t, string(body), "v1.2.3")
+			assert.Contains(t, string(body), "abcdef")
+			assert.Contains(t, string(body), runtime.GOOS+"/"+runtime.GOARCH)
+		})
+	}
+}
+
+func TestBuildInfoString(t *testing.T) {
+	out := (&BuildInfo{
+		Version:      "v1.2.3",
+		GoVersion:    "go1.16",
+		OS:           "linux",
+		Arch:         "amd64",
+		Dependencies: map[string]string{"github.com/b/b": "v0.2.0", "github.com/a/a": "v0.1.0"},
+	}).String()
+
+	assert.NotContains(t, out, "Git Hash")
+	assert.Contains(t, out, "linux/amd64")
+	assert.Contains(t, out, "Dependencies:\n  github.com/a/a v0.1.0\n  github.com/b/b v0.2.0\n")
+}
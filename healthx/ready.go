@@ -0,0 +1,180 @@
+package healthx
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultReadyCheckTimeout is the time a ReadyChecker may take before it is considered failed.
+const DefaultReadyCheckTimeout = 10 * time.Second
+
+const (
+	// CheckStatusOK is the status of a passing check.
+	CheckStatusOK = "ok"
+	// CheckStatusError is the status of a failing check.
+	CheckStatusError = "error"
+	// CheckStatusTimeout is the status of a check that did not finish in time.
+	CheckStatusTimeout = "timeout"
+)
+
+const obfuscatedError = "error may contain sensitive information and was obfuscated"
+
+// HandlerOption configures the Handler.
+type HandlerOption func(*Handler)
+
+// WithReadyCheckTimeout sets the time each ReadyChecker may take. The request passed to the checker is canceled
+// after the timeout. Checkers which ignore the request context are abandoned and reported as timed out.
+// Defaults to DefaultReadyCheckTimeout.
+func WithReadyCheckTimeout(timeout time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.readyCheckTimeout = timeout
+	}
+}
+
+// WithReadyCheckCacheTTL caches the results of the ReadyCheckers for the given duration. This protects the
+// dependencies from being overloaded by frequent probes. Caching is disabled by default.
+func WithReadyCheckCacheTTL(ttl time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.readyCheckCacheTTL = ttl
+	}
+}
+
+// WithNonCriticalReadyChecks marks ReadyCheckers as non-critical. Failing non-critical checks are reported in the
+// response but do not cause the instance to be not ready.
+func WithNonCriticalReadyChecks(names ...string) HandlerOption {
+	return func(h *Handler) {
+		if h.nonCritical == nil {
+			h.nonCritical = make(map[string]bool, len(names))
+		}
+		for _, n := range names {
+			h.nonCritical[n] = true
+		}
+	}
+}
+
+type checkResult struct {
+	status   string
+	critical bool
+	latency  time.Duration
+	err      error
+}
+
+type readyCheckResults struct {
+	checkedAt time.Time
+	results   map[string]*checkResult
+}
+
+type readyCheckCache struct {
+	sync.Mutex
+	last *readyCheckResults
+}
+
+// runReadyChecks runs all ReadyCheckers in parallel or returns the cached results if they are still fresh.
+func (h *Handler) runReadyChecks(r *http.Request) *readyCheckResults {
+	if h.readyCheckCacheTTL <= 0 {
+		return h.evaluateReadyChecks(r.Context(), r)
+	}
+
+	// Holding the lock while evaluating makes concurrent probes wait for and reuse the same results.
+	h.cache.Lock()
+	defer h.cache.Unlock()
+	if h.cache.last == nil || time.Since(h.cache.last.checkedAt) >= h.readyCheckCacheTTL {
+		// The results are shared with other probes, so they must not depend on whether this client disconnects.
+		h.cache.last = h.evaluateReadyChecks(context.Background(), r)
+	}
+	return h.cache.last
+}
+
+func (h *Handler) evaluateReadyChecks(ctx context.Context, r *http.Request) *readyCheckResults {
+	timeout := h.readyCheckTimeout
+	if timeout <= 0 {
+		timeout = DefaultReadyCheckTimeout
+	}
+
+	var wg sync.WaitGroup
+	var l sync.Mutex
+	results := &readyCheckResults{checkedAt: time.Now(), results: make(map[string]*checkResult, len(h.ReadyChecks))}
+	for n, c := range h.ReadyChecks {
+		wg.Add(1)
+		go func(n string, c ReadyChecker) {
+			defer wg.Done()
+			res := runCheck(ctx, timeout, func(ctx context.Context) error {
+				return c(r.WithContext(ctx))
+			})
+			res.critical = !h.nonCritical[n]
+
+			l.Lock()
+			defer l.Unlock()
+			results.results[n] = res
+		}(n, c)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// runCheck runs the check with a timeout. Checks which ignore the context are abandoned after the timeout.
+func runCheck(ctx context.Context, timeout time.Duration, check func(ctx context.Context) error) *checkResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- errors.Errorf("the check panicked: %v", p)
+			}
+		}()
+		done <- check(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		res := &checkResult{status: CheckStatusOK, latency: time.Since(start), err: err}
+		if err != nil {
+			res.status = CheckStatusError
+		}
+		return res
+	case <-ctx.Done():
+		if ctx.Err() != context.DeadlineExceeded {
+			return &checkResult{
+				status:  CheckStatusError,
+				latency: time.Since(start),
+				err:     errors.Wrap(ctx.Err(), "the check was aborted"),
+			}
+		}
+		return &checkResult{
+			status:  CheckStatusTimeout,
+			latency: time.Since(start),
+			err:     errors.Errorf("the check did not finish within %s", timeout),
+		}
+	}
+}
+
+func (rs *readyCheckResults) statuses(shareErrors bool) (map[string]swaggerReadyCheckStatus, map[string]string) {
+	checks := make(map[string]swaggerReadyCheckStatus, len(rs.results))
+	errs := map[string]string{}
+	for n, res := range rs.results {
+		s := swaggerReadyCheckStatus{
+			Status:    res.status,
+			Critical:  res.critical,
+			LatencyMS: float64(res.latency) / float64(time.Millisecond),
+		}
+		if res.err != nil {
+			s.Error = obfuscatedError
+			if shareErrors {
+				s.Error = res.err.Error()
+			}
+			if res.critical {
+				errs[n] = s.Error
+			}
+		}
+		checks[n] = s
+	}
+	return checks, errs
+}
@@ -0,0 +1,147 @@
+package healthx
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// WithBuildInfo sets the git hash and build time returned by the version endpoint. These are usually the same
+// values which are passed to cmdx.Version.
+func WithBuildInfo(gitHash, buildTime string) HandlerOption {
+	return func(h *Handler) {
+		h.gitHash = gitHash
+		h.buildTime = buildTime
+	}
+}
+
+// WithDependencyInfo makes the version endpoint include the module path and the versions of all module
+// dependencies. This is disabled by default because it discloses the exact dependency versions, which helps
+// attackers find vulnerable ones.
+func WithDependencyInfo() HandlerOption {
+	return func(h *Handler) {
+		h.dependencyInfo = true
+	}
+}
+
+// BuildInfo describes the build of the running binary.
+//
+// swagger:model version
+type BuildInfo struct {
+	// Version is the service's version.
+	Version string `json:"version"`
+
+	// GitHash is the git commit the service was built from.
+	GitHash string `json:"git_hash,omitempty"`
+
+	// BuildTime is the time the service was built.
+	BuildTime string `json:"build_time,omitempty"`
+
+	// GoVersion is the Go version the service was built with.
+	GoVersion string `json:"go_version"`
+
+	// OS is the operating system the service is running on.
+	OS string `json:"os"`
+
+	// Arch is the architecture the service is running on.
+	Arch string `json:"arch"`
+
+	// Module is the path of the service's Go module. It is only included if enabled.
+	Module string `json:"module,omitempty"`
+
+	// Dependencies maps the paths of the module dependencies to their versions. It is only included if enabled.
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+}
+
+// NewBuildInfo returns the build information of the running binary. If version is empty, the version of the main
+// module is used if the binary was built with module support. Use WithDependencies to add the dependency versions.
+func NewBuildInfo(version, gitHash, buildTime string) *BuildInfo {
+	info := &BuildInfo{
+		Version:   version,
+		GitHash:   gitHash,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+	}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	if info.Version == "" && bi.Main.Version != "(devel)" {
+		info.Version = bi.Main.Version
+	}
+
+	return info
+}
+
+// WithDependencies adds the module path and the dependency versions, which are read from
+// runtime/debug.ReadBuildInfo and are only available if the binary was built with module support.
+func (b *BuildInfo) WithDependencies() *BuildInfo {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+
+	b.Module = bi.Main.Path
+	b.Dependencies = make(map[string]string, len(bi.Deps))
+	for _, d := range bi.Deps {
+		v := d.Version
+		if d.Replace != nil {
+			v = fmt.Sprintf("%s => %s %s", v, d.Replace.Path, d.Replace.Version)
+		}
+		b.Dependencies[d.Path] = v
+	}
+
+	return b
+}
+
+// String returns the build information as plain text.
+func (b *BuildInfo) String() string {
+	var s strings.Builder
+	w := tabwriter.NewWriter(&s, 0, 8, 1, '\t', 0)
+
+	for _, f := range [][2]string{
+		{"Version", b.Version},
+		{"Git Hash", b.GitHash},
+		{"Build Time", b.BuildTime},
+		{"Go Version", b.GoVersion},
+		{"OS/Arch", b.OS + "/" + b.Arch},
+		{"Module", b.Module},
+	} {
+		if f[1] != "" {
+			_, _ = fmt.Fprintf(w, "%s:\t%s\n", f[0], f[1])
+		}
+	}
+	_ = w.Flush()
+
+	if len(b.Dependencies) > 0 {
+		deps := make([]string, 0, len(b.Dependencies))
+		for p := range b.Dependencies {
+			deps = append(deps, p)
+		}
+		sort.Strings(deps)
+
+		s.WriteString("Dependencies:\n")
+		for _, p := range deps {
+			_, _ = fmt.Fprintf(&s, "  %s %s\n", p, b.Dependencies[p])
+		}
+	}
+
+	return s.String()
+}
+
+// wantsPlainText returns true if the client asked for plain text using `?format=text` or the Accept header.
+func wantsPlainText(r *http.Request) bool {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return f == "text"
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "text/plain") && !strings.Contains(accept, "application/json")
+}
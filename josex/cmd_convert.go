@@ -0,0 +1,165 @@
+package josex
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/square/go-jose.v2"
+
+	"github.com/ory/x/cmdx"
+	"github.com/ory/x/flagx"
+)
+
+// NewKeysCommand returns the `keys` command which groups the key helpers.
+func NewKeysCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "keys",
+		Short: "Helpers for working with cryptographic keys",
+	}
+	cmd.AddCommand(NewConvertCommand())
+	return cmd
+}
+
+// RegisterCommandRecursive adds the keys command and its subcommands to parent.
+func RegisterCommandRecursive(parent *cobra.Command) {
+	parent.AddCommand(NewKeysCommand())
+}
+
+// NewConvertCommand returns the `convert` command.
+func NewConvertCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "convert <path/to/key | ->",
+		Short: "Convert a key between PEM, DER, JWK, JWKS, and OpenSSH formats",
+		Long: `Reads an RSA, ECDSA, or Ed25519 key and writes it in the requested format. The input format is detected
+automatically. Use "-" to read the key from STD_IN.
+
+Supported output formats are: ` + formatList() + `.
+
+If the input is a JSON Web Key Set, use --kid to select a key if the set contains more than one key.
+
+Encrypted PEM private keys are decrypted using the passphrase given by --passphrase or --passphrase-file.`,
+		Example: `keys convert --format pkcs8 id_rsa
+keys convert --format jwks --public key.pem
+keys convert --thumbprint key.pem
+keys convert --passphrase-file passphrase.txt encrypted.pem
+cat jwks.json | keys convert --format openssh --kid my-key -`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var data []byte
+			var err error
+			if args[0] == "-" {
+				data, err = ioutil.ReadAll(cmd.InOrStdin())
+			} else {
+				data, err = ioutil.ReadFile(args[0])
+			}
+			if err != nil {
+				_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "Unable to read the key: %s\n", err)
+				return cmdx.FailSilently(cmd)
+			}
+
+			var passphrase PassphraseSource
+			if p := flagx.MustGetString(cmd, "passphrase"); p != "" {
+				passphrase = StaticPassphrase([]byte(p))
+			} else if p := flagx.MustGetString(cmd, "passphrase-file"); p != "" {
+				passphrase = PassphraseFromFile(p)
+			}
+
+			key, private, err := loadKey(data, flagx.MustGetString(cmd, "kid"), passphrase)
+			if errors.Is(err, ErrPassphraseRequired) {
+				_, _ = fmt.Fprintln(cmd.ErrOrStderr(), "The key is encrypted, use --passphrase or --passphrase-file to decrypt it.")
+				return cmdx.FailSilently(cmd)
+			} else if err != nil {
+				_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "Unable to parse the key: %s\n", err)
+				return cmdx.FailSilently(cmd)
+			}
+
+			if flagx.MustGetBool(cmd, "thumbprint") {
+				tp, err := Thumbprint(key)
+				if err != nil {
+					_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "Unable to compute the thumbprint: %s\n", err)
+					return cmdx.FailSilently(cmd)
+				}
+				_, _ = fmt.Fprintln(cmd.OutOrStdout(), tp)
+				return nil
+			}
+
+			format := Format(strings.ToLower(flagx.MustGetString(cmd, "format")))
+			var out []byte
+			if private && !flagx.MustGetBool(cmd, "public") {
+				out, err = ExportPrivateKey(key, format)
+			} else {
+				out, err = ExportPublicKey(key, format)
+			}
+			if err != nil {
+				_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "Unable to convert the key: %s\n", err)
+				return cmdx.FailSilently(cmd)
+			}
+
+			_, _ = cmd.OutOrStdout().Write(out)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("format", "f", string(FormatPKCS8), "The output format, one of: "+formatList()+".")
+	cmd.Flags().Bool("public", false, "Only write the public key.")
+	cmd.Flags().Bool("thumbprint", false, "Write the RFC 7638 thumbprint of the key instead of converting it.")
+	cmd.Flags().String("kid", "", "The ID of the key to select from a JSON Web Key Set.")
+	cmd.Flags().String("passphrase", "", "The passphrase of an encrypted private key.")
+	cmd.Flags().String("passphrase-file", "", "A file containing the passphrase of an encrypted private key.")
+
+	return cmd
+}
+
+func formatList() string {
+	formats := make([]string, len(Formats()))
+	for i, f := range Formats() {
+		formats[i] = string(f)
+	}
+	return strings.Join(formats, ", ")
+}
+
+// loadKey parses a private or public key in any of the supported formats. It returns true if the key is private.
+// Encrypted private keys are decrypted using the passphrase.
+func loadKey(data []byte, kid string, passphrase PassphraseSource) (interface{}, bool, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var set jose.JSONWebKeySet
+		if err := json.Unmarshal(trimmed, &set); err == nil && set.Keys != nil {
+			keys := set.Keys
+			if kid != "" {
+				keys = set.Key(kid)
+			}
+
+			switch len(keys) {
+			case 0:
+				return nil, false, errors.Errorf("the JSON Web Key Set does not contain a key with ID %q", kid)
+			case 1:
+				return &keys[0], !keys[0].IsPublic(), nil
+			default:
+				return nil, false, errors.New("the JSON Web Key Set contains more than one key, use --kid to select one")
+			}
+		}
+	}
+
+	if IsEncryptedPrivateKey(data) {
+		key, err := LoadEncryptedPrivateKey(data, passphrase)
+		if err != nil {
+			return nil, false, err
+		}
+		return key, true, nil
+	}
+
+	if key, err := LoadPrivateKey(data); err == nil {
+		return key, true, nil
+	}
+
+	key, err := LoadPublicKey(data)
+	if err != nil {
+		return nil, false, err
+	}
+	return key, false, nil
+}
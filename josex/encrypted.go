@@ -0,0 +1,338 @@
+package josex
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"hash"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	// ErrPassphraseRequired is returned when an encrypted private key is loaded without a passphrase.
+	ErrPassphraseRequired = errors.New("josex: the private key is encrypted but no passphrase was provided")
+	// ErrIncorrectPassphrase is returned when an encrypted private key can not be decrypted with the passphrase.
+	ErrIncorrectPassphrase = errors.New("josex: the private key could not be decrypted, the passphrase is probably incorrect")
+)
+
+// PassphraseSource returns the passphrase used to decrypt private keys. It is a callback so that passphrases can
+// be requested interactively or from a secret manager.
+type PassphraseSource func() ([]byte, error)
+
+// PassphraseFromEnv reads the passphrase from the environment variable.
+func PassphraseFromEnv(name string) PassphraseSource {
+	return func() ([]byte, error) {
+		p, ok := os.LookupEnv(name)
+		if !ok || p == "" {
+			return nil, errors.Errorf("josex: the environment variable %s containing the passphrase is not set", name)
+		}
+		return []byte(p), nil
+	}
+}
+
+// PassphraseFromFile reads the passphrase from the file. A trailing line break is removed.
+func PassphraseFromFile(path string) PassphraseSource {
+	return func() ([]byte, error) {
+		p, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "josex: unable to read the passphrase from %s", path)
+		}
+		return []byte(strings.TrimRight(string(p), "\r\n")), nil
+	}
+}
+
+// StaticPassphrase always returns the passphrase.
+func StaticPassphrase(passphrase []byte) PassphraseSource {
+	return func() ([]byte, error) {
+		return passphrase, nil
+	}
+}
+
+// IsEncryptedPrivateKey returns true if data is a PEM encoded private key that is encrypted either as PKCS#8
+// (`ENCRYPTED PRIVATE KEY`) or with the legacy OpenSSL PEM encryption (`Proc-Type: 4,ENCRYPTED`).
+func IsEncryptedPrivateKey(data []byte) bool {
+	block, _ := pem.Decode(data)
+	//lint:ignore SA1019 legacy encrypted keys are still supported for reading
+	return block != nil && (block.Type == "ENCRYPTED PRIVATE KEY" || x509.IsEncryptedPEMBlock(block)) //nolint:staticcheck
+}
+
+// LoadEncryptedPrivateKey works like LoadPrivateKey but also loads encrypted PEM private keys. Keys encrypted as
+// PKCS#8 must use PBES2 with PBKDF2 or scrypt and AES-CBC or 3DES-CBC, which is what OpenSSL uses by default. The
+// legacy OpenSSL PEM encryption is supported as well but should not be used for new keys because it is insecure.
+//
+// The passphrase is only requested if the key is encrypted.
+func LoadEncryptedPrivateKey(data []byte, passphrase PassphraseSource) (interface{}, error) {
+	if !IsEncryptedPrivateKey(data) {
+		return LoadPrivateKey(data)
+	}
+
+	if passphrase == nil {
+		return nil, errors.WithStack(ErrPassphraseRequired)
+	}
+	p, err := passphrase()
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block.Type == "ENCRYPTED PRIVATE KEY" {
+		der, err := decryptPKCS8(block.Bytes, p)
+		if err != nil {
+			return nil, err
+		}
+		key, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return nil, errors.WithStack(ErrIncorrectPassphrase)
+		}
+		return key, nil
+	}
+
+	//lint:ignore SA1019 legacy encrypted keys are still supported for reading
+	der, err := x509.DecryptPEMBlock(block, p) //nolint:staticcheck
+	if err != nil {
+		return nil, errors.WithStack(ErrIncorrectPassphrase)
+	}
+	key, err := LoadPrivateKey(pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der}))
+	if err != nil {
+		return nil, errors.WithStack(ErrIncorrectPassphrase)
+	}
+	return key, nil
+}
+
+// EncryptPKCS8PrivateKey encrypts an RSA, ECDSA, or Ed25519 private key with the passphrase using PBES2 with
+// PBKDF2-HMAC-SHA256 and AES-256-CBC and returns an `ENCRYPTED PRIVATE KEY` PEM block.
+func EncryptPKCS8PrivateKey(key interface{}, passphrase []byte) (*pem.Block, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	salt := make([]byte, 16)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	const iterations = 600000
+	block, err := aes.NewCipher(pbkdf2.Key(passphrase, salt, iterations, 32, sha256.New))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	padding := aes.BlockSize - len(der)%aes.BlockSize
+	plaintext := append(der, bytes.Repeat([]byte{byte(padding)}, padding)...)
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, plaintext)
+
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:       salt,
+		Iterations: iterations,
+		PRF:        pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	encParams, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	schemeParams, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: encParams}},
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	out, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		EncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: schemeParams}},
+		EncryptedData:       ciphertext,
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: out}, nil
+}
+
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidScrypt = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA224 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 8}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+// The key derivation parameters are read from the untrusted input, so they are bounded to prevent a key from
+// consuming unlimited CPU time or memory. The limits are well above what OpenSSL and other tools use.
+const (
+	maxPBKDF2Iterations = 10000000
+	maxScryptCost       = 1 << 20
+	maxScryptBlockSize  = 32
+	maxScryptParallel   = 16
+	// maxScryptMemory bounds the memory of 128 * N * r bytes used by scrypt.
+	maxScryptMemory = 1 << 30
+)
+
+type (
+	encryptedPrivateKeyInfo struct {
+		EncryptionAlgorithm pkix.AlgorithmIdentifier
+		EncryptedData       []byte
+	}
+
+	pbes2Params struct {
+		KeyDerivationFunc pkix.AlgorithmIdentifier
+		EncryptionScheme  pkix.AlgorithmIdentifier
+	}
+
+	pbkdf2Params struct {
+		Salt       []byte
+		Iterations int
+		KeyLength  int                      `asn1:"optional"`
+		PRF        pkix.AlgorithmIdentifier `asn1:"optional"`
+	}
+
+	scryptParams struct {
+		Salt                     []byte
+		CostParameter            int
+		BlockSize                int
+		ParallelizationParameter int
+		KeyLength                int `asn1:"optional"`
+	}
+)
+
+// decryptPKCS8 decrypts a PBES2 encrypted PKCS#8 structure as defined in RFC 8018.
+func decryptPKCS8(data, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(data, &info); err != nil {
+		return nil, errors.Wrap(err, "josex: unable to parse the encrypted private key")
+	}
+	if !info.EncryptionAlgorithm.Algorithm.Equal(oidPBES2) {
+		return nil, errors.Errorf("josex: unsupported private key encryption %s, only PBES2 is supported", info.EncryptionAlgorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.EncryptionAlgorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, errors.Wrap(err, "josex: unable to parse the PBES2 parameters")
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, errors.Wrap(err, "josex: unable to parse the PBES2 initialization vector")
+	}
+
+	var keyLength int
+	var newCipher func(key []byte) (cipher.Block, error)
+	switch scheme := params.EncryptionScheme.Algorithm; {
+	case scheme.Equal(oidAES128CBC):
+		keyLength, newCipher = 16, aes.NewCipher
+	case scheme.Equal(oidAES192CBC):
+		keyLength, newCipher = 24, aes.NewCipher
+	case scheme.Equal(oidAES256CBC):
+		keyLength, newCipher = 32, aes.NewCipher
+	case scheme.Equal(oidDESEDE3CBC):
+		keyLength, newCipher = 24, des.NewTripleDESCipher
+	default:
+		return nil, errors.Errorf("josex: unsupported PBES2 encryption scheme %s", scheme)
+	}
+
+	key, err := deriveKey(params.KeyDerivationFunc, passphrase, keyLength)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := newCipher(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(iv) != block.BlockSize() || len(info.EncryptedData) == 0 || len(info.EncryptedData)%block.BlockSize() != 0 {
+		return nil, errors.New("josex: the encrypted private key is malformed")
+	}
+
+	plaintext := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, info.EncryptedData)
+
+	// Invalid padding is the usual symptom of a wrong passphrase.
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > block.BlockSize() {
+		return nil, errors.WithStack(ErrIncorrectPassphrase)
+	}
+	for _, b := range plaintext[len(plaintext)-padding:] {
+		if int(b) != padding {
+			return nil, errors.WithStack(ErrIncorrectPassphrase)
+		}
+	}
+
+	return plaintext[:len(plaintext)-padding], nil
+}
+
+func deriveKey(kdf pkix.AlgorithmIdentifier, passphrase []byte, keyLength int) ([]byte, error) {
+	switch {
+	case kdf.Algorithm.Equal(oidPBKDF2):
+		var params pbkdf2Params
+		if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &params); err != nil {
+			return nil, errors.Wrap(err, "josex: unable to parse the PBKDF2 parameters")
+		}
+		if params.Iterations < 1 || params.Iterations > maxPBKDF2Iterations {
+			return nil, errors.Errorf("josex: the PBKDF2 iteration count must be between 1 and %d but got: %d", maxPBKDF2Iterations, params.Iterations)
+		}
+
+		var h func() hash.Hash
+		switch prf := params.PRF.Algorithm; {
+		case len(prf) == 0 || prf.Equal(oidHMACWithSHA1):
+			h = sha1.New
+		case prf.Equal(oidHMACWithSHA224):
+			h = sha256.New224
+		case prf.Equal(oidHMACWithSHA256):
+			h = sha256.New
+		case prf.Equal(oidHMACWithSHA384):
+			h = sha512.New384
+		case prf.Equal(oidHMACWithSHA512):
+			h = sha512.New
+		default:
+			return nil, errors.Errorf("josex: unsupported PBKDF2 pseudo random function %s", prf)
+		}
+		return pbkdf2.Key(passphrase, params.Salt, params.Iterations, keyLength, h), nil
+	case kdf.Algorithm.Equal(oidScrypt):
+		var params scryptParams
+		if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &params); err != nil {
+			return nil, errors.Wrap(err, "josex: unable to parse the scrypt parameters")
+		}
+		if n, r, p := params.CostParameter, params.BlockSize, params.ParallelizationParameter; n < 2 || n > maxScryptCost ||
+			r < 1 || r > maxScryptBlockSize || p < 1 || p > maxScryptParallel || 128*n*r > maxScryptMemory {
+			return nil, errors.Errorf("josex: the scrypt parameters N=%d, r=%d, p=%d exceed the limits of N=%d, r=%d, p=%d, and %d bytes of memory", n, r, p, maxScryptCost, maxScryptBlockSize, maxScryptParallel, maxScryptMemory)
+		}
+
+		key, err := scrypt.Key(passphrase, params.Salt, params.CostParameter, params.BlockSize, params.ParallelizationParameter, keyLength)
+		return key, errors.WithStack(err)
+	}
+
+	return nil, errors.Errorf("josex: unsupported PBES2 key derivation function %s", kdf.Algorithm)
+}
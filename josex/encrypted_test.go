@@ -0,0 +1,131 @@
+package josex
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadEncryptedPrivateKey(t *testing.T) {
+	plain, err := ioutil.ReadFile("stub/plain.pem")
+	require.NoError(t, err)
+	expected, err := LoadPrivateKey(plain)
+	require.NoError(t, err)
+
+	// The stubs were created with openssl from stub/plain.pem using the passphrase "secret".
+	for _, stub := range []string{
+		"pbes2-aes256-sha256.pem",
+		"pbes2-des3-sha1.pem",
+		"pbes2-aes128-scrypt.pem",
+		"legacy-aes128.pem",
+	} {
+		t.Run("stub="+stub, func(t *testing.T) {
+			data, err := ioutil.ReadFile(filepath.Join("stub", stub))
+			require.NoError(t, err)
+			assert.True(t, IsEncryptedPrivateKey(data))
+
+			key, err := LoadEncryptedPrivateKey(data, StaticPassphrase([]byte("secret")))
+			require.NoError(t, err)
+			assert.True(t, expected.(*ecdsa.PrivateKey).Equal(key))
+
+			_, err = LoadEncryptedPrivateKey(data, StaticPassphrase([]byte("not-secret")))
+			assert.True(t, errors.Is(err, ErrIncorrectPassphrase), "%+v", err)
+
+			_, err = LoadEncryptedPrivateKey(data, nil)
+			assert.True(t, errors.Is(err, ErrPassphraseRequired), "%+v", err)
+
+			_, err = LoadPrivateKey(data)
+			assert.True(t, errors.Is(err, ErrPassphraseRequired), "%+v", err)
+		})
+	}
+
+	t.Run("case=rejects PBES1", func(t *testing.T) {
+		data, err := ioutil.ReadFile("stub/pbes1.pem")
+		require.NoError(t, err)
+
+		_, err = LoadEncryptedPrivateKey(data, StaticPassphrase([]byte("secret")))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "only PBES2 is supported")
+	})
+
+	t.Run("case=rejects excessive key derivation parameters", func(t *testing.T) {
+		for name, params := range map[string]interface{}{
+			"pbkdf2 iterations": pbkdf2Params{Salt: []byte("salt"), Iterations: maxPBKDF2Iterations + 1},
+			"pbkdf2 zero":       pbkdf2Params{Salt: []byte("salt"), Iterations: 0},
+			"scrypt N":          scryptParams{Salt: []byte("salt"), CostParameter: 1 << 21, BlockSize: 8, ParallelizationParameter: 1},
+			"scrypt r":          scryptParams{Salt: []byte("salt"), CostParameter: 1 << 14, BlockSize: 1 << 20, ParallelizationParameter: 1},
+			"scrypt p":          scryptParams{Salt: []byte("salt"), CostParameter: 1 << 14, BlockSize: 8, ParallelizationParameter: 1 << 20},
+			"scrypt memory":     scryptParams{Salt: []byte("salt"), CostParameter: 1 << 20, BlockSize: 16, ParallelizationParameter: 1},
+		} {
+			t.Run("params="+name, func(t *testing.T) {
+				raw, err := asn1.Marshal(params)
+				require.NoError(t, err)
+
+				oid := oidPBKDF2
+				if _, ok := params.(scryptParams); ok {
+					oid = oidScrypt
+				}
+				_, err = deriveKey(pkix.AlgorithmIdentifier{Algorithm: oid, Parameters: asn1.RawValue{FullBytes: raw}}, []byte("secret"), 32)
+				require.Error(t, err)
+				assert.Regexp(t, "iteration count must be between|scrypt parameters .* exceed the limits", err.Error())
+			})
+		}
+	})
+
+	t.Run("case=loads unencrypted keys without asking for the passphrase", func(t *testing.T) {
+		key, err := LoadEncryptedPrivateKey(plain, func() ([]byte, error) {
+			t.Fatal("the passphrase should not be requested")
+			return nil, nil
+		})
+		require.NoError(t, err)
+		assert.True(t, expected.(*ecdsa.PrivateKey).Equal(key))
+	})
+
+	t.Run("case=round trips encrypted keys", func(t *testing.T) {
+		for name, key := range testKeys(t) {
+			t.Run("key="+name, func(t *testing.T) {
+				block, err := EncryptPKCS8PrivateKey(key, []byte("secret"))
+				require.NoError(t, err)
+
+				loaded, err := LoadEncryptedPrivateKey(pem.EncodeToMemory(block), StaticPassphrase([]byte("secret")))
+				require.NoError(t, err)
+				assert.True(t, key.(equaler).Equal(loaded))
+			})
+		}
+	})
+}
+
+func TestPassphraseSources(t *testing.T) {
+	t.Run("case=env", func(t *testing.T) {
+		require.NoError(t, os.Setenv("JOSEX_TEST_PASSPHRASE", "secret"))
+		defer os.Unsetenv("JOSEX_TEST_PASSPHRASE")
+
+		p, err := PassphraseFromEnv("JOSEX_TEST_PASSPHRASE")()
+		require.NoError(t, err)
+		assert.Equal(t, "secret", string(p))
+
+		_, err = PassphraseFromEnv("JOSEX_TEST_PASSPHRASE_UNSET")()
+		assert.Error(t, err)
+	})
+
+	t.Run("case=file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "passphrase")
+		require.NoError(t, ioutil.WriteFile(path, []byte("secret\n"), 0600))
+
+		p, err := PassphraseFromFile(path)()
+		require.NoError(t, err)
+		assert.Equal(t, "secret", string(p))
+
+		_, err = PassphraseFromFile(path + "-missing")()
+		assert.Error(t, err)
+	})
+}
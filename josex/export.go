@@ -0,0 +1,186 @@
+package josex
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// Format is an encoding for keys.
+type Format string
+
+const (
+	// FormatPKCS1 is the PEM encoded PKCS#1 format (`RSA PRIVATE KEY` and `RSA PUBLIC KEY`). It supports RSA keys only.
+	FormatPKCS1 Format = "pkcs1"
+	// FormatPKCS8 is the PEM encoded PKCS#8 format (`PRIVATE KEY`). Public keys are encoded as PKIX
+	// SubjectPublicKeyInfo (`PUBLIC KEY`).
+	FormatPKCS8 Format = "pkcs8"
+	// FormatSEC1 is the PEM encoded SEC 1 format (`EC PRIVATE KEY`). It supports ECDSA private keys only.
+	FormatSEC1 Format = "sec1"
+	// FormatDER is the binary form of FormatPKCS8.
+	FormatDER Format = "der"
+	// FormatJWK is a JSON Web Key.
+	FormatJWK Format = "jwk"
+	// FormatJWKS is a JSON Web Key Set containing a single key.
+	FormatJWKS Format = "jwks"
+	// FormatOpenSSH is the openssh-key-v1 format (`OPENSSH PRIVATE KEY`) for private keys and the authorized_keys
+	// format for public keys.
+	FormatOpenSSH Format = "openssh"
+)
+
+// Formats lists all formats supported by ExportPrivateKey and ExportPublicKey.
+func Formats() []Format {
+	return []Format{FormatPKCS1, FormatPKCS8, FormatSEC1, FormatDER, FormatJWK, FormatJWKS, FormatOpenSSH}
+}
+
+// ExportPrivateKey encodes an RSA, ECDSA, or Ed25519 private key in the given format. The key may also be
+// a *jose.JSONWebKey as returned by LoadPrivateKey, in which case its key ID, algorithm and use are kept for
+// JWK output. Otherwise the RFC 7638 thumbprint is used as the key ID.
+func ExportPrivateKey(key interface{}, format Format) ([]byte, error) {
+	jwk, err := toJSONWebKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if jwk.IsPublic() {
+		return nil, errors.New("josex: expected a private key but got a public key")
+	}
+
+	switch format {
+	case FormatPKCS1:
+		k, ok := jwk.Key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.Errorf("josex: PKCS#1 supports RSA keys only but got %T", jwk.Key)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}), nil
+	case FormatPKCS8, FormatDER:
+		der, err := x509.MarshalPKCS8PrivateKey(jwk.Key)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if format == FormatDER {
+			return der, nil
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+	case FormatSEC1:
+		k, ok := jwk.Key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, errors.Errorf("josex: SEC 1 supports ECDSA keys only but got %T", jwk.Key)
+		}
+		der, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+	case FormatJWK, FormatJWKS:
+		return marshalJSONWebKey(jwk, format)
+	case FormatOpenSSH:
+		block, err := openSSHPrivateKeyBlock(jwk.Key, jwk.KeyID)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(block), nil
+	}
+
+	return nil, errors.Errorf("josex: unknown key format %q, expected one of %v", format, Formats())
+}
+
+// ExportPublicKey encodes an RSA, ECDSA, or Ed25519 public key in the given format. Private keys are converted to
+// their public key. See ExportPrivateKey for how JSON Web Keys are handled.
+func ExportPublicKey(key interface{}, format Format) ([]byte, error) {
+	jwk, err := toJSONWebKey(key)
+	if err != nil {
+		return nil, err
+	}
+	public := jwk.Public()
+	if !public.Valid() {
+		return nil, errors.Errorf("josex: unable to derive a public key from %T", jwk.Key)
+	}
+
+	switch format {
+	case FormatPKCS1:
+		k, ok := public.Key.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.Errorf("josex: PKCS#1 supports RSA keys only but got %T", public.Key)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(k)}), nil
+	case FormatPKCS8, FormatDER:
+		der, err := x509.MarshalPKIXPublicKey(public.Key)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if format == FormatDER {
+			return der, nil
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+	case FormatSEC1:
+		return nil, errors.New("josex: SEC 1 does not define an encoding for public keys, use PKCS#8 instead")
+	case FormatJWK, FormatJWKS:
+		return marshalJSONWebKey(&public, format)
+	case FormatOpenSSH:
+		pub, err := ssh.NewPublicKey(public.Key)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return ssh.MarshalAuthorizedKey(pub), nil
+	}
+
+	return nil, errors.Errorf("josex: unknown key format %q, expected one of %v", format, Formats())
+}
+
+// Thumbprint returns the base64url encoded RFC 7638 SHA-256 thumbprint of an RSA, ECDSA, or Ed25519 key. Private
+// keys have the same thumbprint as their public key.
+func Thumbprint(key interface{}) (string, error) {
+	jwk, err := toJSONWebKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	tp, err := jwk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(tp), nil
+}
+
+func toJSONWebKey(key interface{}) (*jose.JSONWebKey, error) {
+	switch k := key.(type) {
+	case *jose.JSONWebKey:
+		c := *k
+		return &c, nil
+	case jose.JSONWebKey:
+		return &k, nil
+	case *ed25519.PrivateKey:
+		return toJSONWebKey(*k)
+	case *rsa.PrivateKey, *rsa.PublicKey, *ecdsa.PrivateKey, *ecdsa.PublicKey, ed25519.PrivateKey, ed25519.PublicKey:
+		jwk := &jose.JSONWebKey{Key: k}
+		tp, err := jwk.Thumbprint(crypto.SHA256)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		jwk.KeyID = base64.RawURLEncoding.EncodeToString(tp)
+		return jwk, nil
+	}
+	return nil, errors.Errorf("josex: unsupported key type %T", key)
+}
+
+func marshalJSONWebKey(jwk *jose.JSONWebKey, format Format) ([]byte, error) {
+	var v interface{} = jwk
+	if format == FormatJWKS {
+		v = &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{*jwk}}
+	}
+
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return append(out, '\n'), nil
+}
@@ -0,0 +1,131 @@
+package josex
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"encoding/pem"
+	"math/big"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+const openSSHMagic = "openssh-key-v1\x00"
+
+// openSSHPrivateKeyBlock encodes an unencrypted private key in the openssh-key-v1 format as written by ssh-keygen.
+func openSSHPrivateKeyBlock(key interface{}, comment string) (*pem.Block, error) {
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var keyType string
+	var fields []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		k.Precompute()
+		keyType = ssh.KeyAlgoRSA
+		fields = ssh.Marshal(struct {
+			N       *big.Int
+			E       *big.Int
+			D       *big.Int
+			Iqmp    *big.Int
+			P       *big.Int
+			Q       *big.Int
+			Comment string
+		}{k.N, big.NewInt(int64(k.E)), k.D, k.Precomputed.Qinv, k.Primes[0], k.Primes[1], comment})
+	case *ecdsa.PrivateKey:
+		keyType = signer.PublicKey().Type()
+		curve, err := openSSHCurveName(k.Curve)
+		if err != nil {
+			return nil, err
+		}
+		fields = ssh.Marshal(struct {
+			Curve   string
+			Pub     []byte
+			D       *big.Int
+			Comment string
+		}{curve, elliptic.Marshal(k.Curve, k.X, k.Y), k.D, comment})
+	case ed25519.PrivateKey:
+		keyType = ssh.KeyAlgoED25519
+		fields = ssh.Marshal(struct {
+			Pub     []byte
+			Priv    []byte
+			Comment string
+		}{k.Public().(ed25519.PublicKey), k, comment})
+	default:
+		return nil, errors.Errorf("josex: OpenSSH does not support private keys of type %T", key)
+	}
+
+	var check [4]byte
+	if _, err := rand.Read(check[:]); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	private := ssh.Marshal(struct {
+		Check1  uint32
+		Check2  uint32
+		Keytype string
+		Rest    []byte `ssh:"rest"`
+	}{binary.BigEndian.Uint32(check[:]), binary.BigEndian.Uint32(check[:]), keyType, fields})
+
+	// Unencrypted keys are padded to the cipher block size of 8 with the bytes 1, 2, 3, ...
+	for i := byte(1); len(private)%8 != 0; i++ {
+		private = append(private, i)
+	}
+
+	envelope := ssh.Marshal(struct {
+		CipherName   string
+		KdfName      string
+		KdfOpts      string
+		NumKeys      uint32
+		PubKey       []byte
+		PrivKeyBlock []byte
+	}{"none", "none", "", 1, signer.PublicKey().Marshal(), private})
+
+	return &pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: append([]byte(openSSHMagic), envelope...)}, nil
+}
+
+func openSSHCurveName(curve elliptic.Curve) (string, error) {
+	switch curve {
+	case elliptic.P256():
+		return "nistp256", nil
+	case elliptic.P384():
+		return "nistp384", nil
+	case elliptic.P521():
+		return "nistp521", nil
+	}
+	return "", errors.Errorf("josex: OpenSSH does not support the elliptic curve %s", curve.Params().Name)
+}
+
+// loadOpenSSHPrivateKey parses an unencrypted OpenSSH private key.
+func loadOpenSSHPrivateKey(data []byte) (interface{}, error) {
+	key, err := ssh.ParseRawPrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// The ssh package returns a pointer for Ed25519 keys, which is not what the rest of the standard library uses.
+	if k, ok := key.(*ed25519.PrivateKey); ok {
+		return *k, nil
+	}
+	return key, nil
+}
+
+// loadOpenSSHPublicKey parses a public key in the authorized_keys format.
+func loadOpenSSHPublicKey(data []byte) (interface{}, error) {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	cpk, ok := pub.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, errors.Errorf("josex: unsupported OpenSSH public key type %s", pub.Type())
+	}
+	return cpk.CryptoPublicKey(), nil
+}
@@ -41,7 +41,7 @@ func LoadJSONWebKey(json []byte, pub bool) (*jose.JSONWebKey, error) {
 	return &jwk, nil
 }
 
-// LoadPublicKey loads a public key from PEM/DER/JWK-encoded data.
+// LoadPublicKey loads a public key from PEM/DER/JWK/OpenSSH-encoded data.
 func LoadPublicKey(data []byte) (interface{}, error) {
 	input := data
 
@@ -66,16 +66,32 @@ func LoadPublicKey(data []byte) (interface{}, error) {
 		return jwk, nil
 	}
 
-	return nil, fmt.Errorf("square/go-jose: parse error, got '%s', '%s' and '%s'", err0, err1, err2)
+	pub, err3 := x509.ParsePKCS1PublicKey(input)
+	if err3 == nil {
+		return pub, nil
+	}
+
+	pub, err4 := loadOpenSSHPublicKey(data)
+	if err4 == nil {
+		return pub, nil
+	}
+
+	return nil, fmt.Errorf("square/go-jose: parse error, got '%s', '%s', '%s', '%s' and '%s'", err0, err1, err2, err3, err4)
 }
 
-// LoadPrivateKey loads a private key from PEM/DER/JWK-encoded data.
+// LoadPrivateKey loads a private key from PEM/DER/JWK/OpenSSH-encoded data.
 func LoadPrivateKey(data []byte) (interface{}, error) {
 	input := data
 
 	block, _ := pem.Decode(data)
 	if block != nil {
 		input = block.Bytes
+		if block.Type == "OPENSSH PRIVATE KEY" {
+			return loadOpenSSHPrivateKey(data)
+		}
+		if IsEncryptedPrivateKey(data) {
+			return nil, ErrPassphraseRequired
+		}
 	}
 
 	var priv interface{}
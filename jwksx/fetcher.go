@@ -1,65 +1,281 @@
 package jwksx
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"gopkg.in/square/go-jose.v2"
 )
 
+// ErrKeyNotFound is returned if the key set does not contain a key with the requested key ID. All other errors
+// returned by the fetchers mean that the key set could not be retrieved.
+var ErrKeyNotFound = errors.New("the JSON Web Key Set does not contain the key")
+
 // Fetcher is a small helper for fetching JSON Web Keys from remote endpoints.
+//
+// The key set is cached for as long as the remote allows it using the Cache-Control and Expires headers. Keys
+// that are no longer part of the remote key set are evicted when the cache is refreshed.
 type Fetcher struct {
 	sync.RWMutex
 	remote string
 	c      *http.Client
 	keys   map[string]jose.JSONWebKey
+
+	defaultTTL           time.Duration
+	minRefetchInterval   time.Duration
+	staleWhileRevalidate time.Duration
+	maxStaleness         time.Duration
+	now                  func() time.Time
+
+	// expiresAt is the time until which the cached keys are fresh.
+	expiresAt time.Time
+	// fetchedAt is the time of the last fetch attempt, regardless of its outcome.
+	fetchedAt time.Time
+	// fetches counts the completed fetch attempts and is used to coalesce concurrent fetches.
+	fetches    uint64
+	refreshing bool
+	fetchLock  sync.Mutex
+}
+
+// FetcherOption configures the Fetcher.
+type FetcherOption func(f *Fetcher)
+
+// FetcherWithHTTPClient sets the HTTP client used to fetch the keys. Defaults to a client with a 10 second timeout.
+func FetcherWithHTTPClient(c *http.Client) FetcherOption {
+	return func(f *Fetcher) {
+		f.c = c
+	}
+}
+
+// FetcherWithDefaultTTL sets for how long the keys are cached if the remote sends neither a Cache-Control max-age
+// nor an Expires header. Defaults to one hour.
+func FetcherWithDefaultTTL(ttl time.Duration) FetcherOption {
+	return func(f *Fetcher) {
+		f.defaultTTL = ttl
+	}
+}
+
+// FetcherWithMinRefetchInterval sets the minimum time between two requests to the remote. It prevents that
+// tokens with unknown key IDs cause a request every time. Defaults to five seconds.
+func FetcherWithMinRefetchInterval(interval time.Duration) FetcherOption {
+	return func(f *Fetcher) {
+		f.minRefetchInterval = interval
+	}
+}
+
+// FetcherWithStaleWhileRevalidate sets for how long expired keys are still served while the key set is being
+// refreshed in the background. Defaults to zero, which means that expired keys are refreshed before they are used.
+func FetcherWithStaleWhileRevalidate(window time.Duration) FetcherOption {
+	return func(f *Fetcher) {
+		f.staleWhileRevalidate = window
+	}
+}
+
+// FetcherWithMaxStaleness sets for how long expired keys are still served while the remote can not be reached.
+// Afterwards GetKey returns an error until the key set was fetched again. Defaults to 24 hours.
+func FetcherWithMaxStaleness(maxStaleness time.Duration) FetcherOption {
+	return func(f *Fetcher) {
+		f.maxStaleness = maxStaleness
+	}
 }
 
 // NewFetcher returns a new fetcher that can download JSON Web Keys from remote endpoints.
-func NewFetcher(remote string) *Fetcher {
-	return &Fetcher{
-		remote: remote,
-		c:      http.DefaultClient,
-		keys:   make(map[string]jose.JSONWebKey),
+func NewFetcher(remote string, opts ...FetcherOption) *Fetcher {
+	f := &Fetcher{
+		remote:             remote,
+		c:                  &http.Client{Timeout: 10 * time.Second},
+		keys:               make(map[string]jose.JSONWebKey),
+		defaultTTL:         time.Hour,
+		minRefetchInterval: 5 * time.Second,
+		maxStaleness:       24 * time.Hour,
+		now:                time.Now,
 	}
+	for _, o := range opts {
+		o(f)
+	}
+	return f
 }
 
 // GetKey retrieves a JSON Web Key from the cache, fetches it from a remote if it is not yet cached or returns an error.
 func (f *Fetcher) GetKey(kid string) (*jose.JSONWebKey, error) {
+	return f.GetKeyCtx(context.Background(), kid)
+}
+
+// GetKeyCtx works like GetKey but uses the context for requests to the remote.
+func (f *Fetcher) GetKeyCtx(ctx context.Context, kid string) (*jose.JSONWebKey, error) {
+	now := f.now()
+
+	f.RLock()
+	k, found := f.keys[kid]
+	fresh := now.Before(f.expiresAt)
+	stale := !fresh && now.Before(f.expiresAt.Add(f.staleWhileRevalidate))
+	mayFetch := now.Sub(f.fetchedAt) >= f.minRefetchInterval
+	// usable is false if the key is expired for longer than the maximum staleness.
+	usable := found && now.Before(f.expiresAt.Add(f.maxStaleness))
+	fetches := f.fetches
+	f.RUnlock()
+
+	switch {
+	case found && fresh:
+		return &k, nil
+	case found && stale:
+		if mayFetch {
+			f.refreshInBackground()
+		}
+		return &k, nil
+	case !mayFetch:
+		if usable {
+			// The keys are expired but we are not allowed to ask the remote again yet.
+			return &k, nil
+		}
+		return nil, errors.Wrapf(ErrKeyNotFound, "unable to find JSON Web Key with ID %s", kid)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// The fetch is shared with concurrent callers, so it must not be aborted if this caller gives up.
+	fetched := make(chan error, 1)
+	go func() {
+		fetched <- f.fetch(context.Background(), fetches)
+	}()
+
+	var err error
+	select {
+	case <-ctx.Done():
+		err = errors.WithStack(ctx.Err())
+	case err = <-fetched:
+	}
+	if err != nil {
+		if usable {
+			// The key is expired but still known, which is better than rejecting every token while the remote is down.
+			return &k, nil
+		}
+		return nil, err
+	}
+
 	f.RLock()
+	defer f.RUnlock()
 	if k, ok := f.keys[kid]; ok {
-		f.RUnlock()
 		return &k, nil
 	}
+
+	return nil, errors.Wrapf(ErrKeyNotFound, "unable to find JSON Web Key with ID %s", kid)
+}
+
+func (f *Fetcher) refreshInBackground() {
+	f.Lock()
+	if f.refreshing {
+		f.Unlock()
+		return
+	}
+	f.refreshing = true
+	f.Unlock()
+
+	f.RLock()
+	fetches := f.fetches
 	f.RUnlock()
 
-	res, err := f.c.Get(f.remote)
+	go func() {
+		// Errors are ignored because the stale keys are served until they are evicted.
+		_ = f.fetch(context.Background(), fetches)
+
+		f.Lock()
+		f.refreshing = false
+		f.Unlock()
+	}()
+}
+
+// fetch downloads the key set and replaces the cached keys. Concurrent calls result in a single request.
+func (f *Fetcher) fetch(ctx context.Context, seen uint64) error {
+	f.fetchLock.Lock()
+	defer f.fetchLock.Unlock()
+
+	f.Lock()
+	if f.fetches != seen {
+		// Another goroutine fetched the keys while we were waiting for the lock.
+		f.Unlock()
+		return nil
+	}
+	f.fetchedAt = f.now()
+	f.Unlock()
+
+	defer func() {
+		f.Lock()
+		f.fetches++
+		f.Unlock()
+	}()
+
+	req, err := http.NewRequest("GET", f.remote, nil)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return errors.WithStack(err)
+	}
+
+	res, err := f.c.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.WithStack(err)
 	}
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
-		return nil, errors.Errorf("expected status code 200 but got %d when requesting %s", res.StatusCode, f.remote)
+		return errors.Errorf("expected status code 200 but got %d when requesting %s", res.StatusCode, f.remote)
 	}
 
 	var set jose.JSONWebKeySet
 	if err := json.NewDecoder(res.Body).Decode(&set); err != nil {
-		return nil, errors.WithStack(err)
+		return errors.WithStack(err)
 	}
 
+	keys := make(map[string]jose.JSONWebKey, len(set.Keys))
 	for _, k := range set.Keys {
-		f.Lock()
-		f.keys[k.KeyID] = k
-		f.Unlock()
+		keys[k.KeyID] = k
 	}
 
-	f.RLock()
-	defer f.RUnlock()
-	if k, ok := f.keys[kid]; ok {
-		return &k, nil
+	f.Lock()
+	defer f.Unlock()
+	f.keys = keys
+	f.expiresAt = f.now().Add(cacheTTL(res.Header, f.defaultTTL, f.now()))
+	return nil
+}
+
+// cacheTTL returns for how long a response may be cached according to its Cache-Control and Expires headers.
+func cacheTTL(h http.Header, defaultTTL time.Duration, now time.Time) time.Duration {
+	if cc := h.Get("Cache-Control"); cc != "" {
+		for _, directive := range strings.Split(cc, ",") {
+			directive = strings.ToLower(strings.TrimSpace(directive))
+			switch {
+			case directive == "no-store" || directive == "no-cache":
+				return 0
+			case strings.HasPrefix(directive, "max-age="):
+				if seconds, err := strconv.ParseInt(strings.TrimPrefix(directive, "max-age="), 10, 64); err == nil && seconds >= 0 {
+					return time.Duration(seconds) * time.Second
+				}
+			}
+		}
+	}
+
+	if expires := h.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			// Invalid dates, especially "0", represent a time in the past.
+			return 0
+		}
+
+		if date, err := http.ParseTime(h.Get("Date")); err == nil {
+			now = date
+		}
+
+		if ttl := t.Sub(now); ttl > 0 {
+			return ttl
+		}
+		return 0
 	}
 
-	return nil, errors.Errorf("unable to find JSON Web Key with ID: %s", kid)
+	return defaultTTL
 }
@@ -0,0 +1,270 @@
+package jwksx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/square/go-jose.v2"
+
+	"github.com/ory/x/fetcher"
+	"github.com/ory/x/httpx"
+)
+
+// ErrKeyIDCollision is returned when several sources publish different keys with the same key ID.
+var ErrKeyIDCollision = errors.New("multiple JSON Web Key Sets contain different keys with the same key ID")
+
+type (
+	// MultiFetcher aggregates JSON Web Key Sets from several sources and resolves key IDs across all of them.
+	//
+	// Sources can be http(s), file, and base64 locations as supported by fetcher.Fetcher. A source that can not
+	// be reached keeps serving the keys it returned the last time. Known keys are returned right away after the
+	// TTL expired while the sources are refreshed in the background.
+	MultiFetcher struct {
+		sync.RWMutex
+		sources []string
+		keys    map[string][]jose.JSONWebKey
+		errs    map[string]error
+		inline  map[string]bool
+		fetcher *fetcher.Fetcher
+
+		ttl                time.Duration
+		minRefetchInterval time.Duration
+		now                func() time.Time
+
+		expiresAt  time.Time
+		fetchedAt  time.Time
+		fetches    uint64
+		refreshing bool
+		fetchLock  sync.Mutex
+	}
+
+	// MultiFetcherOption configures the MultiFetcher.
+	MultiFetcherOption func(f *MultiFetcher)
+)
+
+// MultiFetcherWithFetcher sets the fetcher used to load the sources. Defaults to a fetcher which does not retry and
+// times out after ten seconds, so that unreachable sources do not stall the verification of tokens.
+func MultiFetcherWithFetcher(fetcher *fetcher.Fetcher) MultiFetcherOption {
+	return func(f *MultiFetcher) {
+		f.fetcher = fetcher
+	}
+}
+
+// MultiFetcherWithTTL sets for how long the fetched keys are used before all sources are fetched again.
+// Defaults to one hour.
+func MultiFetcherWithTTL(ttl time.Duration) MultiFetcherOption {
+	return func(f *MultiFetcher) {
+		f.ttl = ttl
+	}
+}
+
+// MultiFetcherWithMinRefetchInterval sets the minimum time between two fetches of the sources. It prevents that
+// tokens with unknown key IDs cause requests every time. Defaults to five seconds.
+func MultiFetcherWithMinRefetchInterval(interval time.Duration) MultiFetcherOption {
+	return func(f *MultiFetcher) {
+		f.minRefetchInterval = interval
+	}
+}
+
+// MultiFetcherWithKeySet adds an inline key set which is never refetched. The name is used in error messages.
+func MultiFetcherWithKeySet(name string, set *jose.JSONWebKeySet) MultiFetcherOption {
+	return func(f *MultiFetcher) {
+		f.sources = append(f.sources, name)
+		f.keys[name] = set.Keys
+		f.inline[name] = true
+	}
+}
+
+// NewMultiFetcher returns a new fetcher that resolves JSON Web Keys from all of the sources.
+func NewMultiFetcher(sources []string, opts ...MultiFetcherOption) *MultiFetcher {
+	f := &MultiFetcher{
+		sources: append([]string{}, sources...),
+		keys:    make(map[string][]jose.JSONWebKey),
+		errs:    make(map[string]error),
+		inline:  make(map[string]bool),
+		fetcher: fetcher.NewFetcher(fetcher.WithResilientClient(
+			httpx.ResilientClientWithMaxRetry(0),
+			httpx.ResilientClientWithConnectionTimeout(10*time.Second),
+		)),
+		ttl:                time.Hour,
+		minRefetchInterval: 5 * time.Second,
+		now:                time.Now,
+	}
+	for _, o := range opts {
+		o(f)
+	}
+	return f
+}
+
+// GetKey retrieves a JSON Web Key from the cache, fetches all sources if it is not yet cached or returns an error.
+func (f *MultiFetcher) GetKey(kid string) (*jose.JSONWebKey, error) {
+	return f.GetKeyCtx(context.Background(), kid)
+}
+
+// GetKeyCtx works like GetKey but uses the context for requests to remote sources.
+func (f *MultiFetcher) GetKeyCtx(ctx context.Context, kid string) (*jose.JSONWebKey, error) {
+	now := f.now()
+
+	f.RLock()
+	k, err := f.lookup(kid)
+	fresh := now.Before(f.expiresAt)
+	mayFetch := now.Sub(f.fetchedAt) >= f.minRefetchInterval
+	fetches := f.fetches
+	f.RUnlock()
+
+	if fresh && k != nil {
+		return k, nil
+	} else if errors.Is(err, ErrKeyIDCollision) && (fresh || !mayFetch) {
+		return nil, err
+	} else if !mayFetch {
+		if k != nil {
+			return k, nil
+		}
+		return nil, f.notFound(kid)
+	} else if k != nil && err == nil && fetches > 0 {
+		// The key is known, so callers do not have to wait for the sources, some of which might be unreachable.
+		f.refreshInBackground(fetches)
+		return k, nil
+	}
+
+	f.fetch(ctx, fetches)
+
+	f.RLock()
+	defer f.RUnlock()
+	if k, err := f.lookup(kid); err != nil {
+		return nil, err
+	} else if k != nil {
+		return k, nil
+	}
+	return nil, f.notFound(kid)
+}
+
+func (f *MultiFetcher) refreshInBackground(fetches uint64) {
+	f.Lock()
+	if f.refreshing {
+		f.Unlock()
+		return
+	}
+	f.refreshing = true
+	f.Unlock()
+
+	go func() {
+		f.fetch(context.Background(), fetches)
+
+		f.Lock()
+		f.refreshing = false
+		f.Unlock()
+	}()
+}
+
+// lookup finds the key in all sources. It returns nil if the key was not found. The caller must hold the lock.
+func (f *MultiFetcher) lookup(kid string) (*jose.JSONWebKey, error) {
+	var (
+		found     *jose.JSONWebKey
+		foundRaw  []byte
+		foundFrom string
+	)
+
+	for _, source := range f.sources {
+		for _, k := range f.keys[source] {
+			if k.KeyID != kid {
+				continue
+			}
+
+			raw, err := json.Marshal(k)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			if found == nil {
+				k := k
+				found, foundRaw, foundFrom = &k, raw, source
+			} else if !bytes.Equal(raw, foundRaw) {
+				return nil, errors.Wrapf(ErrKeyIDCollision, "key ID %s is used by %s and %s", kid, foundFrom, source)
+			}
+		}
+	}
+
+	return found, nil
+}
+
+// notFound returns an error that includes the fetch errors of all sources. The error only wraps ErrKeyNotFound if
+// all sources were fetched, because the key might be part of a source that could not be fetched. The caller must
+// hold the lock.
+func (f *MultiFetcher) notFound(kid string) error {
+	var reasons []string
+	for _, source := range f.sources {
+		if err := f.errs[source]; err != nil {
+			reasons = append(reasons, err.Error())
+		}
+	}
+
+	if len(reasons) > 0 {
+		return errors.Errorf("unable to find JSON Web Key with ID %s, some sources could not be fetched: %s", kid, strings.Join(reasons, "; "))
+	}
+	return errors.Wrapf(ErrKeyNotFound, "unable to find JSON Web Key with ID %s", kid)
+}
+
+// fetch loads all sources in parallel. Sources that fail keep their previous keys. Concurrent calls result in
+// a single fetch.
+func (f *MultiFetcher) fetch(ctx context.Context, seen uint64) {
+	f.fetchLock.Lock()
+	defer f.fetchLock.Unlock()
+
+	f.Lock()
+	if f.fetches != seen {
+		// Another goroutine fetched the keys while we were waiting for the lock.
+		f.Unlock()
+		return
+	}
+	f.fetchedAt = f.now()
+	sources := make([]string, 0, len(f.sources))
+	for _, source := range f.sources {
+		if f.inline[source] {
+			continue
+		}
+		sources = append(sources, source)
+	}
+	f.Unlock()
+
+	var wg sync.WaitGroup
+	for _, source := range sources {
+		wg.Add(1)
+		go func(source string) {
+			defer wg.Done()
+			keys, err := f.fetchSource(ctx, source)
+
+			f.Lock()
+			defer f.Unlock()
+			f.errs[source] = err
+			if err == nil {
+				f.keys[source] = keys
+			}
+		}(source)
+	}
+	wg.Wait()
+
+	f.Lock()
+	defer f.Unlock()
+	f.fetches++
+	f.expiresAt = f.now().Add(f.ttl)
+}
+
+func (f *MultiFetcher) fetchSource(ctx context.Context, source string) ([]jose.JSONWebKey, error) {
+	body, err := f.fetcher.FetchContext(ctx, source)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to fetch JSON Web Key Set from %s", source)
+	}
+
+	var set jose.JSONWebKeySet
+	if err := json.NewDecoder(body).Decode(&set); err != nil {
+		return nil, errors.Wrapf(err, "unable to decode JSON Web Key Set from %s", source)
+	}
+
+	return set.Keys, nil
+}
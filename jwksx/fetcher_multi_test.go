@@ -0,0 +1,195 @@
+package jwksx
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+
+	"github.com/ory/x/fetcher"
+	"github.com/ory/x/httpx"
+)
+
+const otherKeys = `{
+  "keys": [
+    {
+      "use": "sig",
+      "kty": "oct",
+      "kid": "other",
+      "alg": "HS256",
+      "k": "b3RoZXJvdGhlcm90aGVyb3RoZXJvdGhlcm90aGVyb3Ro"
+    }
+  ]
+}`
+
+func newTestMultiFetcher(clock *fakeClock, sources []string, opts ...MultiFetcherOption) *MultiFetcher {
+	f := NewMultiFetcher(sources, opts...)
+	f.now = clock.now
+	return f
+}
+
+func TestMultiFetcher(t *testing.T) {
+	t.Run("case=resolves keys from all sources", func(t *testing.T) {
+		s, ts := newKeyServer(t, nil)
+
+		file := filepath.Join(t.TempDir(), "jwks.json")
+		require.NoError(t, ioutil.WriteFile(file, []byte(otherKeys), 0600))
+
+		inline := &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{KeyID: "inline", Key: []byte(secret), Algorithm: "HS256", Use: "sig"}}}
+
+		f := NewMultiFetcher([]string{
+			ts.URL,
+			"file://" + file,
+			"base64://" + base64.StdEncoding.EncodeToString([]byte(keys)),
+		}, MultiFetcherWithKeySet("inline", inline))
+
+		for _, id := range []string{kid, "other", "inline"} {
+			k, err := f.GetKey(id)
+			require.NoError(t, err, id)
+			assert.Equal(t, id, k.KeyID)
+		}
+		assert.EqualValues(t, 1, s.calls())
+
+		_, err := f.GetKey("does-not-exist")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "does-not-exist")
+		assert.EqualValues(t, 1, s.calls())
+	})
+
+	t.Run("case=detects key ID collisions", func(t *testing.T) {
+		_, ts := newKeyServer(t, nil)
+
+		colliding := &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{KeyID: kid, Key: []byte("not-the-same-secret"), Algorithm: "HS256", Use: "sig"}}}
+		f := NewMultiFetcher([]string{ts.URL}, MultiFetcherWithKeySet("inline", colliding))
+
+		_, err := f.GetKey(kid)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrKeyIDCollision), "%+v", err)
+		assert.Contains(t, err.Error(), ts.URL)
+		assert.Contains(t, err.Error(), "inline")
+	})
+
+	t.Run("case=allows the same key in several sources", func(t *testing.T) {
+		_, ts := newKeyServer(t, nil)
+
+		f := NewMultiFetcher([]string{ts.URL, "base64://" + base64.StdEncoding.EncodeToString([]byte(keys))})
+
+		k, err := f.GetKey(kid)
+		require.NoError(t, err)
+		assert.EqualValues(t, secret, fmt.Sprintf("%s", k.Key))
+	})
+
+	t.Run("case=keeps serving cached keys of unreachable sources", func(t *testing.T) {
+		s, ts := newKeyServer(t, nil)
+		clock := &fakeClock{t: time.Now()}
+
+		f := newTestMultiFetcher(clock, []string{ts.URL}, MultiFetcherWithTTL(time.Minute),
+			MultiFetcherWithFetcher(fetcher.NewFetcher(fetcher.WithResilientClient(httpx.ResilientClientWithMaxRetry(0)))))
+
+		_, err := f.GetKey(kid)
+		require.NoError(t, err)
+
+		ts.Close()
+		clock.advance(time.Hour)
+
+		k, err := f.GetKey(kid)
+		require.NoError(t, err)
+		assert.EqualValues(t, secret, fmt.Sprintf("%s", k.Key))
+		assert.EqualValues(t, 1, s.calls())
+
+		clock.advance(time.Hour)
+		_, err = f.GetKey("does-not-exist")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "could not be fetched")
+		assert.Contains(t, err.Error(), ts.URL)
+	})
+
+	t.Run("case=does not wait for slow sources if the key is cached", func(t *testing.T) {
+		release := make(chan struct{})
+		var slow bool
+		var l sync.Mutex
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			l.Lock()
+			wait := slow
+			l.Unlock()
+			if wait {
+				<-release
+			}
+			_, _ = w.Write([]byte(keys))
+		}))
+		t.Cleanup(ts.Close)
+		t.Cleanup(func() { close(release) })
+		clock := &fakeClock{t: time.Now()}
+
+		f := newTestMultiFetcher(clock, []string{ts.URL}, MultiFetcherWithTTL(time.Minute))
+
+		_, err := f.GetKey(kid)
+		require.NoError(t, err)
+
+		l.Lock()
+		slow = true
+		l.Unlock()
+		clock.advance(time.Hour)
+
+		got := make(chan error)
+		go func() {
+			_, err := f.GetKey(kid)
+			got <- err
+		}()
+
+		select {
+		case err := <-got:
+			require.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("GetKey waited for the source although the key is cached")
+		}
+	})
+
+	t.Run("case=refetches sources after the ttl", func(t *testing.T) {
+		s, ts := newKeyServer(t, nil)
+		clock := &fakeClock{t: time.Now()}
+
+		f := newTestMultiFetcher(clock, []string{ts.URL}, MultiFetcherWithTTL(time.Minute), MultiFetcherWithMinRefetchInterval(time.Second))
+
+		_, err := f.GetKey(kid)
+		require.NoError(t, err)
+
+		s.Lock()
+		s.keys = otherKeys
+		s.Unlock()
+
+		// unknown keys are not requested within the minimum refetch interval
+		_, err = f.GetKey("other")
+		require.Error(t, err)
+		assert.EqualValues(t, 1, s.calls())
+
+		clock.advance(time.Second)
+		_, err = f.GetKey("other")
+		require.NoError(t, err)
+		assert.EqualValues(t, 2, s.calls())
+
+		// revoked keys are evicted
+		clock.advance(time.Minute)
+		_, err = f.GetKey(kid)
+		require.Error(t, err)
+		assert.EqualValues(t, 3, s.calls())
+	})
+
+	t.Run("case=fails on invalid sources", func(t *testing.T) {
+		f := NewMultiFetcher([]string{"base64://" + base64.StdEncoding.EncodeToString([]byte("not json"))})
+
+		_, err := f.GetKey(kid)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unable to decode")
+	})
+}
@@ -1,10 +1,13 @@
 package jwksx
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -23,8 +26,62 @@ const (
   ]
 }`
 	secret = "changemechangemechangemechangeme"
+	kid    = "7d5f5ad0674ec2f2960b1a34f33370a0f71471fa0e3ef0c0a692977d276dafe8"
 )
 
+type fakeClock struct {
+	sync.Mutex
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.t = c.t.Add(d)
+}
+
+type keyServer struct {
+	sync.Mutex
+	called  int
+	keys    string
+	headers map[string]string
+}
+
+func (s *keyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	s.called++
+	for k, v := range s.headers {
+		w.Header().Set(k, v)
+	}
+	_, _ = w.Write([]byte(s.keys))
+}
+
+func (s *keyServer) calls() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.called
+}
+
+func newKeyServer(t *testing.T, headers map[string]string) (*keyServer, *httptest.Server) {
+	s := &keyServer{keys: keys, headers: headers}
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+func newTestFetcher(ts *httptest.Server, clock *fakeClock, opts ...FetcherOption) *Fetcher {
+	f := NewFetcher(ts.URL, append([]FetcherOption{FetcherWithHTTPClient(ts.Client())}, opts...)...)
+	f.now = clock.now
+	return f
+}
+
 func TestFetcher(t *testing.T) {
 	var called int
 	var h http.HandlerFunc = func(w http.ResponseWriter, r *http.Request) {
@@ -46,7 +103,202 @@ func TestFetcher(t *testing.T) {
 	assert.EqualValues(t, secret, fmt.Sprintf("%s", k.Key))
 	assert.Equal(t, 1, called)
 
+	// unknown keys do not cause a refetch within the minimum refetch interval
 	_, err = f.GetKey("does-not-exist")
 	require.Error(t, err)
-	assert.Equal(t, 2, called)
+	assert.Equal(t, 1, called)
+}
+
+func TestFetcherCaching(t *testing.T) {
+	t.Run("case=refetches unknown keys after the minimum interval", func(t *testing.T) {
+		s, ts := newKeyServer(t, nil)
+		clock := &fakeClock{t: time.Now()}
+		f := newTestFetcher(ts, clock, FetcherWithMinRefetchInterval(time.Minute))
+
+		_, err := f.GetKey("does-not-exist")
+		require.Error(t, err)
+		assert.Equal(t, 1, s.calls())
+
+		for i := 0; i < 10; i++ {
+			_, err = f.GetKey("does-not-exist")
+			require.Error(t, err)
+		}
+		assert.Equal(t, 1, s.calls())
+
+		clock.advance(time.Minute)
+		_, err = f.GetKey("does-not-exist")
+		require.Error(t, err)
+		assert.Equal(t, 2, s.calls())
+	})
+
+	t.Run("case=respects cache-control and evicts revoked keys", func(t *testing.T) {
+		s, ts := newKeyServer(t, map[string]string{"Cache-Control": "public, max-age=60"})
+		clock := &fakeClock{t: time.Now()}
+		f := newTestFetcher(ts, clock)
+
+		_, err := f.GetKey(kid)
+		require.NoError(t, err)
+
+		s.Lock()
+		s.keys = `{"keys":[]}`
+		s.Unlock()
+
+		clock.advance(59 * time.Second)
+		_, err = f.GetKey(kid)
+		require.NoError(t, err)
+		assert.Equal(t, 1, s.calls())
+
+		clock.advance(time.Second)
+		_, err = f.GetKey(kid)
+		require.Error(t, err)
+		assert.Equal(t, 2, s.calls())
+	})
+
+	t.Run("case=serves stale keys while revalidating", func(t *testing.T) {
+		s, ts := newKeyServer(t, map[string]string{"Cache-Control": "max-age=60"})
+		clock := &fakeClock{t: time.Now()}
+		f := newTestFetcher(ts, clock, FetcherWithStaleWhileRevalidate(time.Minute))
+
+		_, err := f.GetKey(kid)
+		require.NoError(t, err)
+
+		clock.advance(90 * time.Second)
+		_, err = f.GetKey(kid)
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			return s.calls() == 2
+		}, time.Second, time.Millisecond)
+
+		// the cache is fresh again
+		_, err = f.GetKey(kid)
+		require.NoError(t, err)
+		assert.Equal(t, 2, s.calls())
+	})
+
+	t.Run("case=serves expired keys if the remote is unavailable", func(t *testing.T) {
+		s, ts := newKeyServer(t, map[string]string{"Cache-Control": "max-age=60"})
+		clock := &fakeClock{t: time.Now()}
+		f := newTestFetcher(ts, clock)
+
+		_, err := f.GetKey(kid)
+		require.NoError(t, err)
+
+		ts.Close()
+		clock.advance(time.Hour)
+		k, err := f.GetKey(kid)
+		require.NoError(t, err)
+		assert.EqualValues(t, secret, fmt.Sprintf("%s", k.Key))
+		assert.Equal(t, 1, s.calls())
+	})
+
+	t.Run("case=stops serving expired keys after the maximum staleness", func(t *testing.T) {
+		_, ts := newKeyServer(t, map[string]string{"Cache-Control": "max-age=60"})
+		clock := &fakeClock{t: time.Now()}
+		f := newTestFetcher(ts, clock, FetcherWithMaxStaleness(time.Hour))
+
+		_, err := f.GetKey(kid)
+		require.NoError(t, err)
+
+		ts.Close()
+		clock.advance(time.Hour)
+		_, err = f.GetKey(kid)
+		require.NoError(t, err)
+
+		clock.advance(time.Minute)
+		_, err = f.GetKey(kid)
+		require.Error(t, err)
+	})
+
+	t.Run("case=canceling one caller does not abort the shared fetch", func(t *testing.T) {
+		release := make(chan struct{})
+		s := &keyServer{keys: keys}
+		blocking := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			s.ServeHTTP(w, r)
+		}))
+		t.Cleanup(blocking.Close)
+		f := NewFetcher(blocking.URL, FetcherWithMinRefetchInterval(0))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		canceled := make(chan error)
+		go func() {
+			_, err := f.GetKeyCtx(ctx, kid)
+			canceled <- err
+		}()
+
+		waiting := make(chan error)
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			_, err := f.GetKey(kid)
+			waiting <- err
+		}()
+
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+		assert.Error(t, <-canceled)
+
+		close(release)
+		assert.NoError(t, <-waiting)
+		assert.Equal(t, 1, s.calls())
+	})
+
+	t.Run("case=uses the context", func(t *testing.T) {
+		_, ts := newKeyServer(t, nil)
+		f := NewFetcher(ts.URL)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := f.GetKeyCtx(ctx, kid)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "context canceled")
+	})
+
+	t.Run("case=coalesces concurrent requests", func(t *testing.T) {
+		s, ts := newKeyServer(t, nil)
+		f := NewFetcher(ts.URL, FetcherWithMinRefetchInterval(0))
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := f.GetKey(kid)
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 1, s.calls())
+	})
+}
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for k, tc := range []struct {
+		headers  map[string]string
+		expected time.Duration
+	}{
+		{expected: time.Hour},
+		{headers: map[string]string{"Cache-Control": "max-age=120"}, expected: 2 * time.Minute},
+		{headers: map[string]string{"Cache-Control": "public, max-age=120, must-revalidate"}, expected: 2 * time.Minute},
+		{headers: map[string]string{"Cache-Control": "no-store"}, expected: 0},
+		{headers: map[string]string{"Cache-Control": "no-cache, max-age=120"}, expected: 0},
+		{headers: map[string]string{"Expires": now.Add(time.Minute).Format(http.TimeFormat)}, expected: time.Minute},
+		{headers: map[string]string{
+			"Expires": now.Add(time.Minute).Format(http.TimeFormat),
+			"Date":    now.Add(-time.Minute).Format(http.TimeFormat),
+		}, expected: 2 * time.Minute},
+		{headers: map[string]string{"Expires": "0"}, expected: 0},
+		{headers: map[string]string{"Cache-Control": "max-age=30", "Expires": now.Add(time.Minute).Format(http.TimeFormat)}, expected: 30 * time.Second},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tc.headers {
+				h.Set(k, v)
+			}
+			assert.Equal(t, tc.expected, cacheTTL(h, time.Hour, now))
+		})
+	}
 }
@@ -69,6 +69,71 @@ func GenerateSigningKeysAvailableAlgorithms() []string {
 	}
 }
 
+// GenerateEncryptionKeys generates a JSON Web Key Set for encryption.
+//
+// For ECDH-ES algorithms, bits selects the curve (256, 384, or 521) and defaults to P-256.
+func GenerateEncryptionKeys(id, alg string, bits int) (*jose.JSONWebKeySet, error) {
+	if id == "" {
+		id = uuid.New().String()
+	}
+
+	key, err := generateEncryptionKey(jose.KeyAlgorithm(alg), bits)
+	if err != nil {
+		return nil, err
+	}
+
+	return &jose.JSONWebKeySet{
+		Keys: []jose.JSONWebKey{
+			{
+				Algorithm:    alg,
+				Use:          "enc",
+				Key:          key,
+				KeyID:        id,
+				Certificates: []*x509.Certificate{},
+			},
+		},
+	}, nil
+}
+
+// GenerateEncryptionKeysAvailableAlgorithms lists available algorithms that are supported by GenerateEncryptionKeys.
+func GenerateEncryptionKeysAvailableAlgorithms() []string {
+	return []string{
+		string(jose.RSA_OAEP), string(jose.RSA_OAEP_256),
+		string(jose.ECDH_ES), string(jose.ECDH_ES_A128KW), string(jose.ECDH_ES_A192KW), string(jose.ECDH_ES_A256KW),
+	}
+}
+
+// generateEncryptionKey generates keypair for corresponding KeyAlgorithm.
+func generateEncryptionKey(alg jose.KeyAlgorithm, bits int) (crypto.PrivateKey, error) {
+	switch alg {
+	case jose.RSA_OAEP, jose.RSA_OAEP_256:
+		if bits == 0 {
+			bits = 2048
+		}
+		if bits < 2048 {
+			return nil, errors.Errorf(`jwksx: key size must be at least 2048 bit for algorithm "%s"`, alg)
+		}
+		key, err := rsa.GenerateKey(rand.Reader, bits)
+		return key, errors.Wrapf(err, "jwks: unable to generate key")
+	case jose.ECDH_ES, jose.ECDH_ES_A128KW, jose.ECDH_ES_A192KW, jose.ECDH_ES_A256KW:
+		var curve elliptic.Curve
+		switch bits {
+		case 0, 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf(`jwksx: key size must be one of 256, 384, or 521 bit for algorithm "%s" but got: %d`, alg, bits)
+		}
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		return key, errors.Wrapf(err, "jwks: unable to generate key")
+	default:
+		return nil, errors.Errorf(`jwksx: available algorithms are "%+v" but unknown algorithm was requested: "%s"`, GenerateEncryptionKeysAvailableAlgorithms(), alg)
+	}
+}
+
 // generate generates keypair for corresponding SignatureAlgorithm.
 func generate(alg jose.SignatureAlgorithm, bits int) (crypto.PrivateKey, error) {
 	switch alg {
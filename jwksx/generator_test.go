@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/square/go-jose/v3"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -32,3 +33,29 @@ func TestGenerateSigningKeys(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateEncryptionKeys(t *testing.T) {
+	for _, alg := range GenerateEncryptionKeysAvailableAlgorithms() {
+		t.Run(fmt.Sprintf("alg=%s", alg), func(t *testing.T) {
+			set, err := GenerateEncryptionKeys("", alg, 0)
+			require.NoError(t, err)
+			require.Len(t, set.Keys, 1)
+			assert.Equal(t, "enc", set.Keys[0].Use)
+			assert.Equal(t, alg, set.Keys[0].Algorithm)
+		})
+	}
+
+	for _, tc := range []struct {
+		alg  jose.KeyAlgorithm
+		bits int
+	}{
+		{alg: jose.RSA_OAEP, bits: 1024},     // should fail because minimum 2048 bit
+		{alg: jose.ECDH_ES, bits: 512},       // should fail because there is no such curve
+		{alg: jose.KeyAlgorithm(jose.RS256)}, // should fail because it is a signature algorithm
+	} {
+		t.Run(fmt.Sprintf("alg=%s/bit=%d", tc.alg, tc.bits), func(t *testing.T) {
+			_, err := GenerateEncryptionKeys("", string(tc.alg), tc.bits)
+			require.Error(t, err)
+		})
+	}
+}
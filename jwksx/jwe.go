@@ -0,0 +1,70 @@
+package jwksx
+
+import (
+	"github.com/pkg/errors"
+	"github.com/square/go-jose/v3"
+)
+
+// Encrypt encrypts the plaintext for the recipient's key and returns a compact JWE. The key must have been
+// generated by GenerateEncryptionKeys or have its algorithm and `use: enc` set. If the key contains
+// private parts, only its public parts are used. The content encryption defaults to A256GCM.
+func Encrypt(plaintext []byte, key *jose.JSONWebKey, enc jose.ContentEncryption) (string, error) {
+	if key.Use != "" && key.Use != "enc" {
+		return "", errors.Errorf(`jwksx: key "%s" can not be used for encryption because its use is "%s"`, key.KeyID, key.Use)
+	}
+	if key.Algorithm == "" {
+		return "", errors.Errorf(`jwksx: key "%s" does not specify a key management algorithm`, key.KeyID)
+	}
+	if enc == "" {
+		enc = jose.A256GCM
+	}
+
+	public := key.Public()
+	if !public.Valid() {
+		return "", errors.Errorf(`jwksx: key "%s" is not an asymmetric key`, key.KeyID)
+	}
+
+	encrypter, err := jose.NewEncrypter(enc, jose.Recipient{
+		Algorithm: jose.KeyAlgorithm(key.Algorithm),
+		Key:       public.Key,
+		KeyID:     key.KeyID,
+	}, nil)
+	if err != nil {
+		return "", errors.Wrapf(err, `jwksx: unable to encrypt for key "%s"`, key.KeyID)
+	}
+
+	object, err := encrypter.Encrypt(plaintext)
+	if err != nil {
+		return "", errors.Wrapf(err, `jwksx: unable to encrypt for key "%s"`, key.KeyID)
+	}
+
+	compact, err := object.CompactSerialize()
+	return compact, errors.WithStack(err)
+}
+
+// Decrypt decrypts a compact JWE using the private key from the set that matches the key ID in the JWE header.
+// The algorithm in the header must match the algorithm of the key.
+func Decrypt(compact string, keys *jose.JSONWebKeySet) ([]byte, error) {
+	object, err := jose.ParseEncrypted(compact)
+	if err != nil {
+		return nil, errors.Wrap(err, "jwksx: unable to parse JWE")
+	}
+
+	kid := object.Header.KeyID
+	for _, key := range keys.Key(kid) {
+		if key.IsPublic() || (key.Use != "" && key.Use != "enc") {
+			continue
+		}
+		if key.Algorithm != "" && key.Algorithm != object.Header.Algorithm {
+			return nil, errors.Errorf(`jwksx: key "%s" expects algorithm "%s" but the JWE uses "%s"`, kid, key.Algorithm, object.Header.Algorithm)
+		}
+
+		plaintext, err := object.Decrypt(key.Key)
+		if err != nil {
+			return nil, errors.Wrapf(err, `jwksx: unable to decrypt JWE with key "%s"`, kid)
+		}
+		return plaintext, nil
+	}
+
+	return nil, errors.Errorf(`jwksx: unable to find a private encryption key with ID "%s"`, kid)
+}
@@ -0,0 +1,68 @@
+package jwksx
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/square/go-jose/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWE(t *testing.T) {
+	for _, alg := range GenerateEncryptionKeysAvailableAlgorithms() {
+		for _, enc := range []jose.ContentEncryption{"", jose.A128GCM, jose.A128CBC_HS256} {
+			t.Run(fmt.Sprintf("alg=%s/enc=%s", alg, enc), func(t *testing.T) {
+				set, err := GenerateEncryptionKeys("", alg, 0)
+				require.NoError(t, err)
+
+				public := set.Keys[0].Public()
+				token, err := Encrypt([]byte("secret message"), &public, enc)
+				require.NoError(t, err)
+
+				plaintext, err := Decrypt(token, set)
+				require.NoError(t, err)
+				assert.Equal(t, "secret message", string(plaintext))
+			})
+		}
+	}
+
+	t.Run("case=rejects signing keys", func(t *testing.T) {
+		set, err := GenerateSigningKeys("", "RS256", 0)
+		require.NoError(t, err)
+
+		_, err = Encrypt([]byte("secret message"), &set.Keys[0], "")
+		require.Error(t, err)
+	})
+
+	t.Run("case=rejects unknown keys", func(t *testing.T) {
+		set, err := GenerateEncryptionKeys("a", "RSA-OAEP-256", 0)
+		require.NoError(t, err)
+		other, err := GenerateEncryptionKeys("b", "RSA-OAEP-256", 0)
+		require.NoError(t, err)
+
+		token, err := Encrypt([]byte("secret message"), &set.Keys[0], "")
+		require.NoError(t, err)
+
+		_, err = Decrypt(token, other)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `"a"`)
+	})
+
+	t.Run("case=rejects algorithm mismatches", func(t *testing.T) {
+		set, err := GenerateEncryptionKeys("a", "RSA-OAEP-256", 0)
+		require.NoError(t, err)
+
+		token, err := Encrypt([]byte("secret message"), &set.Keys[0], "")
+		require.NoError(t, err)
+
+		set.Keys[0].Algorithm = "RSA-OAEP"
+		_, err = Decrypt(token, set)
+		require.Error(t, err)
+	})
+
+	t.Run("case=rejects malformed tokens", func(t *testing.T) {
+		_, err := Decrypt("not-a-jwe", &jose.JSONWebKeySet{})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,434 @@
+package jwksx
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/square/go-jose/v3"
+
+	"github.com/ory/herodot"
+)
+
+type (
+	// RotatedKey is a key managed by the Rotator.
+	RotatedKey struct {
+		Key       jose.JSONWebKey `json:"key"`
+		CreatedAt time.Time       `json:"created_at"`
+		// ActivatesAt is the time from which on the key is used for signing. Until then the key is only
+		// published, so that verifiers know it before the first token is signed with it. If it is zero,
+		// CreatedAt is used.
+		ActivatesAt time.Time `json:"activates_at,omitempty"`
+		// RetiredAt is zero for the newest key. Retired keys are published for verification until the
+		// grace period is over.
+		RetiredAt time.Time `json:"retired_at,omitempty"`
+	}
+
+	// KeyStore persists the keys managed by the Rotator. Keys are always loaded and saved as a whole, ordered
+	// by their creation time.
+	//
+	// Several Rotators can share a store because saving is conditional: SaveKeys must only save the keys if
+	// the stored keys still have the version returned by LoadKeys, and return ErrKeyStoreConflict otherwise.
+	KeyStore interface {
+		// LoadKeys returns the keys and their version. The version is opaque and changes whenever the keys
+		// are saved.
+		LoadKeys(ctx context.Context) (keys []RotatedKey, version string, err error)
+		// SaveKeys replaces the keys if the stored keys are still at the given version.
+		SaveKeys(ctx context.Context, keys []RotatedKey, version string) error
+	}
+
+	// MemoryKeyStore keeps the keys in memory. All keys are lost when the process exits.
+	MemoryKeyStore struct {
+		sync.RWMutex
+		keys    []RotatedKey
+		version uint64
+	}
+
+	// FileKeyStore keeps the keys, including their private parts, in a JSON file.
+	FileKeyStore struct {
+		path string
+	}
+
+	// Rotator generates signing keys on a schedule and publishes retired keys for verification during a grace period.
+	Rotator struct {
+		sync.RWMutex
+		store KeyStore
+		keys  []RotatedKey
+
+		alg            string
+		bits           int
+		interval       time.Duration
+		prePublication time.Duration
+		gracePeriod    time.Duration
+		errorHandler   func(error)
+		now            func() time.Time
+	}
+
+	// RotatorOption configures the Rotator.
+	RotatorOption func(r *Rotator)
+)
+
+var _ KeyStore = new(MemoryKeyStore)
+var _ KeyStore = new(FileKeyStore)
+
+// ErrKeyStoreConflict is returned by KeyStore.SaveKeys if the keys were saved by someone else since they were
+// loaded.
+var ErrKeyStoreConflict = errors.New("jwksx: the keys were changed concurrently")
+
+// staleLockAge is the age after which the lock of a FileKeyStore is considered abandoned by a crashed process.
+const staleLockAge = time.Minute
+
+// NewMemoryKeyStore returns an empty in-memory key store.
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return new(MemoryKeyStore)
+}
+
+// LoadKeys implements KeyStore.
+func (s *MemoryKeyStore) LoadKeys(_ context.Context) ([]RotatedKey, string, error) {
+	s.RLock()
+	defer s.RUnlock()
+	return append([]RotatedKey{}, s.keys...), strconv.FormatUint(s.version, 10), nil
+}
+
+// SaveKeys implements KeyStore.
+func (s *MemoryKeyStore) SaveKeys(_ context.Context, keys []RotatedKey, version string) error {
+	s.Lock()
+	defer s.Unlock()
+	if version != strconv.FormatUint(s.version, 10) {
+		return errors.WithStack(ErrKeyStoreConflict)
+	}
+	s.keys = append([]RotatedKey{}, keys...)
+	s.version++
+	return nil
+}
+
+// NewFileKeyStore returns a key store that reads and writes the file at path. The file is created with mode 0600
+// when keys are saved for the first time.
+//
+// The version of the keys is the hash of the file. While saving, a lock file next to the file prevents that
+// several processes replace the file at the same time.
+func NewFileKeyStore(path string) *FileKeyStore {
+	return &FileKeyStore{path: path}
+}
+
+// LoadKeys implements KeyStore. A missing file is treated as an empty store.
+func (s *FileKeyStore) LoadKeys(_ context.Context) ([]RotatedKey, string, error) {
+	raw, version, err := s.read()
+	if err != nil || raw == nil {
+		return nil, version, err
+	}
+
+	var keys []RotatedKey
+	if err := json.Unmarshal(raw, &keys); err != nil {
+		return nil, "", errors.Wrapf(err, "unable to decode keys from %s", s.path)
+	}
+	return keys, version, nil
+}
+
+func (s *FileKeyStore) read() ([]byte, string, error) {
+	raw, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, "", nil
+	} else if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	sum := sha256.Sum256(raw)
+	return raw, hex.EncodeToString(sum[:]), nil
+}
+
+// SaveKeys implements KeyStore. The file is replaced atomically.
+func (s *FileKeyStore) SaveKeys(_ context.Context, keys []RotatedKey, version string) error {
+	raw, err := json.Marshal(keys)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, current, err := s.read(); err != nil {
+		return err
+	} else if current != version {
+		return errors.WithStack(ErrKeyStoreConflict)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(raw); err != nil {
+		_ = tmp.Close()
+		return errors.WithStack(err)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(os.Rename(tmp.Name(), s.path))
+}
+
+// lock creates the lock file. It returns ErrKeyStoreConflict if another process holds the lock.
+func (s *FileKeyStore) lock() (unlock func(), err error) {
+	path := s.path + ".lock"
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_ = f.Close()
+			return func() { _ = os.Remove(path) }, nil
+		} else if !os.IsExist(err) {
+			return nil, errors.WithStack(err)
+		}
+
+		if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) > staleLockAge {
+			// The process holding the lock probably crashed.
+			_ = os.Remove(path)
+			continue
+		}
+		break
+	}
+	return nil, errors.Wrapf(ErrKeyStoreConflict, "the keys are being saved by another process, %s exists", path)
+}
+
+// RotatorWithKeySize sets the key size passed to GenerateSigningKeys. Defaults to the algorithm's default.
+func RotatorWithKeySize(bits int) RotatorOption {
+	return func(r *Rotator) {
+		r.bits = bits
+	}
+}
+
+// RotatorWithInterval sets how often a new signing key is generated. Defaults to 30 days.
+func RotatorWithInterval(interval time.Duration) RotatorOption {
+	return func(r *Rotator) {
+		r.interval = interval
+	}
+}
+
+// RotatorWithPrePublication sets for how long new keys are published before they are used for signing. It should
+// be at least as long as verifiers cache the key set, see Fetcher. Defaults to one hour.
+func RotatorWithPrePublication(prePublication time.Duration) RotatorOption {
+	return func(r *Rotator) {
+		r.prePublication = prePublication
+	}
+}
+
+// RotatorWithGracePeriod sets for how long retired keys are published for verification. It should be at least as
+// long as the lifespan of the tokens signed with the keys. Defaults to 24 hours.
+func RotatorWithGracePeriod(gracePeriod time.Duration) RotatorOption {
+	return func(r *Rotator) {
+		r.gracePeriod = gracePeriod
+	}
+}
+
+// RotatorWithErrorHandler sets a function that is called with errors occurring in Run.
+func RotatorWithErrorHandler(handler func(error)) RotatorOption {
+	return func(r *Rotator) {
+		r.errorHandler = handler
+	}
+}
+
+// NewRotator returns a Rotator which generates keys for the given algorithm. The keys are loaded from the store and
+// a key is generated if the store is empty or the current key is due for rotation.
+func NewRotator(ctx context.Context, store KeyStore, alg string, opts ...RotatorOption) (*Rotator, error) {
+	r := &Rotator{
+		store:          store,
+		alg:            alg,
+		interval:       30 * 24 * time.Hour,
+		prePublication: time.Hour,
+		gracePeriod:    24 * time.Hour,
+		errorHandler:   func(error) {},
+		now:            time.Now,
+	}
+	for _, o := range opts {
+		o(r)
+	}
+
+	if r.interval <= 0 {
+		return nil, errors.Errorf("jwksx: the rotation interval must be positive but got: %s", r.interval)
+	} else if r.prePublication < 0 || r.prePublication >= r.interval {
+		return nil, errors.Errorf("jwksx: the pre-publication period must be between zero and the rotation interval but got: %s", r.prePublication)
+	}
+
+	// Fail early on unsupported algorithms or key sizes.
+	if _, err := generate(jose.SignatureAlgorithm(alg), r.bits); err != nil {
+		return nil, err
+	}
+
+	if err := r.RotateIfDue(ctx); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SigningKey returns the current signing key including its private parts. It is the newest key whose
+// pre-publication period is over.
+func (r *Rotator) SigningKey() jose.JSONWebKey {
+	r.RLock()
+	defer r.RUnlock()
+
+	now := r.now()
+	for i := len(r.keys) - 1; i > 0; i-- {
+		if !now.Before(activatesAt(r.keys[i])) {
+			return r.keys[i].Key
+		}
+	}
+	return r.keys[0].Key
+}
+
+// PublicKeys returns the public parts of the current key, of the keys that are about to be used for signing, and
+// of all keys that are within their grace period. Symmetric keys are never published.
+func (r *Rotator) PublicKeys() *jose.JSONWebKeySet {
+	r.RLock()
+	defer r.RUnlock()
+
+	now := r.now()
+	set := &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{}}
+	for i := len(r.keys) - 1; i >= 0; i-- {
+		k := r.keys[i]
+		if r.expired(k, now) {
+			continue
+		}
+
+		if public := k.Key.Public(); public.Valid() {
+			set.Keys = append(set.Keys, public)
+		}
+	}
+	return set
+}
+
+// Rotate generates a new signing key, retires the current key, and removes keys whose grace period is over. The new
+// key is used for signing once its pre-publication period is over.
+func (r *Rotator) Rotate(ctx context.Context) error {
+	r.Lock()
+	defer r.Unlock()
+	return r.rotate(ctx, true)
+}
+
+// RotateIfDue reloads the keys from the store and rotates them if the newest key is due for rotation, that is the
+// pre-publication period before the rotation interval of the newest key is over. Reloading and saving the keys
+// conditionally allows several instances to share one store.
+func (r *Rotator) RotateIfDue(ctx context.Context) error {
+	r.Lock()
+	defer r.Unlock()
+	return r.rotate(ctx, false)
+}
+
+// Run rotates the keys whenever they are due until the context is canceled. The keys are reloaded from the store
+// at least once a minute. Errors are passed to the error handler and the rotation is retried after a minute.
+func (r *Rotator) Run(ctx context.Context) {
+	for {
+		wait := time.Minute
+		if err := r.RotateIfDue(ctx); err != nil {
+			r.errorHandler(err)
+		} else if next := r.nextRotation().Sub(r.now()); next < wait {
+			wait = next
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// ServeHTTP writes the public key set.
+func (r *Rotator) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.Handler(herodot.NewJSONWriter(nil)).ServeHTTP(w, req)
+}
+
+// Handler returns a handler that writes the public key set using the given writer.
+func (r *Rotator) Handler(h herodot.Writer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		h.Write(w, req, r.PublicKeys())
+	})
+}
+
+func (r *Rotator) nextRotation() time.Time {
+	r.RLock()
+	defer r.RUnlock()
+	return r.due(r.keys)
+}
+
+// due returns the time at which the successor of the newest key must be generated.
+func (r *Rotator) due(keys []RotatedKey) time.Time {
+	return activatesAt(keys[len(keys)-1]).Add(r.interval - r.prePublication)
+}
+
+func activatesAt(k RotatedKey) time.Time {
+	if k.ActivatesAt.IsZero() {
+		return k.CreatedAt
+	}
+	return k.ActivatesAt
+}
+
+func (r *Rotator) expired(k RotatedKey, now time.Time) bool {
+	return !k.RetiredAt.IsZero() && !now.Before(k.RetiredAt.Add(r.gracePeriod))
+}
+
+// rotate must be called with the lock held.
+func (r *Rotator) rotate(ctx context.Context, force bool) error {
+	for attempt := 0; ; attempt++ {
+		keys, version, err := r.store.LoadKeys(ctx)
+		if err != nil {
+			return err
+		}
+
+		now := r.now()
+		if !force && len(keys) > 0 && now.Before(r.due(keys)) {
+			r.keys = keys
+			return nil
+		}
+
+		set, err := GenerateSigningKeys("", r.alg, r.bits)
+		if err != nil {
+			return err
+		}
+
+		// The first key is used right away, there are no tokens which verifiers could fail to verify.
+		activation := now.Add(r.prePublication)
+		if len(keys) == 0 {
+			activation = now
+		}
+
+		next := make([]RotatedKey, 0, len(keys)+1)
+		for _, k := range keys {
+			if k.RetiredAt.IsZero() {
+				k.RetiredAt = activation
+			}
+			if !r.expired(k, now) {
+				next = append(next, k)
+			}
+		}
+		next = append(next, RotatedKey{Key: set.Keys[0], CreatedAt: now, ActivatesAt: activation})
+
+		if err := r.store.SaveKeys(ctx, next, version); errors.Is(err, ErrKeyStoreConflict) && attempt < 2 {
+			// Another instance saved the keys since we loaded them, start over with its keys.
+			select {
+			case <-ctx.Done():
+				return errors.WithStack(ctx.Err())
+			case <-time.After(time.Duration(attempt+1) * 10 * time.Millisecond):
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		r.keys = next
+		return nil
+	}
+}
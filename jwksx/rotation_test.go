@@ -0,0 +1,202 @@
+package jwksx
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/square/go-jose/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRotator(t *testing.T, clock *fakeClock, store KeyStore, alg string, opts ...RotatorOption) *Rotator {
+	r, err := NewRotator(context.Background(), store, alg, append(opts, func(r *Rotator) {
+		r.now = clock.now
+	})...)
+	require.NoError(t, err)
+	return r
+}
+
+func keyIDs(set *jose.JSONWebKeySet) []string {
+	ids := make([]string, len(set.Keys))
+	for i, k := range set.Keys {
+		ids[i] = k.KeyID
+	}
+	return ids
+}
+
+func TestRotator(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("case=rotates keys with a pre-publication and a grace period", func(t *testing.T) {
+		clock := &fakeClock{t: time.Now()}
+		r := newTestRotator(t, clock, NewMemoryKeyStore(), "ES256",
+			RotatorWithInterval(time.Hour), RotatorWithPrePublication(5*time.Minute), RotatorWithGracePeriod(10*time.Minute))
+
+		first := r.SigningKey()
+		assert.False(t, first.IsPublic())
+		assert.Equal(t, []string{first.KeyID}, keyIDs(r.PublicKeys()))
+
+		clock.advance(54 * time.Minute)
+		require.NoError(t, r.RotateIfDue(ctx))
+		assert.Equal(t, []string{first.KeyID}, keyIDs(r.PublicKeys()))
+
+		// the next key is published before it is used for signing
+		clock.advance(time.Minute)
+		require.NoError(t, r.RotateIfDue(ctx))
+		assert.Equal(t, first.KeyID, r.SigningKey().KeyID)
+		public := keyIDs(r.PublicKeys())
+		require.Len(t, public, 2)
+		assert.Equal(t, first.KeyID, public[1])
+
+		clock.advance(5 * time.Minute)
+		second := r.SigningKey()
+		assert.Equal(t, public[0], second.KeyID)
+		assert.Equal(t, []string{second.KeyID, first.KeyID}, keyIDs(r.PublicKeys()))
+
+		clock.advance(10 * time.Minute)
+		assert.Equal(t, []string{second.KeyID}, keyIDs(r.PublicKeys()))
+
+		require.NoError(t, r.Rotate(ctx))
+		assert.Equal(t, second.KeyID, r.SigningKey().KeyID)
+		public = keyIDs(r.PublicKeys())
+		require.Len(t, public, 2)
+		assert.Equal(t, second.KeyID, public[1])
+
+		clock.advance(5 * time.Minute)
+		assert.Equal(t, public[0], r.SigningKey().KeyID)
+
+		keys, _, err := r.store.LoadKeys(ctx)
+		require.NoError(t, err)
+		require.Len(t, keys, 2, "keys past their grace period are removed from the store")
+	})
+
+	t.Run("case=persists keys in a file", func(t *testing.T) {
+		clock := &fakeClock{t: time.Now()}
+		path := filepath.Join(t.TempDir(), "keys.json")
+
+		r := newTestRotator(t, clock, NewFileKeyStore(path), "RS256")
+		key := r.SigningKey()
+
+		fi, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+		// a second instance shares the keys
+		other := newTestRotator(t, clock, NewFileKeyStore(path), "RS256")
+		assert.Equal(t, key.KeyID, other.SigningKey().KeyID)
+
+		require.NoError(t, other.Rotate(ctx))
+		require.NoError(t, r.RotateIfDue(ctx))
+		assert.Equal(t, other.SigningKey().KeyID, r.SigningKey().KeyID)
+		assert.Equal(t, keyIDs(other.PublicKeys()), keyIDs(r.PublicKeys()))
+	})
+
+	for name, newStore := range map[string]func(t *testing.T) KeyStore{
+		"memory": func(t *testing.T) KeyStore { return NewMemoryKeyStore() },
+		"file":   func(t *testing.T) KeyStore { return NewFileKeyStore(filepath.Join(t.TempDir(), "keys.json")) },
+	} {
+		t.Run("store="+name, func(t *testing.T) {
+			t.Run("case=rejects saving outdated keys", func(t *testing.T) {
+				store := newStore(t)
+				keys, version, err := store.LoadKeys(ctx)
+				require.NoError(t, err)
+
+				require.NoError(t, store.SaveKeys(ctx, []RotatedKey{}, version))
+				err = store.SaveKeys(ctx, keys, version)
+				assert.True(t, errors.Is(err, ErrKeyStoreConflict), "%+v", err)
+			})
+
+			t.Run("case=concurrent rotations do not overwrite each other", func(t *testing.T) {
+				clock := &fakeClock{t: time.Now()}
+				store := newStore(t)
+				a := newTestRotator(t, clock, store, "ES256", RotatorWithInterval(time.Hour), RotatorWithPrePublication(time.Minute))
+				b := newTestRotator(t, clock, store, "ES256", RotatorWithInterval(time.Hour), RotatorWithPrePublication(time.Minute))
+
+				clock.advance(time.Hour)
+				var wg sync.WaitGroup
+				for _, r := range []*Rotator{a, b} {
+					wg.Add(1)
+					go func(r *Rotator) {
+						defer wg.Done()
+						assert.NoError(t, r.RotateIfDue(ctx))
+					}(r)
+				}
+				wg.Wait()
+
+				keys, _, err := store.LoadKeys(ctx)
+				require.NoError(t, err)
+				assert.Len(t, keys, 2)
+				assert.Equal(t, keyIDs(a.PublicKeys()), keyIDs(b.PublicKeys()))
+			})
+		})
+	}
+
+	t.Run("case=serves public keys only", func(t *testing.T) {
+		r := newTestRotator(t, &fakeClock{t: time.Now()}, NewMemoryKeyStore(), "EdDSA")
+		require.NoError(t, r.Rotate(ctx))
+
+		ts := httptest.NewServer(r)
+		t.Cleanup(ts.Close)
+
+		res, err := ts.Client().Get(ts.URL)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		var set jose.JSONWebKeySet
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&set))
+		require.Len(t, set.Keys, 2)
+		for _, k := range set.Keys {
+			assert.True(t, k.IsPublic(), "%+v", k)
+		}
+	})
+
+	t.Run("case=never publishes symmetric keys", func(t *testing.T) {
+		r := newTestRotator(t, &fakeClock{t: time.Now()}, NewMemoryKeyStore(), "HS256")
+		assert.Len(t, r.SigningKey().Key, 32)
+		assert.Empty(t, r.PublicKeys().Keys)
+	})
+
+	t.Run("case=rejects invalid configurations", func(t *testing.T) {
+		_, err := NewRotator(ctx, NewMemoryKeyStore(), "none")
+		require.Error(t, err)
+
+		_, err = NewRotator(ctx, NewMemoryKeyStore(), "RS256", RotatorWithKeySize(1024))
+		require.Error(t, err)
+
+		_, err = NewRotator(ctx, NewMemoryKeyStore(), "RS256", RotatorWithInterval(0))
+		require.Error(t, err)
+
+		_, err = NewRotator(ctx, NewMemoryKeyStore(), "RS256", RotatorWithInterval(time.Hour), RotatorWithPrePublication(time.Hour))
+		require.Error(t, err)
+	})
+
+	t.Run("case=runs until the context is canceled", func(t *testing.T) {
+		r, err := NewRotator(ctx, NewMemoryKeyStore(), "ES256", RotatorWithInterval(10*time.Millisecond), RotatorWithPrePublication(0))
+		require.NoError(t, err)
+		first := r.SigningKey()
+
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			r.Run(ctx)
+			close(done)
+		}()
+
+		require.Eventually(t, func() bool {
+			return r.SigningKey().KeyID != first.KeyID
+		}, time.Second, time.Millisecond)
+
+		cancel()
+		<-done
+	})
+}
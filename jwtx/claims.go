@@ -1,6 +1,9 @@
 package jwtx
 
 import (
+	"encoding/json"
+	"math"
+	"strconv"
 	"time"
 
 	"github.com/pkg/errors"
@@ -9,6 +12,10 @@ import (
 )
 
 // Claims represents a JSON Web Token's standard claims.
+//
+// Claims are encoded to and decoded from JSON according to RFC 7519: times are NumericDate values (seconds since
+// the epoch), empty claims are omitted, and the audience may be a single string. Times encoded as RFC 3339 strings,
+// as done by previous versions of this package, are decoded as well.
 type Claims struct {
 	// Audience identifies the recipients that the JWT is intended for.
 	Audience []string `json:"aud"`
@@ -32,6 +39,130 @@ type Claims struct {
 	JTI string `json:"jti"`
 }
 
+// claimsJSON is the JSON representation of Claims.
+type claimsJSON struct {
+	Audience  json.RawMessage `json:"aud,omitempty"`
+	Issuer    string          `json:"iss,omitempty"`
+	Subject   string          `json:"sub,omitempty"`
+	ExpiresAt json.Number     `json:"exp,omitempty"`
+	IssuedAt  json.Number     `json:"iat,omitempty"`
+	NotBefore json.Number     `json:"nbf,omitempty"`
+	JTI       string          `json:"jti,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (c Claims) MarshalJSON() ([]byte, error) {
+	out := claimsJSON{
+		Issuer:    c.Issuer,
+		Subject:   c.Subject,
+		ExpiresAt: toNumericDate(c.ExpiresAt),
+		IssuedAt:  toNumericDate(c.IssuedAt),
+		NotBefore: toNumericDate(c.NotBefore),
+		JTI:       c.JTI,
+	}
+
+	if len(c.Audience) > 0 {
+		aud, err := json.Marshal(c.Audience)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		out.Audience = aud
+	}
+
+	return json.Marshal(out)
+}
+
+// claimsDecodeJSON is the JSON representation of Claims which accepts NumericDate and RFC 3339 times.
+type claimsDecodeJSON struct {
+	Audience  json.RawMessage `json:"aud"`
+	Issuer    string          `json:"iss"`
+	Subject   string          `json:"sub"`
+	ExpiresAt json.RawMessage `json:"exp"`
+	IssuedAt  json.RawMessage `json:"iat"`
+	NotBefore json.RawMessage `json:"nbf"`
+	JTI       string          `json:"jti"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *Claims) UnmarshalJSON(data []byte) error {
+	var in claimsDecodeJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return errors.WithStack(err)
+	}
+
+	var aud []string
+	if len(in.Audience) > 0 && string(in.Audience) != "null" {
+		var single string
+		if err := json.Unmarshal(in.Audience, &single); err == nil {
+			aud = []string{single}
+		} else if err := json.Unmarshal(in.Audience, &aud); err != nil {
+			return errors.Wrap(err, "claim aud must be a string or an array of strings")
+		}
+	}
+
+	exp, err := fromNumericDate("exp", in.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	iat, err := fromNumericDate("iat", in.IssuedAt)
+	if err != nil {
+		return err
+	}
+	nbf, err := fromNumericDate("nbf", in.NotBefore)
+	if err != nil {
+		return err
+	}
+
+	*c = Claims{
+		Audience:  aud,
+		Issuer:    in.Issuer,
+		Subject:   in.Subject,
+		ExpiresAt: exp,
+		IssuedAt:  iat,
+		NotBefore: nbf,
+		JTI:       in.JTI,
+	}
+	return nil
+}
+
+// toNumericDate encodes t as seconds since the epoch. Zero times are omitted.
+func toNumericDate(t time.Time) json.Number {
+	if t.IsZero() {
+		return ""
+	}
+	return json.Number(strconv.FormatInt(t.Unix(), 10))
+}
+
+// fromNumericDate decodes a NumericDate or, for backwards compatibility, an RFC 3339 string.
+func fromNumericDate(name string, raw json.RawMessage) (time.Time, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return time.Time{}, nil
+	}
+
+	if raw[0] == '"' {
+		var t time.Time
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return time.Time{}, errors.Wrapf(err, "claim %s must be a NumericDate", name)
+		}
+		if t.IsZero() {
+			return time.Time{}, nil
+		}
+		return t, nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err != nil {
+		return time.Time{}, errors.Wrapf(err, "claim %s must be a NumericDate", name)
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "claim %s must be a NumericDate", name)
+	}
+
+	seconds, fraction := math.Modf(f)
+	return time.Unix(int64(seconds), int64(fraction*1e9)), nil
+}
+
 // ParseMapStringInterfaceClaims converts map[string]interface{} to *Claims.
 func ParseMapStringInterfaceClaims(claims map[string]interface{}) *Claims {
 	c := make(map[interface{}]interface{})
@@ -59,3 +59,53 @@ func TestParseMapStringInterfaceClaims(t *testing.T) {
 		NotBefore: time.Unix(1234, 0),
 	}, ParseMapStringInterfaceClaims(in))
 }
+
+func TestClaimsJSON(t *testing.T) {
+	t.Run("case=encodes numeric dates", func(t *testing.T) {
+		out, err := json.Marshal(&Claims{
+			Audience:  []string{"aud"},
+			Subject:   "sub",
+			ExpiresAt: time.Unix(1234, 0),
+			IssuedAt:  time.Unix(1000, 500),
+		})
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"aud":["aud"],"sub":"sub","exp":1234,"iat":1000}`, string(out))
+
+		out, err = json.Marshal(Claims{})
+		require.NoError(t, err)
+		assert.JSONEq(t, `{}`, string(out))
+	})
+
+	t.Run("case=decodes numeric dates", func(t *testing.T) {
+		var c Claims
+		require.NoError(t, json.Unmarshal([]byte(`{"aud":"aud","iss":"iss","exp":1234,"iat":1000.5,"jti":"jti"}`), &c))
+		assert.Equal(t, Claims{
+			Audience:  []string{"aud"},
+			Issuer:    "iss",
+			ExpiresAt: time.Unix(1234, 0),
+			IssuedAt:  time.Unix(1000, 5e8),
+			JTI:       "jti",
+		}, c)
+
+		require.NoError(t, json.Unmarshal([]byte(`{"aud":["a","b"]}`), &c))
+		assert.Equal(t, Claims{Audience: []string{"a", "b"}}, c)
+	})
+
+	t.Run("case=decodes claims encoded as RFC 3339", func(t *testing.T) {
+		var c Claims
+		require.NoError(t, json.Unmarshal([]byte(`{"aud":["aud"],"iss":"iss","sub":"","exp":"2021-04-01T10:00:00Z","iat":"2021-04-01T09:00:00.5Z","nbf":"0001-01-01T00:00:00Z","jti":""}`), &c))
+		assert.Equal(t, Claims{
+			Audience:  []string{"aud"},
+			Issuer:    "iss",
+			ExpiresAt: time.Date(2021, 4, 1, 10, 0, 0, 0, time.UTC),
+			IssuedAt:  time.Date(2021, 4, 1, 9, 0, 0, 5e8, time.UTC),
+		}, c)
+	})
+
+	t.Run("case=rejects invalid claims", func(t *testing.T) {
+		for _, in := range []string{`{"exp":"tomorrow"}`, `{"exp":true}`, `{"aud":1}`, `{"aud":[1]}`} {
+			var c Claims
+			require.Error(t, json.Unmarshal([]byte(in), &c), in)
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package jwtx
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/logrusx"
+)
+
+type contextKey int
+
+const (
+	claimsContextKey contextKey = iota + 1
+	extraClaimsContextKey
+)
+
+type (
+	// Middleware is a negroni middleware which authenticates requests using bearer tokens. Verified claims are
+	// added to the request context and can be retrieved with ClaimsFromContext and ExtraClaimsFromContext.
+	Middleware struct {
+		h      herodot.Writer
+		l      *logrusx.Logger
+		verify *VerifyOptions
+
+		cookie    string
+		query     string
+		authorize Authorizer
+	}
+
+	// Authorizer decides whether a request with verified claims is allowed. Returning an error results in
+	// a 403 Forbidden response. The error is logged but not sent to the client.
+	Authorizer func(r *http.Request, claims *Claims, extra map[string]interface{}) error
+
+	// MiddlewareOption configures the Middleware.
+	MiddlewareOption func(m *Middleware)
+)
+
+// MiddlewareWithCookie also reads the token from the cookie with the given name if the Authorization header
+// is not set.
+func MiddlewareWithCookie(name string) MiddlewareOption {
+	return func(m *Middleware) {
+		m.cookie = name
+	}
+}
+
+// MiddlewareWithQueryParameter also reads the token from the query parameter with the given name if neither the
+// Authorization header nor the cookie is set. Tokens in URLs end up in logs, use this only if there is no
+// alternative, e.g. for websockets.
+func MiddlewareWithQueryParameter(name string) MiddlewareOption {
+	return func(m *Middleware) {
+		m.query = name
+	}
+}
+
+// MiddlewareWithLogger sets the logger used to log why the authorizer denied a request.
+func MiddlewareWithLogger(l *logrusx.Logger) MiddlewareOption {
+	return func(m *Middleware) {
+		m.l = l
+	}
+}
+
+// MiddlewareWithAuthorizer sets a function that is called after the token was verified.
+func MiddlewareWithAuthorizer(authorize Authorizer) MiddlewareOption {
+	return func(m *Middleware) {
+		m.authorize = authorize
+	}
+}
+
+// NewMiddleware returns a middleware which verifies bearer tokens using the verify options and writes errors
+// using h. Invalid tokens are answered with 401 Unauthorized, while failures of the key source are answered with
+// 500 Internal Server Error so that clients do not discard valid tokens.
+func NewMiddleware(h herodot.Writer, verify *VerifyOptions, opts ...MiddlewareOption) *Middleware {
+	m := &Middleware{h: h, l: logrusx.New("", ""), verify: verify}
+	for _, o := range opts {
+		o(m)
+	}
+	return m
+}
+
+func (m *Middleware) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	token := m.token(r)
+	if token == "" {
+		rw.Header().Set("WWW-Authenticate", "Bearer")
+		m.h.WriteError(rw, r, herodot.ErrUnauthorized.WithReason("The request does not contain a bearer token."))
+		return
+	}
+
+	claims, extra, err := VerifyCtx(r.Context(), token, m.verify)
+	if errors.Is(err, ErrKeySourceUnavailable) {
+		m.h.WriteError(rw, r, herodot.ErrInternalServerError.WithReason("Unable to retrieve the keys to verify the bearer token.").WithWrap(err))
+		return
+	} else if err != nil {
+		rw.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		m.h.WriteError(rw, r, herodot.ErrUnauthorized.WithReason("The bearer token is invalid.").WithDebug(err.Error()))
+		return
+	}
+
+	if m.authorize != nil {
+		if err := m.authorize(r, claims, extra); err != nil {
+			m.l.WithError(err).WithRequest(r).Info("The authorizer denied the request.")
+			rw.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+			m.h.WriteError(rw, r, herodot.ErrForbidden.WithReason("The bearer token is not allowed to access this resource."))
+			return
+		}
+	}
+
+	next(rw, r.WithContext(ContextWithClaims(r.Context(), claims, extra)))
+}
+
+// token returns the bearer token from the Authorization header, the cookie, or the query parameter.
+func (m *Middleware) token(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		parts := strings.SplitN(auth, " ", 2)
+		if len(parts) != 2 || !strings.EqualFold(parts[0], "bearer") {
+			return ""
+		}
+		return strings.TrimSpace(parts[1])
+	}
+
+	if m.cookie != "" {
+		if c, err := r.Cookie(m.cookie); err == nil && c.Value != "" {
+			return c.Value
+		}
+	}
+
+	if m.query != "" {
+		return r.URL.Query().Get(m.query)
+	}
+
+	return ""
+}
+
+// ContextWithClaims returns a context containing the claims and extra claims.
+func ContextWithClaims(ctx context.Context, claims *Claims, extra map[string]interface{}) context.Context {
+	return context.WithValue(context.WithValue(ctx, claimsContextKey, claims), extraClaimsContextKey, extra)
+}
+
+// ClaimsFromContext returns the claims added by the Middleware or nil if the request was not authenticated.
+func ClaimsFromContext(ctx context.Context) *Claims {
+	claims, _ := ctx.Value(claimsContextKey).(*Claims)
+	return claims
+}
+
+// ExtraClaimsFromContext returns the extra claims added by the Middleware or nil if the request was not
+// authenticated.
+func ExtraClaimsFromContext(ctx context.Context) map[string]interface{} {
+	extra, _ := ctx.Value(extraClaimsContextKey).(map[string]interface{})
+	return extra
+}
@@ -0,0 +1,192 @@
+package jwtx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/negroni"
+	"gopkg.in/square/go-jose.v2"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/logrusx"
+)
+
+func TestMiddleware(t *testing.T) {
+	key := newTestKey(t, "key-1")
+	verify := &VerifyOptions{
+		Keys:       &StaticKeySource{Keys: []jose.JSONWebKey{publicKey(key)}},
+		Algorithms: []string{"ES256"},
+	}
+
+	token := newTestToken(t, key, map[string]interface{}{
+		"sub":   "subject",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "read",
+	})
+	expired := newTestToken(t, key, map[string]interface{}{
+		"sub": "subject",
+		"exp": time.Now().Add(-time.Hour).Unix(),
+	})
+
+	newServer := func(t *testing.T, opts ...MiddlewareOption) *httptest.Server {
+		n := negroni.New()
+		n.Use(NewMiddleware(herodot.NewJSONWriter(logrusx.New("", "")), verify, opts...))
+		n.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprintf(w, "%s %s", ClaimsFromContext(r.Context()).Subject, ExtraClaimsFromContext(r.Context())["scope"])
+		})
+		ts := httptest.NewServer(n)
+		t.Cleanup(ts.Close)
+		return ts
+	}
+
+	do := func(t *testing.T, ts *httptest.Server, modify func(r *http.Request)) (int, string, http.Header) {
+		req, err := http.NewRequest("GET", ts.URL+"/", nil)
+		require.NoError(t, err)
+		modify(req)
+
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		var body json.RawMessage
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		return res.StatusCode, string(body), res.Header
+	}
+
+	doPlain := func(t *testing.T, ts *httptest.Server, modify func(r *http.Request)) (int, string) {
+		req, err := http.NewRequest("GET", ts.URL+"/", nil)
+		require.NoError(t, err)
+		modify(req)
+
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		var body [512]byte
+		n, _ := res.Body.Read(body[:])
+		return res.StatusCode, string(body[:n])
+	}
+
+	t.Run("case=passes claims to the next handler", func(t *testing.T) {
+		ts := newServer(t)
+		code, body := doPlain(t, ts, func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+token)
+		})
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "subject read", body)
+	})
+
+	t.Run("case=rejects missing tokens", func(t *testing.T) {
+		ts := newServer(t)
+		for k, modify := range []func(r *http.Request){
+			func(r *http.Request) {},
+			func(r *http.Request) { r.Header.Set("Authorization", "Basic Zm9vOmJhcg==") },
+			func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "token", Value: token}) },
+		} {
+			t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+				code, body, header := do(t, ts, modify)
+				assert.Equal(t, http.StatusUnauthorized, code)
+				assert.Contains(t, body, "does not contain a bearer token")
+				assert.Equal(t, "Bearer", header.Get("WWW-Authenticate"))
+			})
+		}
+	})
+
+	t.Run("case=rejects invalid tokens", func(t *testing.T) {
+		ts := newServer(t)
+		for k, tc := range []string{expired, "not-a-token"} {
+			t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+				code, body, header := do(t, ts, func(r *http.Request) {
+					r.Header.Set("Authorization", "bearer "+tc)
+				})
+				assert.Equal(t, http.StatusUnauthorized, code)
+				assert.Contains(t, body, "The bearer token is invalid.")
+				assert.Contains(t, header.Get("WWW-Authenticate"), "invalid_token")
+			})
+		}
+	})
+
+	t.Run("case=reads tokens from cookies and query parameters", func(t *testing.T) {
+		ts := newServer(t, MiddlewareWithCookie("token"), MiddlewareWithQueryParameter("access_token"))
+
+		code, body := doPlain(t, ts, func(r *http.Request) {
+			r.AddCookie(&http.Cookie{Name: "token", Value: token})
+		})
+		assert.Equal(t, http.StatusOK, code, body)
+
+		code, body = doPlain(t, ts, func(r *http.Request) {
+			q := r.URL.Query()
+			q.Set("access_token", token)
+			r.URL.RawQuery = q.Encode()
+		})
+		assert.Equal(t, http.StatusOK, code, body)
+
+		// the header takes precedence
+		code, _ = doPlain(t, ts, func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+expired)
+			r.AddCookie(&http.Cookie{Name: "token", Value: token})
+		})
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	t.Run("case=authorizes requests", func(t *testing.T) {
+		hook := &test.Hook{}
+		ts := newServer(t, MiddlewareWithLogger(logrusx.New("", "", logrusx.WithHook(hook))), MiddlewareWithAuthorizer(func(r *http.Request, claims *Claims, extra map[string]interface{}) error {
+			if r.Method == "GET" && extra["scope"] == "read" {
+				return nil
+			}
+			return errors.New("The token does not grant access to this resource.")
+		}))
+
+		code, _ := doPlain(t, ts, func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+token)
+		})
+		assert.Equal(t, http.StatusOK, code)
+
+		code, body, _ := do(t, ts, func(r *http.Request) {
+			r.Method = "DELETE"
+			r.Header.Set("Authorization", "Bearer "+token)
+		})
+		assert.Equal(t, http.StatusForbidden, code)
+		assert.NotContains(t, body, "does not grant access")
+		require.NotNil(t, hook.LastEntry())
+		assert.Contains(t, fmt.Sprintf("%v", hook.LastEntry().Data["error"]), "does not grant access")
+	})
+
+	t.Run("case=fails with an internal error if the key source is unavailable", func(t *testing.T) {
+		n := negroni.New(NewMiddleware(herodot.NewJSONWriter(logrusx.New("", "")), &VerifyOptions{
+			Keys:       failingKeySource{},
+			Algorithms: []string{"ES256"},
+		}))
+		n.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+		ts := httptest.NewServer(n)
+		defer ts.Close()
+
+		code, _, header := do(t, ts, func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+token)
+		})
+		assert.Equal(t, http.StatusInternalServerError, code)
+		assert.Empty(t, header.Get("WWW-Authenticate"))
+	})
+}
+
+type failingKeySource struct{}
+
+func (failingKeySource) GetKeyCtx(context.Context, string) (*jose.JSONWebKey, error) {
+	return nil, errors.New("the remote is down")
+}
+
+func TestClaimsFromContext(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	assert.Nil(t, ClaimsFromContext(r.Context()))
+	assert.Nil(t, ExtraClaimsFromContext(r.Context()))
+}
@@ -0,0 +1,138 @@
+package jwtx
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	v3 "github.com/square/go-jose/v3"
+	"gopkg.in/square/go-jose.v2"
+
+	"github.com/ory/x/randx"
+	"github.com/ory/x/stringslice"
+)
+
+type (
+	// Signer issues JSON Web Tokens signed with a JSON Web Key.
+	Signer struct {
+		signer jose.Signer
+		now    func() time.Time
+	}
+
+	signerOptions struct {
+		typ string
+	}
+
+	// SignerOption configures the Signer.
+	SignerOption func(o *signerOptions)
+)
+
+// SignerWithType sets the `typ` header. Defaults to `JWT`.
+func SignerWithType(typ string) SignerOption {
+	return func(o *signerOptions) {
+		o.typ = typ
+	}
+}
+
+// NewSigner returns a Signer for the key. The key must specify its algorithm, which is the case for keys
+// generated by jwksx.GenerateSigningKeys, use KeyFromV3 to convert them. Keys loaded with josex.LoadPrivateKey
+// must be wrapped in a jose.JSONWebKey with the algorithm and key ID set. The key ID is sent in the `kid` header.
+func NewSigner(key jose.JSONWebKey, opts ...SignerOption) (*Signer, error) {
+	o := &signerOptions{typ: "JWT"}
+	for _, f := range opts {
+		f(o)
+	}
+
+	if key.Algorithm == "" {
+		return nil, errors.Errorf(`jwtx: key "%s" does not specify a signing algorithm`, key.KeyID)
+	}
+	if key.Use != "" && key.Use != "sig" {
+		return nil, errors.Errorf(`jwtx: key "%s" can not be used for signatures because its use is "%s"`, key.KeyID, key.Use)
+	}
+
+	so := (&jose.SignerOptions{}).WithType(jose.ContentType(o.typ))
+	if key.KeyID != "" {
+		// go-jose only sets the key ID for asymmetric keys.
+		so = so.WithHeader("kid", key.KeyID)
+	}
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.SignatureAlgorithm(key.Algorithm), Key: key}, so)
+	if err != nil {
+		return nil, errors.Wrapf(err, `jwtx: unable to create signer for key "%s"`, key.KeyID)
+	}
+
+	return &Signer{signer: signer, now: time.Now}, nil
+}
+
+// Sign returns a compact JWS containing the claims and the custom claims. The custom claims must encode to a JSON
+// object, e.g. a struct or a map, and must not contain registered claims. If not set, `iat` is set to the current
+// time and `jti` to a random value.
+func (s *Signer) Sign(claims *Claims, custom interface{}) (string, error) {
+	var c Claims
+	if claims != nil {
+		c = *claims
+	}
+
+	if c.IssuedAt.IsZero() {
+		c.IssuedAt = s.now()
+	}
+	if c.JTI == "" {
+		jti, err := randx.RuneSequence(32, randx.AlphaNum)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		c.JTI = string(jti)
+	}
+
+	payload := map[string]interface{}{}
+	if err := remarshal(c, &payload); err != nil {
+		return "", err
+	}
+
+	if custom != nil {
+		var extra map[string]interface{}
+		if err := remarshal(custom, &extra); err != nil {
+			return "", errors.Wrap(err, "jwtx: custom claims must encode to a JSON object")
+		}
+
+		for k, v := range extra {
+			if stringslice.Has(registeredClaims, k) {
+				return "", errors.Errorf(`jwtx: custom claim "%s" conflicts with a registered claim`, k)
+			}
+			payload[k] = v
+		}
+	}
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	jws, err := s.signer.Sign(raw)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	token, err := jws.CompactSerialize()
+	return token, errors.WithStack(err)
+}
+
+// KeyFromV3 converts a key of go-jose v3, e.g. one generated by jwksx.GenerateSigningKeys, to the go-jose v2 key
+// used throughout this package.
+func KeyFromV3(key v3.JSONWebKey) jose.JSONWebKey {
+	return jose.JSONWebKey{
+		Key:          key.Key,
+		Certificates: key.Certificates,
+		KeyID:        key.KeyID,
+		Algorithm:    key.Algorithm,
+		Use:          key.Use,
+	}
+}
+
+func remarshal(in, out interface{}) error {
+	raw, err := json.Marshal(in)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(json.Unmarshal(raw, out))
+}
@@ -0,0 +1,134 @@
+package jwtx
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+
+	"github.com/ory/x/jwksx"
+)
+
+func TestSigner(t *testing.T) {
+	type custom struct {
+		Scope string   `json:"scope"`
+		Roles []string `json:"roles,omitempty"`
+	}
+
+	newSigner := func(t *testing.T, alg string, opts ...SignerOption) (*Signer, *StaticKeySource) {
+		set, err := jwksx.GenerateSigningKeys("key-1", alg, 0)
+		require.NoError(t, err)
+		key := KeyFromV3(set.Keys[0])
+
+		s, err := NewSigner(key, opts...)
+		require.NoError(t, err)
+
+		verification := key
+		if public := key.Public(); public.Valid() {
+			verification = public
+		}
+		return s, &StaticKeySource{Keys: []jose.JSONWebKey{verification}}
+	}
+
+	header := func(t *testing.T, token string) map[string]interface{} {
+		raw, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+		require.NoError(t, err)
+		var h map[string]interface{}
+		require.NoError(t, json.Unmarshal(raw, &h))
+		return h
+	}
+
+	for _, alg := range []string{"ES256", "RS256", "EdDSA", "HS256"} {
+		t.Run("alg="+alg, func(t *testing.T) {
+			s, keys := newSigner(t, alg)
+			exp := time.Now().Add(time.Hour).Truncate(time.Second)
+
+			token, err := s.Sign(&Claims{
+				Issuer:    "issuer",
+				Subject:   "subject",
+				Audience:  []string{"api"},
+				ExpiresAt: exp,
+			}, &custom{Scope: "read", Roles: []string{"admin"}})
+			require.NoError(t, err)
+
+			assert.Equal(t, map[string]interface{}{"alg": alg, "kid": "key-1", "typ": "JWT"}, header(t, token))
+
+			claims, extra, err := Verify(token, &VerifyOptions{Keys: keys, Algorithms: []string{alg}, Issuer: "issuer", Audience: []string{"api"}})
+			require.NoError(t, err)
+			assert.Equal(t, "subject", claims.Subject)
+			assert.True(t, exp.Equal(claims.ExpiresAt))
+			assert.False(t, claims.IssuedAt.IsZero())
+			assert.Len(t, claims.JTI, 32)
+			assert.Equal(t, map[string]interface{}{"scope": "read", "roles": []interface{}{"admin"}}, extra)
+		})
+	}
+
+	t.Run("case=generates unique token ids", func(t *testing.T) {
+		s, keys := newSigner(t, "ES256")
+		opts := &VerifyOptions{Keys: keys, Algorithms: []string{"ES256"}, AllowMissingExpiry: true}
+
+		first, err := s.Sign(nil, nil)
+		require.NoError(t, err)
+		second, err := s.Sign(nil, nil)
+		require.NoError(t, err)
+
+		a, _, err := Verify(first, opts)
+		require.NoError(t, err)
+		b, _, err := Verify(second, opts)
+		require.NoError(t, err)
+		assert.NotEqual(t, a.JTI, b.JTI)
+	})
+
+	t.Run("case=keeps explicit iat and jti", func(t *testing.T) {
+		s, keys := newSigner(t, "ES256")
+		iat := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+		token, err := s.Sign(&Claims{IssuedAt: iat, JTI: "my-id"}, map[string]interface{}{"foo": "bar"})
+		require.NoError(t, err)
+
+		claims, _, err := Verify(token, &VerifyOptions{Keys: keys, Algorithms: []string{"ES256"}, AllowMissingExpiry: true})
+		require.NoError(t, err)
+		assert.True(t, iat.Equal(claims.IssuedAt))
+		assert.Equal(t, "my-id", claims.JTI)
+	})
+
+	t.Run("case=sets the type header", func(t *testing.T) {
+		s, _ := newSigner(t, "ES256", SignerWithType("at+jwt"))
+		token, err := s.Sign(nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "at+jwt", header(t, token)["typ"])
+	})
+
+	t.Run("case=rejects invalid custom claims", func(t *testing.T) {
+		s, _ := newSigner(t, "ES256")
+
+		_, err := s.Sign(nil, map[string]interface{}{"sub": "overwritten"})
+		require.Error(t, err)
+
+		_, err = s.Sign(nil, []string{"not", "an", "object"})
+		require.Error(t, err)
+	})
+
+	t.Run("case=rejects invalid keys", func(t *testing.T) {
+		set, err := jwksx.GenerateSigningKeys("", "ES256", 0)
+		require.NoError(t, err)
+
+		key := KeyFromV3(set.Keys[0])
+		key.Algorithm = ""
+		_, err = NewSigner(key)
+		require.Error(t, err)
+
+		key = KeyFromV3(set.Keys[0])
+		key.Use = "enc"
+		_, err = NewSigner(key)
+		require.Error(t, err)
+
+		_, err = NewSigner(jose.JSONWebKey{Algorithm: "ES256"})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,233 @@
+package jwtx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/square/go-jose.v2"
+
+	"github.com/ory/x/jwksx"
+	"github.com/ory/x/stringslice"
+)
+
+var (
+	// ErrMalformedToken is returned if the token is not a compact JWS or its payload is not a JSON object.
+	ErrMalformedToken = errors.New("the token is malformed")
+	// ErrAlgorithmNotAllowed is returned if the token is signed with an algorithm that is not in the allow-list.
+	ErrAlgorithmNotAllowed = errors.New("the token is signed with an algorithm that is not allowed")
+	// ErrInvalidSignature is returned if the signing key is unknown or the signature does not match.
+	ErrInvalidSignature = errors.New("the token signature is invalid")
+	// ErrKeySourceUnavailable is returned if the key source failed to resolve the signing key for another reason
+	// than the key being unknown, e.g. because the JSON Web Key Set endpoint is down.
+	ErrKeySourceUnavailable = errors.New("the keys to verify the token could not be retrieved")
+	// ErrInvalidClaim is returned if a registered claim has the wrong type.
+	ErrInvalidClaim = errors.New("the token contains an invalid claim")
+	// ErrTokenExpired is returned if the token's expiry is in the past.
+	ErrTokenExpired = errors.New("the token is expired")
+	// ErrTokenNotYetValid is returned if the token's not before time is in the future.
+	ErrTokenNotYetValid = errors.New("the token is not valid yet")
+	// ErrTokenIssuedInFuture is returned if the token's issued at time is in the future.
+	ErrTokenIssuedInFuture = errors.New("the token was issued in the future")
+	// ErrInvalidIssuer is returned if the token's issuer does not match the expected issuer.
+	ErrInvalidIssuer = errors.New("the token was issued by an unexpected issuer")
+	// ErrInvalidAudience is returned if the token is not intended for any of the expected audiences.
+	ErrInvalidAudience = errors.New("the token is not intended for this audience")
+)
+
+// registeredClaims are the claims that are part of Claims and thus not returned as extra claims.
+var registeredClaims = []string{"aud", "iss", "sub", "exp", "iat", "nbf", "jti"}
+
+type (
+	// KeySource resolves the key used to verify a token by its key ID. *jwksx.Fetcher and *jwksx.MultiFetcher
+	// implement this interface. If the key ID is unknown, the returned error must wrap jwksx.ErrKeyNotFound. All
+	// other errors are treated as the key source being unavailable.
+	KeySource interface {
+		GetKeyCtx(ctx context.Context, kid string) (*jose.JSONWebKey, error)
+	}
+
+	// StaticKeySource resolves keys from a fixed JSON Web Key Set.
+	StaticKeySource jose.JSONWebKeySet
+
+	// VerifyOptions configures Verify.
+	VerifyOptions struct {
+		// Keys resolves the keys used to verify the token signature. Required.
+		Keys KeySource
+
+		// Algorithms is the allow-list of signing algorithms. Tokens signed with other algorithms, including
+		// `none`, are rejected. Required.
+		Algorithms []string
+
+		// Issuer is the expected `iss` claim. If empty, the issuer is not checked.
+		Issuer string
+
+		// Audience lists the accepted audiences. If not empty, the `aud` claim must contain at least one of them.
+		Audience []string
+
+		// Leeway is the clock skew tolerated when validating `exp`, `nbf`, and `iat`.
+		Leeway time.Duration
+
+		// AllowMissingExpiry accepts tokens without an `exp` claim.
+		AllowMissingExpiry bool
+
+		// Now returns the current time. Defaults to time.Now.
+		Now func() time.Time
+	}
+)
+
+var _ KeySource = new(StaticKeySource)
+
+// GetKeyCtx implements KeySource.
+func (s *StaticKeySource) GetKeyCtx(_ context.Context, kid string) (*jose.JSONWebKey, error) {
+	keys := (*jose.JSONWebKeySet)(s).Key(kid)
+	if len(keys) == 0 {
+		return nil, errors.Wrapf(jwksx.ErrKeyNotFound, "unable to find JSON Web Key with ID %s", kid)
+	}
+	return &keys[0], nil
+}
+
+// Verify parses and verifies a compact JWS and validates its claims. It returns the standard claims and all other
+// claims of the token.
+func Verify(token string, opts *VerifyOptions) (*Claims, map[string]interface{}, error) {
+	return VerifyCtx(context.Background(), token, opts)
+}
+
+// VerifyCtx works like Verify but passes the context to the key source.
+func VerifyCtx(ctx context.Context, token string, opts *VerifyOptions) (*Claims, map[string]interface{}, error) {
+	if opts == nil || opts.Keys == nil || len(opts.Algorithms) == 0 {
+		return nil, nil, errors.New("jwtx: verify options must contain a key source and at least one algorithm")
+	}
+
+	// go-jose also parses the JSON serialization which may contain several signatures.
+	if strings.Count(token, ".") != 2 {
+		return nil, nil, errors.Wrap(ErrMalformedToken, "expected a compact JWS")
+	}
+
+	jws, err := jose.ParseSigned(token)
+	if err != nil {
+		return nil, nil, errors.Wrap(ErrMalformedToken, err.Error())
+	}
+	header := jws.Signatures[0].Header
+
+	if !stringslice.Has(opts.Algorithms, header.Algorithm) {
+		return nil, nil, errors.Wrapf(ErrAlgorithmNotAllowed, "algorithm %s is not one of %v", header.Algorithm, opts.Algorithms)
+	}
+
+	key, err := opts.Keys.GetKeyCtx(ctx, header.KeyID)
+	if errors.Is(err, jwksx.ErrKeyNotFound) {
+		return nil, nil, errors.Wrap(ErrInvalidSignature, err.Error())
+	} else if err != nil {
+		return nil, nil, errors.Wrap(ErrKeySourceUnavailable, err.Error())
+	}
+	if key.Algorithm != "" && key.Algorithm != header.Algorithm {
+		return nil, nil, errors.Wrapf(ErrInvalidSignature, "key %s expects algorithm %s but the token uses %s", key.KeyID, key.Algorithm, header.Algorithm)
+	}
+	if key.Use != "" && key.Use != "sig" {
+		return nil, nil, errors.Wrapf(ErrInvalidSignature, "key %s can not be used for signatures", key.KeyID)
+	}
+
+	payload, err := jws.Verify(key)
+	if err != nil {
+		return nil, nil, errors.Wrap(ErrInvalidSignature, err.Error())
+	}
+
+	var raw map[string]interface{}
+	if err := json.NewDecoder(bytes.NewReader(payload)).Decode(&raw); err != nil || raw == nil {
+		return nil, nil, errors.Wrap(ErrMalformedToken, "the payload is not a JSON object")
+	}
+
+	if err := validateClaimTypes(raw); err != nil {
+		return nil, nil, err
+	}
+
+	claims := ParseMapStringInterfaceClaims(raw)
+	if err := opts.validate(claims, raw); err != nil {
+		return nil, nil, err
+	}
+
+	extra := make(map[string]interface{}, len(raw))
+	for k, v := range raw {
+		if !stringslice.Has(registeredClaims, k) {
+			extra[k] = v
+		}
+	}
+
+	return claims, extra, nil
+}
+
+func validateClaimTypes(raw map[string]interface{}) error {
+	for _, name := range []string{"exp", "iat", "nbf"} {
+		if v, ok := raw[name]; ok {
+			if _, ok := v.(float64); !ok {
+				return errors.Wrapf(ErrInvalidClaim, "claim %s must be a number", name)
+			}
+		}
+	}
+
+	for _, name := range []string{"iss", "sub", "jti"} {
+		if v, ok := raw[name]; ok {
+			if _, ok := v.(string); !ok {
+				return errors.Wrapf(ErrInvalidClaim, "claim %s must be a string", name)
+			}
+		}
+	}
+
+	switch aud := raw["aud"].(type) {
+	case nil, string:
+	case []interface{}:
+		for _, v := range aud {
+			if _, ok := v.(string); !ok {
+				return errors.Wrap(ErrInvalidClaim, "claim aud must be a string or an array of strings")
+			}
+		}
+	default:
+		return errors.Wrap(ErrInvalidClaim, "claim aud must be a string or an array of strings")
+	}
+
+	return nil
+}
+
+func (o *VerifyOptions) validate(claims *Claims, raw map[string]interface{}) error {
+	now := time.Now()
+	if o.Now != nil {
+		now = o.Now()
+	}
+
+	if _, ok := raw["exp"]; !ok {
+		if !o.AllowMissingExpiry {
+			return errors.Wrap(ErrInvalidClaim, "claim exp is required")
+		}
+	} else if !now.Before(claims.ExpiresAt.Add(o.Leeway)) {
+		return errors.Wrapf(ErrTokenExpired, "the token expired at %s", claims.ExpiresAt.UTC())
+	}
+
+	if _, ok := raw["nbf"]; ok && now.Add(o.Leeway).Before(claims.NotBefore) {
+		return errors.Wrapf(ErrTokenNotYetValid, "the token is valid from %s", claims.NotBefore.UTC())
+	}
+
+	if _, ok := raw["iat"]; ok && now.Add(o.Leeway).Before(claims.IssuedAt) {
+		return errors.Wrapf(ErrTokenIssuedInFuture, "the token was issued at %s", claims.IssuedAt.UTC())
+	}
+
+	if o.Issuer != "" && claims.Issuer != o.Issuer {
+		return errors.Wrapf(ErrInvalidIssuer, "expected issuer %s but got %s", o.Issuer, claims.Issuer)
+	}
+
+	if len(o.Audience) > 0 {
+		var found bool
+		for _, aud := range claims.Audience {
+			if stringslice.Has(o.Audience, aud) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.Wrapf(ErrInvalidAudience, "expected one of %v but got %v", o.Audience, claims.Audience)
+		}
+	}
+
+	return nil
+}
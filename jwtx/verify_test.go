@@ -0,0 +1,230 @@
+package jwtx
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+
+	"github.com/ory/x/jwksx"
+)
+
+var (
+	_ KeySource = new(jwksx.Fetcher)
+	_ KeySource = new(jwksx.MultiFetcher)
+)
+
+func newTestKey(t *testing.T, kid string) jose.JSONWebKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return jose.JSONWebKey{Key: key, KeyID: kid, Algorithm: "ES256", Use: "sig"}
+}
+
+func publicKey(key jose.JSONWebKey) jose.JSONWebKey {
+	return key.Public()
+}
+
+func newTestToken(t *testing.T, key jose.JSONWebKey, claims map[string]interface{}) string {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.SignatureAlgorithm(key.Algorithm), Key: key}, nil)
+	require.NoError(t, err)
+
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	jws, err := signer.Sign(payload)
+	require.NoError(t, err)
+
+	token, err := jws.CompactSerialize()
+	require.NoError(t, err)
+	return token
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	key := newTestKey(t, "key-1")
+	public := key.Public()
+	keys := &StaticKeySource{Keys: []jose.JSONWebKey{public}}
+
+	newOpts := func() *VerifyOptions {
+		return &VerifyOptions{
+			Keys:       keys,
+			Algorithms: []string{"ES256"},
+			Issuer:     "https://issuer.example.com",
+			Audience:   []string{"api"},
+			Now:        func() time.Time { return now },
+		}
+	}
+
+	newClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   "https://issuer.example.com",
+			"sub":   "subject",
+			"aud":   []string{"api", "other"},
+			"exp":   now.Add(time.Hour).Unix(),
+			"iat":   now.Unix(),
+			"nbf":   now.Unix(),
+			"jti":   "jti",
+			"scope": "read write",
+		}
+	}
+
+	t.Run("case=returns the claims", func(t *testing.T) {
+		claims, extra, err := Verify(newTestToken(t, key, newClaims()), newOpts())
+		require.NoError(t, err)
+
+		assert.Equal(t, &Claims{
+			Audience:  []string{"api", "other"},
+			Issuer:    "https://issuer.example.com",
+			Subject:   "subject",
+			ExpiresAt: time.Unix(now.Add(time.Hour).Unix(), 0),
+			IssuedAt:  time.Unix(now.Unix(), 0),
+			NotBefore: time.Unix(now.Unix(), 0),
+			JTI:       "jti",
+		}, claims)
+		assert.Equal(t, map[string]interface{}{"scope": "read write"}, extra)
+	})
+
+	for k, tc := range []struct {
+		modify   func(claims map[string]interface{}, opts *VerifyOptions)
+		expected error
+	}{
+		{
+			modify:   func(c map[string]interface{}, _ *VerifyOptions) { c["exp"] = now.Unix() },
+			expected: ErrTokenExpired,
+		},
+		{
+			modify: func(c map[string]interface{}, o *VerifyOptions) {
+				c["exp"] = now.Add(-time.Minute).Unix()
+				o.Leeway = time.Minute + time.Second
+			},
+		},
+		{
+			modify:   func(c map[string]interface{}, _ *VerifyOptions) { delete(c, "exp") },
+			expected: ErrInvalidClaim,
+		},
+		{
+			modify: func(c map[string]interface{}, o *VerifyOptions) {
+				delete(c, "exp")
+				o.AllowMissingExpiry = true
+			},
+		},
+		{
+			modify:   func(c map[string]interface{}, _ *VerifyOptions) { c["exp"] = "tomorrow" },
+			expected: ErrInvalidClaim,
+		},
+		{
+			modify:   func(c map[string]interface{}, _ *VerifyOptions) { c["nbf"] = now.Add(time.Minute).Unix() },
+			expected: ErrTokenNotYetValid,
+		},
+		{
+			modify: func(c map[string]interface{}, o *VerifyOptions) {
+				c["nbf"] = now.Add(time.Minute).Unix()
+				o.Leeway = time.Minute
+			},
+		},
+		{
+			modify:   func(c map[string]interface{}, _ *VerifyOptions) { c["iat"] = now.Add(time.Minute).Unix() },
+			expected: ErrTokenIssuedInFuture,
+		},
+		{
+			modify:   func(c map[string]interface{}, _ *VerifyOptions) { c["iss"] = "https://evil.example.com" },
+			expected: ErrInvalidIssuer,
+		},
+		{
+			modify: func(c map[string]interface{}, o *VerifyOptions) {
+				c["iss"] = "https://evil.example.com"
+				o.Issuer = ""
+			},
+		},
+		{
+			modify:   func(c map[string]interface{}, _ *VerifyOptions) { c["aud"] = "other" },
+			expected: ErrInvalidAudience,
+		},
+		{
+			modify: func(c map[string]interface{}, _ *VerifyOptions) { c["aud"] = "api" },
+		},
+		{
+			modify:   func(c map[string]interface{}, _ *VerifyOptions) { c["aud"] = []interface{}{"api", 1} },
+			expected: ErrInvalidClaim,
+		},
+		{
+			modify:   func(_ map[string]interface{}, o *VerifyOptions) { o.Algorithms = []string{"RS256"} },
+			expected: ErrAlgorithmNotAllowed,
+		},
+		{
+			modify: func(_ map[string]interface{}, o *VerifyOptions) {
+				o.Keys = &StaticKeySource{Keys: []jose.JSONWebKey{publicKey(newTestKey(t, "key-1"))}}
+			},
+			expected: ErrInvalidSignature,
+		},
+		{
+			modify: func(_ map[string]interface{}, o *VerifyOptions) {
+				o.Keys = &StaticKeySource{Keys: []jose.JSONWebKey{publicKey(newTestKey(t, "key-2"))}}
+			},
+			expected: ErrInvalidSignature,
+		},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			claims, opts := newClaims(), newOpts()
+			tc.modify(claims, opts)
+
+			_, _, err := Verify(newTestToken(t, key, claims), opts)
+			if tc.expected == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, tc.expected), "%+v", err)
+		})
+	}
+
+	t.Run("case=rejects unsigned tokens", func(t *testing.T) {
+		// {"alg":"none"}.{"sub":"subject"}.
+		_, _, err := Verify("eyJhbGciOiJub25lIn0.eyJzdWIiOiJzdWJqZWN0In0.", newOpts())
+		require.Error(t, err)
+	})
+
+	t.Run("case=rejects keys with another algorithm", func(t *testing.T) {
+		other := public
+		other.Algorithm = "ES384"
+		opts := newOpts()
+		opts.Keys = &StaticKeySource{Keys: []jose.JSONWebKey{other}}
+
+		_, _, err := Verify(newTestToken(t, key, newClaims()), opts)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrInvalidSignature), "%+v", err)
+	})
+
+	t.Run("case=distinguishes unavailable key sources from unknown keys", func(t *testing.T) {
+		opts := newOpts()
+		opts.Keys = failingKeySource{}
+
+		_, _, err := Verify(newTestToken(t, key, newClaims()), opts)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrKeySourceUnavailable), "%+v", err)
+		assert.False(t, errors.Is(err, ErrInvalidSignature), "%+v", err)
+	})
+
+	t.Run("case=rejects malformed tokens", func(t *testing.T) {
+		for _, token := range []string{"", "foo", "a.b.c", `{"payload":"","signatures":[]}`} {
+			_, _, err := Verify(token, newOpts())
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, ErrMalformedToken), "%s: %+v", token, err)
+		}
+	})
+
+	t.Run("case=requires keys and algorithms", func(t *testing.T) {
+		_, _, err := Verify(newTestToken(t, key, newClaims()), &VerifyOptions{Keys: keys})
+		require.Error(t, err)
+		_, _, err = Verify(newTestToken(t, key, newClaims()), nil)
+		require.Error(t, err)
+	})
+}
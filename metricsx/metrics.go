@@ -23,6 +23,8 @@ package metricsx
 import (
 	"runtime"
 	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // MemoryStatistics is a JSON-able version of runtime.MemStats
@@ -99,3 +101,72 @@ func (ms *MemoryStatistics) Update() {
 	ms.HeapObjects = m.HeapObjects
 	ms.NumGC = m.NumGC
 }
+
+type memoryStatisticsMetric struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	value     func(ms *MemoryStatistics) float64
+}
+
+type memoryStatisticsCollector struct {
+	ms      *MemoryStatistics
+	metrics []memoryStatisticsMetric
+}
+
+// NewMemoryStatisticsCollector returns a prometheus.Collector which exports the MemoryStatistics. Cumulative values
+// are exported as counters, all others as gauges. The statistics are updated whenever the metrics are collected.
+//
+// prometheus.NewGoCollector exports the same values as go_memstats_*, so only register this collector with
+// registries which do not contain the Go collector.
+func NewMemoryStatisticsCollector(namespace string) prometheus.Collector {
+	metric := func(valueType prometheus.ValueType, name, help string, value func(ms *MemoryStatistics) float64) memoryStatisticsMetric {
+		return memoryStatisticsMetric{
+			desc:      prometheus.NewDesc(prometheus.BuildFQName(namespace, "memory", name), help, nil, nil),
+			valueType: valueType,
+			value:     value,
+		}
+	}
+	gauge := func(name, help string, value func(ms *MemoryStatistics) float64) memoryStatisticsMetric {
+		return metric(prometheus.GaugeValue, name, help, value)
+	}
+	counter := func(name, help string, value func(ms *MemoryStatistics) float64) memoryStatisticsMetric {
+		return metric(prometheus.CounterValue, name, help, value)
+	}
+
+	return &memoryStatisticsCollector{
+		ms: new(MemoryStatistics),
+		metrics: []memoryStatisticsMetric{
+			gauge("alloc_bytes", "Bytes of allocated heap objects.", func(ms *MemoryStatistics) float64 { return float64(ms.Alloc) }),
+			counter("alloc_bytes_total", "Cumulative bytes allocated for heap objects.", func(ms *MemoryStatistics) float64 { return float64(ms.TotalAlloc) }),
+			gauge("sys_bytes", "Total bytes of memory obtained from the OS.", func(ms *MemoryStatistics) float64 { return float64(ms.Sys) }),
+			counter("lookups_total", "Number of pointer lookups performed by the runtime.", func(ms *MemoryStatistics) float64 { return float64(ms.Lookups) }),
+			counter("mallocs_total", "Cumulative count of heap objects allocated.", func(ms *MemoryStatistics) float64 { return float64(ms.Mallocs) }),
+			counter("frees_total", "Cumulative count of heap objects freed.", func(ms *MemoryStatistics) float64 { return float64(ms.Frees) }),
+			gauge("heap_alloc_bytes", "Bytes of allocated heap objects.", func(ms *MemoryStatistics) float64 { return float64(ms.HeapAlloc) }),
+			gauge("heap_sys_bytes", "Bytes of heap memory obtained from the OS.", func(ms *MemoryStatistics) float64 { return float64(ms.HeapSys) }),
+			gauge("heap_idle_bytes", "Bytes in idle (unused) spans.", func(ms *MemoryStatistics) float64 { return float64(ms.HeapIdle) }),
+			gauge("heap_inuse_bytes", "Bytes in in-use spans.", func(ms *MemoryStatistics) float64 { return float64(ms.HeapInuse) }),
+			gauge("heap_released_bytes", "Bytes of physical memory returned to the OS.", func(ms *MemoryStatistics) float64 { return float64(ms.HeapReleased) }),
+			gauge("heap_objects", "Number of allocated heap objects.", func(ms *MemoryStatistics) float64 { return float64(ms.HeapObjects) }),
+			counter("gc_cycles_total", "Number of completed GC cycles.", func(ms *MemoryStatistics) float64 { return float64(ms.NumGC) }),
+		},
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *memoryStatisticsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range c.metrics {
+		ch <- m.desc
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *memoryStatisticsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.ms.Update()
+
+	c.ms.Lock()
+	defer c.ms.Unlock()
+	for _, m := range c.metrics {
+		ch <- prometheus.MustNewConstMetric(m.desc, m.valueType, m.value(c.ms))
+	}
+}
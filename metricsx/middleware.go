@@ -21,12 +21,14 @@
 package metricsx
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"runtime"
 	"strings"
 	"sync"
@@ -41,11 +43,15 @@ import (
 	"github.com/ory/x/resilience"
 
 	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
 	"github.com/urfave/negroni"
 
 	analytics "github.com/ory/analytics-go/v4"
 )
 
+// DoNotTrackEnv is the environment variable which disables all telemetry if set.
+const DoNotTrackEnv = "DO_NOT_TRACK"
+
 var instance *Service
 var lock sync.Mutex
 
@@ -57,10 +63,13 @@ type Service struct {
 	o       *Options
 	context *analytics.Context
 
-	c analytics.Client
+	c Sink
 	l *logrusx.Logger
 
 	mem *MemoryStatistics
+
+	quit     chan struct{}
+	quitOnce sync.Once
 }
 
 // Hash returns a hashed string of the value.
@@ -99,9 +108,19 @@ type Options struct {
 	// BuildTime represents the build time.
 	BuildTime string
 
-	// Config overrides the analytics.Config. If nil, sensible defaults will be used.
+	// Config overrides the analytics.Config. If nil, sensible defaults will be used. It is ignored if Sink is set.
 	Config *analytics.Config
 
+	// Sink receives the telemetry messages. If nil, the messages are sent to Segment using WriteKey and Config.
+	Sink Sink
+
+	// OptOut disables the collection of telemetry data. Only the fact that the service opted out is reported.
+	OptOut bool
+
+	// Isolated creates an independent instance instead of returning the one which was instantiated first. Use it in
+	// tests or binaries running several services.
+	Isolated bool
+
 	// MemoryInterval sets how often memory statistics should be transmitted. Defaults to every 12 hours.
 	MemoryInterval time.Duration
 }
@@ -115,18 +134,55 @@ func (v *void) Logf(format string, args ...interface{}) {
 func (v *void) Errorf(format string, args ...interface{}) {
 }
 
-// New returns a new metrics service. If one has been instantiated already, no new instance will be created.
+// New returns a new metrics service for cobra commands. The service is disabled if the "sqa-opt-out" flag or the
+// "sqa.opt_out" configuration key is set. It exits the process if the service can not be initialized, use
+// NewService in libraries.
 func New(
 	cmd *cobra.Command,
 	l *logrusx.Logger,
 	c *configx.Provider,
 	o *Options,
 ) *Service {
+	optOut, err := cmd.Flags().GetBool("sqa-opt-out")
+	if err != nil {
+		cmdx.Must(err, `Unable to get command line flag "sqa-opt-out": %s`, err)
+	}
+
+	if !optOut {
+		optOut = c.Bool("sqa.opt_out")
+	}
+	o.OptOut = o.OptOut || optOut
+
+	m, err := NewService(l, o)
+	if err != nil {
+		l.WithError(err).Fatalf("Unable to initialise software quality assurance features.")
+		return nil
+	}
+	return m
+}
+
+// DoNotTrack returns true if the DO_NOT_TRACK environment variable is set, see https://consoledonottrack.com.
+func DoNotTrack() bool {
+	v := strings.TrimSpace(os.Getenv(DoNotTrackEnv))
+	return v != "" && v != "0" && !strings.EqualFold(v, "false")
+}
+
+// NewService returns a new metrics service. If one has been instantiated already, no new instance will be created
+// unless Options.Isolated is true.
+//
+// If DoNotTrack returns true, no telemetry is sent at all and Options.Sink is ignored.
+func NewService(l *logrusx.Logger, o *Options) (*Service, error) {
+	if l == nil {
+		return nil, errors.New("the logger must not be nil")
+	} else if o == nil {
+		return nil, errors.New("the options must not be nil")
+	}
+
 	lock.Lock()
 	defer lock.Unlock()
 
-	if instance != nil {
-		return instance
+	if instance != nil && !o.Isolated {
+		return instance, nil
 	}
 
 	if o.BuildTime == "" {
@@ -141,35 +197,24 @@ func New(
 		o.BuildHash = "unknown"
 	}
 
-	if o.Config == nil {
-		o.Config = &analytics.Config{
-			Interval: time.Hour * 24,
-		}
-	}
-
-	o.Config.Logger = new(void)
-
 	if o.MemoryInterval < time.Minute {
 		o.MemoryInterval = time.Hour * 12
 	}
 
-	segment, err := analytics.NewWithConfig(o.WriteKey, *o.Config)
-	if err != nil {
-		l.WithError(err).Fatalf("Unable to initialise software quality assurance features.")
-		return nil
+	optOut := o.OptOut
+	sink := o.Sink
+	if DoNotTrack() {
+		optOut = true
+		sink = NoopSink{}
+	} else if sink == nil {
+		var err error
+		sink, err = NewSegmentSink(o.WriteKey, o.Config)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	var oi analytics.OSInfo
-
-	optOut, err := cmd.Flags().GetBool("sqa-opt-out")
-	if err != nil {
-		cmdx.Must(err, `Unable to get command line flag "sqa-opt-out": %s`, err)
-	}
-
-	if !optOut {
-		optOut = c.Bool("sqa.opt_out")
-	}
-
 	if !optOut {
 		l.Info("Software quality assurance features are enabled. Learn more at: https://www.ory.sh/docs/ecosystem/sqa")
 		oi = analytics.OSInfo{
@@ -181,9 +226,10 @@ func New(
 		optOut: optOut,
 		salt:   uuid.New(),
 		o:      o,
-		c:      segment,
+		c:      sink,
 		l:      l,
 		mem:    new(MemoryStatistics),
+		quit:   make(chan struct{}),
 		context: &analytics.Context{
 			IP: net.IPv4(0, 0, 0, 0),
 			App: analytics.AppInfo{
@@ -200,17 +246,22 @@ func New(
 		},
 	}
 
-	instance = m
+	if !o.Isolated {
+		instance = m
+	}
 
 	go m.Identify()
 	go m.ObserveMemory()
 
-	return m
+	return m, nil
 }
 
 // Identify enables reporting to segment.
 func (sw *Service) Identify() {
 	if err := resilience.Retry(sw.l, time.Minute*5, time.Hour*24*30, func() error {
+		if sw.stopped() {
+			return nil
+		}
 		return sw.c.Enqueue(analytics.Identify{
 			UserId:  sw.o.ClusterID,
 			Traits:  sw.context.Traits,
@@ -227,7 +278,7 @@ func (sw *Service) ObserveMemory() {
 		return
 	}
 
-	for {
+	for !sw.stopped() {
 		sw.mem.Update()
 		if err := sw.c.Enqueue(analytics.Track{
 			UserId:     sw.o.ClusterID,
@@ -237,7 +288,12 @@ func (sw *Service) ObserveMemory() {
 		}); err != nil {
 			sw.l.WithError(err).Debug("Could not commit anonymized telemetry data")
 		}
-		time.Sleep(sw.o.MemoryInterval)
+
+		select {
+		case <-sw.quit:
+			return
+		case <-time.After(sw.o.MemoryInterval):
+		}
 	}
 }
 
@@ -250,7 +306,7 @@ func (sw *Service) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.
 
 	next(rw, r)
 
-	if sw.optOut {
+	if sw.optOut || sw.stopped() {
 		return
 	}
 
@@ -288,24 +344,76 @@ func (sw *Service) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.
 	}
 }
 
+// Flush stops collecting telemetry data and delivers the queued messages. It returns when the messages were
+// delivered or the context is done, whichever happens first, so shutdown never blocks on network calls. The
+// service can not be used afterwards, and NewService returns a new one.
+func (sw *Service) Flush(ctx context.Context) error {
+	sw.stop()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sw.c.Close()
+	}()
+
+	select {
+	case err := <-done:
+		return errors.WithStack(err)
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "unable to deliver the queued telemetry data in time")
+	}
+}
+
+// Close stops collecting telemetry data and blocks until the queued messages were delivered. Use Flush to limit
+// the time it may take.
 func (sw *Service) Close() error {
+	sw.stop()
 	return sw.c.Close()
 }
 
+// stop stops the service and removes it from the singleton so that NewService creates a working one again.
+func (sw *Service) stop() {
+	sw.quitOnce.Do(func() {
+		close(sw.quit)
+	})
+
+	lock.Lock()
+	defer lock.Unlock()
+	if instance == sw {
+		instance = nil
+	}
+}
+
+func (sw *Service) stopped() bool {
+	select {
+	case <-sw.quit:
+		return true
+	default:
+		return false
+	}
+}
+
 func (sw *Service) anonymizePath(path string, salt string) string {
-	paths := sw.o.WhitelistedPaths
 	path = strings.ToLower(path)
+	p, exact, ok := matchWhitelistedPath(sw.o.WhitelistedPaths, path)
+	if !ok {
+		return "/"
+	} else if exact {
+		return p
+	}
+	return p + "/" + Hash(path[len(p):]+"|"+salt)
+}
 
+// matchWhitelistedPath returns the longest whitelisted path which is equal to or a parent of the lower cased path.
+func matchWhitelistedPath(paths []string, path string) (match string, exact bool, ok bool) {
 	for _, p := range paths {
 		p = strings.ToLower(p)
-		if len(path) == len(p) && path[:len(p)] == strings.ToLower(p) {
-			return p
-		} else if len(path) > len(p) && path[:len(p)+1] == strings.ToLower(p)+"/" {
-			return path[:len(p)] + "/" + Hash(path[len(p):]+"|"+salt)
+		if len(path) == len(p) && path == p {
+			return p, true, true
+		} else if len(path) > len(p) && path[:len(p)+1] == p+"/" && (!ok || len(p) > len(match)) {
+			match, ok = p, true
 		}
 	}
-
-	return "/"
+	return match, false, ok
 }
 
 func (sw *Service) anonymizeQuery(query url.Values, salt string) string {
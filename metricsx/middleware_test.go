@@ -21,10 +21,22 @@
 package metricsx
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/negroni"
+
+	analytics "github.com/ory/analytics-go/v4"
+
+	"github.com/ory/x/logrusx"
 )
 
 func TestAnonymizePath(t *testing.T) {
@@ -51,3 +63,125 @@ func TestAnonymizeQuery(t *testing.T) {
 	}, "somesupersaltysalt"))
 	assert.EqualValues(t, "", m.anonymizeQuery(url.Values{}, "somesupersaltysalt"))
 }
+
+type recordingSink struct {
+	msgs  chan analytics.Message
+	block chan struct{}
+}
+
+func newRecordingSink() *recordingSink {
+	return &recordingSink{msgs: make(chan analytics.Message, 10), block: make(chan struct{})}
+}
+
+func (s *recordingSink) Enqueue(msg analytics.Message) error {
+	s.msgs <- msg
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	<-s.block
+	return nil
+}
+
+func TestNewService(t *testing.T) {
+	l := logrusx.New("", "")
+
+	t.Run("case=returns errors instead of exiting", func(t *testing.T) {
+		_, err := NewService(l, nil)
+		require.Error(t, err)
+		_, err = NewService(nil, &Options{})
+		require.Error(t, err)
+	})
+
+	t.Run("case=reports usage unless opted out", func(t *testing.T) {
+		sink := newRecordingSink()
+		s, err := NewService(l, &Options{ClusterID: "cluster", Sink: sink, Isolated: true})
+		require.NoError(t, err)
+		defer func() {
+			close(sink.block)
+			require.NoError(t, s.Flush(context.Background()))
+		}()
+
+		events := map[string]bool{}
+		for i := 0; i < 2; i++ {
+			switch m := (<-sink.msgs).(type) {
+			case analytics.Identify:
+				events["identify"] = true
+				assert.Equal(t, false, m.Traits["optedOut"])
+			case analytics.Track:
+				events[m.Event] = true
+			}
+		}
+		assert.Equal(t, map[string]bool{"identify": true, "memstats": true}, events)
+	})
+
+	t.Run("case=only reports the opt out", func(t *testing.T) {
+		sink := newRecordingSink()
+		s, err := NewService(l, &Options{ClusterID: "cluster", Sink: sink, OptOut: true, Isolated: true})
+		require.NoError(t, err)
+		defer func() {
+			close(sink.block)
+			require.NoError(t, s.Flush(context.Background()))
+		}()
+
+		m, ok := (<-sink.msgs).(analytics.Identify)
+		require.True(t, ok)
+		assert.Equal(t, true, m.Traits["optedOut"])
+	})
+
+	t.Run("case=honors DO_NOT_TRACK", func(t *testing.T) {
+		require.NoError(t, os.Setenv(DoNotTrackEnv, "1"))
+		defer os.Unsetenv(DoNotTrackEnv)
+
+		sink := newRecordingSink()
+		s, err := NewService(l, &Options{ClusterID: "cluster", Sink: sink, Isolated: true})
+		require.NoError(t, err)
+		require.NoError(t, s.Flush(context.Background()))
+		assert.Len(t, sink.msgs, 0)
+	})
+
+	t.Run("case=flush does not block past the deadline", func(t *testing.T) {
+		sink := newRecordingSink()
+		s, err := NewService(l, &Options{ClusterID: "cluster", Sink: sink, OptOut: true, Isolated: true})
+		require.NoError(t, err)
+		defer close(sink.block)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err = s.Flush(ctx)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	})
+
+	t.Run("case=stopped services are not reused or fed", func(t *testing.T) {
+		sink := newRecordingSink()
+		close(sink.block)
+
+		s, err := NewService(l, &Options{ClusterID: "cluster", Sink: sink})
+		require.NoError(t, err)
+		same, err := NewService(l, &Options{ClusterID: "cluster", Sink: sink})
+		require.NoError(t, err)
+		assert.Same(t, s, same)
+
+		// identify and memstats
+		<-sink.msgs
+		<-sink.msgs
+		require.NoError(t, s.Flush(context.Background()))
+
+		s.ServeHTTP(negroni.NewResponseWriter(httptest.NewRecorder()), httptest.NewRequest("GET", "/", nil), func(http.ResponseWriter, *http.Request) {})
+		assert.Len(t, sink.msgs, 0)
+
+		other, err := NewService(l, &Options{ClusterID: "cluster", Sink: sink, OptOut: true})
+		require.NoError(t, err)
+		assert.NotSame(t, s, other)
+		require.NoError(t, other.Close())
+	})
+}
+
+func TestDoNotTrack(t *testing.T) {
+	defer os.Unsetenv(DoNotTrackEnv)
+	for v, expected := range map[string]bool{"": false, "0": false, "false": false, "1": true, "true": true} {
+		require.NoError(t, os.Setenv(DoNotTrackEnv, v))
+		assert.Equal(t, expected, DoNotTrack(), "%q", v)
+	}
+}
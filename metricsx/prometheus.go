@@ -0,0 +1,242 @@
+package metricsx
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/urfave/negroni"
+)
+
+// MetricsPath is the path the Prometheus metrics are exposed on.
+const MetricsPath = "/metrics"
+
+const (
+	// UnmatchedRoute is the route label of requests whose path is not whitelisted.
+	UnmatchedRoute = "unmatched"
+	// OtherMethod is the method label of requests with a non-standard HTTP method.
+	OtherMethod = "OTHER"
+)
+
+var (
+	// DefaultDurationBuckets are the buckets of the request duration histogram in seconds.
+	DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	knownMethods = map[string]bool{
+		http.MethodGet:     true,
+		http.MethodHead:    true,
+		http.MethodPost:    true,
+		http.MethodPut:     true,
+		http.MethodPatch:   true,
+		http.MethodDelete:  true,
+		http.MethodConnect: true,
+		http.MethodOptions: true,
+		http.MethodTrace:   true,
+	}
+
+	invalidMetricNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+// RouteTemplateFunc returns the route template of a request, for example "/clients/:id". The result is used as a
+// label value and must therefore have a low cardinality.
+type RouteTemplateFunc func(r *http.Request) string
+
+// PrometheusOption configures the PrometheusMiddleware.
+type PrometheusOption func(*PrometheusMiddleware)
+
+// PrometheusWithRegistry sets the registry the metrics are registered with and exposed from. Defaults to a new
+// registry which also contains the Go runtime and process collectors.
+func PrometheusWithRegistry(r *prometheus.Registry) PrometheusOption {
+	return func(m *PrometheusMiddleware) {
+		m.registry = r
+	}
+}
+
+// PrometheusWithMemoryStatistics also exports the MemoryStatistics, see NewMemoryStatisticsCollector. Only use it
+// together with PrometheusWithRegistry, because the default registry already exports them as go_memstats_*.
+func PrometheusWithMemoryStatistics() PrometheusOption {
+	return func(m *PrometheusMiddleware) {
+		m.memoryStatistics = true
+	}
+}
+
+// PrometheusWithDurationBuckets sets the buckets of the request duration histogram. Defaults to DefaultDurationBuckets.
+func PrometheusWithDurationBuckets(buckets []float64) PrometheusOption {
+	return func(m *PrometheusMiddleware) {
+		m.buckets = buckets
+	}
+}
+
+// PrometheusWithRouteTemplate sets the function which computes the route label. Defaults to the whitelisted path
+// matching the request, see Options.WhitelistedPaths.
+func PrometheusWithRouteTemplate(f RouteTemplateFunc) PrometheusOption {
+	return func(m *PrometheusMiddleware) {
+		m.route = f
+	}
+}
+
+// PrometheusMiddleware is a negroni middleware which records Prometheus metrics of the HTTP requests.
+type PrometheusMiddleware struct {
+	o        *Options
+	registry *prometheus.Registry
+	buckets  []float64
+	route    RouteTemplateFunc
+
+	memoryStatistics bool
+
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight *prometheus.GaugeVec
+}
+
+// NewPrometheusMiddleware returns a middleware which records the request count, duration and the number of
+// requests in flight, labeled by method, status class and route template. The metric names are prefixed with the
+// service name, for example "ory_hydra_http_requests_total".
+//
+// To protect Prometheus from unbounded label cardinality, only paths in Options.WhitelistedPaths are used as route
+// label. Sub paths of a whitelisted path are recorded as "<path>/*", all other paths as UnmatchedRoute.
+func NewPrometheusMiddleware(o *Options, opts ...PrometheusOption) *PrometheusMiddleware {
+	m := &PrometheusMiddleware{
+		o:       o,
+		buckets: DefaultDurationBuckets,
+	}
+	m.route = m.whitelistedRoute
+
+	for _, f := range opts {
+		f(m)
+	}
+
+	if m.registry == nil {
+		m.registry = prometheus.NewRegistry()
+		m.registry.MustRegister(
+			prometheus.NewGoCollector(),
+			prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		)
+	}
+
+	namespace := MetricNamespace(o.Service)
+	m.requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Total number of HTTP requests.",
+	}, []string{"method", "code", "route"})
+	m.duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of HTTP requests in seconds.",
+		Buckets:   m.buckets,
+	}, []string{"method", "code", "route"})
+	m.inFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_in_flight",
+		Help:      "Number of HTTP requests currently being served.",
+	}, []string{"method", "route"})
+	buildInfo := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "build_info",
+		Help:      "Build information of the running binary, the value is always 1.",
+	}, []string{"version", "hash", "time"})
+	buildInfo.WithLabelValues(unknownIfEmpty(o.BuildVersion), unknownIfEmpty(o.BuildHash), unknownIfEmpty(o.BuildTime)).Set(1)
+
+	m.registry.MustRegister(
+		m.requests,
+		m.duration,
+		m.inFlight,
+		buildInfo,
+	)
+	if m.memoryStatistics {
+		m.registry.MustRegister(NewMemoryStatisticsCollector(namespace))
+	}
+
+	return m
+}
+
+// ServeHTTP records the metrics of the request.
+func (m *PrometheusMiddleware) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	method := normalizeMethod(r.Method)
+	route := m.route(r)
+
+	inFlight := m.inFlight.WithLabelValues(method, route)
+	inFlight.Inc()
+	defer inFlight.Dec()
+
+	res, ok := rw.(negroni.ResponseWriter)
+	if !ok {
+		res = negroni.NewResponseWriter(rw)
+	}
+
+	start := time.Now()
+	next(res, r)
+
+	code := statusClass(res.Status())
+	m.requests.WithLabelValues(method, code, route).Inc()
+	m.duration.WithLabelValues(method, code, route).Observe(time.Since(start).Seconds())
+}
+
+// Registry returns the registry the metrics are registered with. Use it to register additional collectors.
+func (m *PrometheusMiddleware) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// MetricsHandler returns a handler which exposes the metrics in the Prometheus text format.
+func (m *PrometheusMiddleware) MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// SetRoutes registers the metrics handler at MetricsPath.
+func (m *PrometheusMiddleware) SetRoutes(r *httprouter.Router) {
+	r.Handler("GET", MetricsPath, m.MetricsHandler())
+}
+
+func (m *PrometheusMiddleware) whitelistedRoute(r *http.Request) string {
+	p, exact, ok := matchWhitelistedPath(m.o.WhitelistedPaths, strings.ToLower(r.URL.Path))
+	if !ok {
+		return UnmatchedRoute
+	} else if exact {
+		return p
+	}
+	return p + "/*"
+}
+
+// MetricNamespace converts the service name, for example "ory-hydra", to a valid Prometheus metric namespace.
+// Metric names must not start with a digit, so names like "1password" are prefixed with an underscore.
+func MetricNamespace(service string) string {
+	namespace := invalidMetricNameChars.ReplaceAllString(service, "_")
+	if namespace != "" && namespace[0] >= '0' && namespace[0] <= '9' {
+		return "_" + namespace
+	}
+	return namespace
+}
+
+func normalizeMethod(method string) string {
+	if knownMethods[method] {
+		return method
+	}
+	return OtherMethod
+}
+
+// statusClass returns the status class, e.g. "2xx". Handlers which do not write a status respond with 200.
+func statusClass(status int) string {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+func unknownIfEmpty(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
@@ -0,0 +1,150 @@
+package metricsx
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/negroni"
+)
+
+func TestPrometheusMiddleware(t *testing.T) {
+	m := NewPrometheusMiddleware(&Options{
+		Service:          "ory-test",
+		WhitelistedPaths: []string{"/clients"},
+		BuildVersion:     "v1.0.0",
+	})
+
+	router := httprouter.New()
+	router.GET("/clients", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {})
+	router.GET("/clients/:id", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	m.SetRoutes(router)
+
+	n := negroni.New(m)
+	n.UseHandler(router)
+	ts := httptest.NewServer(n)
+	t.Cleanup(ts.Close)
+
+	get := func(t *testing.T, path string) string {
+		res, err := ts.Client().Get(ts.URL + path)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	for _, path := range []string{"/clients", "/CLIENTS", "/clients/foo", "/clients/bar", "/secret/foo"} {
+		get(t, path)
+	}
+
+	t.Run("case=labels requests by method, status class and route", func(t *testing.T) {
+		// httprouter redirects "/CLIENTS" to "/clients".
+		assert.Equal(t, 1.0, testutil.ToFloat64(m.requests.WithLabelValues("GET", "3xx", "/clients")))
+		assert.Equal(t, 2.0, testutil.ToFloat64(m.requests.WithLabelValues("GET", "2xx", "/clients")))
+		assert.Equal(t, 2.0, testutil.ToFloat64(m.requests.WithLabelValues("GET", "4xx", "/clients/*")))
+		assert.Equal(t, 1.0, testutil.ToFloat64(m.requests.WithLabelValues("GET", "4xx", UnmatchedRoute)))
+	})
+
+	t.Run("case=does not leak paths into labels", func(t *testing.T) {
+		assert.Equal(t, 4, testutil.CollectAndCount(m.requests))
+	})
+
+	t.Run("case=no requests are in flight", func(t *testing.T) {
+		assert.Equal(t, 0.0, testutil.ToFloat64(m.inFlight.WithLabelValues("GET", "/clients")))
+	})
+
+	t.Run("case=exposes metrics", func(t *testing.T) {
+		body := get(t, MetricsPath)
+		assert.Contains(t, body, `ory_test_http_requests_total{code="2xx",method="GET",route="/clients"} 2`)
+		assert.Contains(t, body, `ory_test_http_request_duration_seconds_bucket`)
+		assert.Contains(t, body, `ory_test_build_info{hash="unknown",time="unknown",version="v1.0.0"} 1`)
+		assert.Contains(t, body, `go_goroutines`)
+		assert.Contains(t, body, `go_memstats_heap_alloc_bytes`)
+		assert.NotContains(t, body, `ory_test_memory_heap_alloc_bytes`, "the Go collector already exports the memory statistics")
+	})
+}
+
+func TestMetricNamespace(t *testing.T) {
+	for service, expected := range map[string]string{
+		"ory-hydra":  "ory_hydra",
+		"ory.kratos": "ory_kratos",
+		"1password":  "_1password",
+		"":           "",
+	} {
+		assert.Equal(t, expected, MetricNamespace(service), "%s", service)
+	}
+
+	t.Run("case=registers metrics of services starting with a digit", func(t *testing.T) {
+		assert.NotPanics(t, func() {
+			NewPrometheusMiddleware(&Options{Service: "1password"})
+		})
+	})
+}
+
+func TestStatusClass(t *testing.T) {
+	for status, expected := range map[int]string{
+		0:   "2xx",
+		200: "2xx",
+		301: "3xx",
+		404: "4xx",
+		503: "5xx",
+		999: "unknown",
+	} {
+		assert.Equal(t, expected, statusClass(status), "%d", status)
+	}
+}
+
+func TestNormalizeMethod(t *testing.T) {
+	assert.Equal(t, "GET", normalizeMethod("GET"))
+	assert.Equal(t, OtherMethod, normalizeMethod("FOOBAR"))
+}
+
+func TestMemoryStatisticsCollector(t *testing.T) {
+	assert.Equal(t, 13, testutil.CollectAndCount(NewMemoryStatisticsCollector("test")))
+
+	t.Run("case=exports cumulative values as counters", func(t *testing.T) {
+		registry := prometheus.NewRegistry()
+		NewPrometheusMiddleware(&Options{Service: "test"}, PrometheusWithRegistry(registry), PrometheusWithMemoryStatistics())
+
+		families, err := registry.Gather()
+		require.NoError(t, err)
+
+		types := make(map[string]string)
+		for _, f := range families {
+			types[f.GetName()] = f.GetType().String()
+		}
+		assert.Equal(t, "COUNTER", types["test_memory_alloc_bytes_total"])
+		assert.Equal(t, "COUNTER", types["test_memory_gc_cycles_total"])
+		assert.Equal(t, "GAUGE", types["test_memory_heap_alloc_bytes"])
+	})
+}
+
+func TestMatchWhitelistedPath(t *testing.T) {
+	paths := []string{"/clients", "/clients/tokens", "/Keys"}
+	for k, tc := range []struct {
+		path, match string
+		exact, ok   bool
+	}{
+		{path: "/clients", match: "/clients", exact: true, ok: true},
+		{path: "/clients/foo", match: "/clients", ok: true},
+		{path: "/clients/tokens", match: "/clients/tokens", exact: true, ok: true},
+		{path: "/clients/tokens/foo", match: "/clients/tokens", ok: true},
+		{path: "/keys/foo", match: "/keys", ok: true},
+		{path: "/clientsfoo"},
+		{path: "/"},
+	} {
+		match, exact, ok := matchWhitelistedPath(paths, tc.path)
+		assert.Equal(t, tc.match, match, "%d", k)
+		assert.Equal(t, tc.exact, exact, "%d", k)
+		assert.Equal(t, tc.ok, ok, "%d", k)
+	}
+}
@@ -0,0 +1,347 @@
+package metricsx
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+
+	analytics "github.com/ory/analytics-go/v4"
+)
+
+const (
+	// DefaultHTTPSinkBatchSize is the number of messages the HTTPSink sends in one request.
+	DefaultHTTPSinkBatchSize = 100
+	// DefaultHTTPSinkInterval is the interval in which the HTTPSink sends incomplete batches.
+	DefaultHTTPSinkInterval = time.Minute
+	// DefaultHTTPSinkQueueSize is the number of messages the HTTPSink queues before it drops new ones.
+	DefaultHTTPSinkQueueSize = 1000
+)
+
+var (
+	// ErrSinkClosed is returned when a message is enqueued after the sink was closed.
+	ErrSinkClosed = errors.New("the telemetry sink was already closed")
+	// ErrSinkQueueFull is returned when a message is dropped because the queue of the sink is full.
+	ErrSinkQueueFull = errors.New("the telemetry sink queue is full")
+)
+
+// Sink receives the telemetry messages of the Service. It is implemented by analytics.Client, which sends the
+// messages to Segment.
+type Sink interface {
+	io.Closer
+
+	// Enqueue queues the message for delivery. It must not block on network calls because it is called while
+	// serving HTTP requests.
+	Enqueue(analytics.Message) error
+}
+
+var (
+	_ Sink = analytics.Client(nil)
+	_ Sink = NoopSink{}
+	_ Sink = (*JSONSink)(nil)
+	_ Sink = (*HTTPSink)(nil)
+)
+
+// NewSegmentSink returns a Sink which sends the messages to Segment. If config is nil, the messages are sent once
+// a day.
+func NewSegmentSink(writeKey string, config *analytics.Config) (Sink, error) {
+	c := analytics.Config{Interval: time.Hour * 24}
+	if config != nil {
+		c = *config
+	}
+	c.Logger = new(void)
+
+	segment, err := analytics.NewWithConfig(writeKey, c)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return segment, nil
+}
+
+// NoopSink discards all messages.
+type NoopSink struct{}
+
+// Enqueue discards the message.
+func (NoopSink) Enqueue(analytics.Message) error {
+	return nil
+}
+
+// Close does nothing.
+func (NoopSink) Close() error {
+	return nil
+}
+
+// JSONSink writes every message as a line of JSON.
+type JSONSink struct {
+	l sync.Mutex
+	e *json.Encoder
+}
+
+// NewJSONSink returns a Sink which writes the messages to w.
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{e: json.NewEncoder(w)}
+}
+
+// NewStdoutSink returns a Sink which writes the messages to the standard output.
+func NewStdoutSink() *JSONSink {
+	return NewJSONSink(os.Stdout)
+}
+
+// Enqueue writes the message.
+func (s *JSONSink) Enqueue(msg analytics.Message) error {
+	msg, err := normalizeMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+	return errors.WithStack(s.e.Encode(msg))
+}
+
+// Close does nothing, the writer is owned by the caller.
+func (s *JSONSink) Close() error {
+	return nil
+}
+
+// HTTPSinkOption configures the HTTPSink.
+type HTTPSinkOption func(*HTTPSink)
+
+// HTTPSinkWithClient sets the HTTP client. Defaults to a client with a timeout of ten seconds.
+func HTTPSinkWithClient(c *http.Client) HTTPSinkOption {
+	return func(s *HTTPSink) {
+		s.client = c
+	}
+}
+
+// HTTPSinkWithHeader sets a header which is sent with every request, for example for authorization.
+func HTTPSinkWithHeader(key, value string) HTTPSinkOption {
+	return func(s *HTTPSink) {
+		s.header.Set(key, value)
+	}
+}
+
+// HTTPSinkWithBatchSize sets the maximum number of messages sent in one request. Defaults to DefaultHTTPSinkBatchSize.
+func HTTPSinkWithBatchSize(size int) HTTPSinkOption {
+	return func(s *HTTPSink) {
+		s.batchSize = size
+	}
+}
+
+// HTTPSinkWithInterval sets the interval in which incomplete batches are sent. Defaults to DefaultHTTPSinkInterval.
+func HTTPSinkWithInterval(interval time.Duration) HTTPSinkOption {
+	return func(s *HTTPSink) {
+		s.interval = interval
+	}
+}
+
+// HTTPSinkWithQueueSize sets the number of messages which are queued before new ones are dropped. Defaults to
+// DefaultHTTPSinkQueueSize.
+func HTTPSinkWithQueueSize(size int) HTTPSinkOption {
+	return func(s *HTTPSink) {
+		s.queueSize = size
+	}
+}
+
+// HTTPSinkWithErrorHandler sets a function which is called when a batch could not be delivered. Errors are
+// ignored by default.
+func HTTPSinkWithErrorHandler(f func(error)) HTTPSinkOption {
+	return func(s *HTTPSink) {
+		s.onError = f
+	}
+}
+
+// HTTPSink sends the messages in batches to a generic HTTP collector. Each batch is POSTed as JSON in the format
+// of the Segment batch API: `{"batch": [...messages]}`.
+type HTTPSink struct {
+	endpoint  string
+	client    *http.Client
+	header    http.Header
+	batchSize int
+	interval  time.Duration
+	queueSize int
+	onError   func(error)
+
+	msgs     chan analytics.Message
+	quit     chan struct{}
+	shutdown chan struct{}
+	once     sync.Once
+}
+
+// NewHTTPSink returns a Sink which sends the messages to the endpoint. Call Close to send the queued messages.
+func NewHTTPSink(endpoint string, opts ...HTTPSinkOption) *HTTPSink {
+	s := &HTTPSink{
+		endpoint:  endpoint,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		header:    http.Header{},
+		batchSize: DefaultHTTPSinkBatchSize,
+		interval:  DefaultHTTPSinkInterval,
+		queueSize: DefaultHTTPSinkQueueSize,
+		onError:   func(error) {},
+		quit:      make(chan struct{}),
+		shutdown:  make(chan struct{}),
+	}
+	for _, f := range opts {
+		f(s)
+	}
+
+	s.msgs = make(chan analytics.Message, s.queueSize)
+	go s.loop()
+	return s
+}
+
+// Enqueue queues the message. It returns ErrSinkQueueFull instead of blocking if the queue is full.
+func (s *HTTPSink) Enqueue(msg analytics.Message) error {
+	msg, err := normalizeMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-s.quit:
+		return ErrSinkClosed
+	default:
+	}
+
+	select {
+	case s.msgs <- msg:
+		return nil
+	default:
+		return ErrSinkQueueFull
+	}
+}
+
+// Close sends the queued messages and stops the sink.
+func (s *HTTPSink) Close() error {
+	s.once.Do(func() {
+		close(s.quit)
+	})
+	<-s.shutdown
+	return nil
+}
+
+func (s *HTTPSink) loop() {
+	defer close(s.shutdown)
+
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+
+	batch := make([]analytics.Message, 0, s.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.send(batch); err != nil {
+			s.onError(err)
+		}
+		batch = make([]analytics.Message, 0, s.batchSize)
+	}
+
+	for {
+		select {
+		case msg := <-s.msgs:
+			batch = append(batch, msg)
+			if len(batch) >= s.batchSize {
+				flush()
+			}
+		case <-t.C:
+			flush()
+		case <-s.quit:
+			for {
+				select {
+				case msg := <-s.msgs:
+					batch = append(batch, msg)
+					if len(batch) >= s.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *HTTPSink) send(batch []analytics.Message) error {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(struct {
+		Batch  []analytics.Message `json:"batch"`
+		SentAt time.Time           `json:"sentAt"`
+	}{Batch: batch, SentAt: time.Now().UTC()}); err != nil {
+		return errors.WithStack(err)
+	}
+
+	req, err := http.NewRequest("POST", s.endpoint, &body)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for k := range s.header {
+		req.Header.Set(k, s.header.Get(k))
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "unable to send %d telemetry messages to %s", len(batch), s.endpoint)
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return errors.Errorf("expected %s to respond with a 2xx status code but got %d", s.endpoint, res.StatusCode)
+	}
+	return nil
+}
+
+// normalizeMessage validates the message and sets the type, id and timestamp like the Segment client does.
+func normalizeMessage(msg analytics.Message) (analytics.Message, error) {
+	if err := msg.Validate(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	id := uuid.New()
+	now := time.Now().UTC()
+	switch m := msg.(type) {
+	case analytics.Alias:
+		m.Type, m.MessageId, m.Timestamp = "alias", messageID(m.MessageId, id), timestamp(m.Timestamp, now)
+		return m, nil
+	case analytics.Group:
+		m.Type, m.MessageId, m.Timestamp = "group", messageID(m.MessageId, id), timestamp(m.Timestamp, now)
+		return m, nil
+	case analytics.Identify:
+		m.Type, m.MessageId, m.Timestamp = "identify", messageID(m.MessageId, id), timestamp(m.Timestamp, now)
+		return m, nil
+	case analytics.Page:
+		m.Type, m.MessageId, m.Timestamp = "page", messageID(m.MessageId, id), timestamp(m.Timestamp, now)
+		return m, nil
+	case analytics.Screen:
+		m.Type, m.MessageId, m.Timestamp = "screen", messageID(m.MessageId, id), timestamp(m.Timestamp, now)
+		return m, nil
+	case analytics.Track:
+		m.Type, m.MessageId, m.Timestamp = "track", messageID(m.MessageId, id), timestamp(m.Timestamp, now)
+		return m, nil
+	}
+	return nil, errors.Errorf("messages of type %T are not supported", msg)
+}
+
+func messageID(id, fallback string) string {
+	if id == "" {
+		return fallback
+	}
+	return id
+}
+
+func timestamp(t, fallback time.Time) time.Time {
+	if t.IsZero() {
+		return fallback
+	}
+	return t
+}
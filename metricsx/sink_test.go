@@ -0,0 +1,124 @@
+package metricsx
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	analytics "github.com/ory/analytics-go/v4"
+
+	"github.com/ory/x/logrusx"
+)
+
+func TestJSONSink(t *testing.T) {
+	var b bytes.Buffer
+	s := NewJSONSink(&b)
+
+	require.NoError(t, s.Enqueue(analytics.Track{UserId: "cluster", Event: "memstats"}))
+	require.NoError(t, s.Enqueue(analytics.Page{UserId: "cluster", Name: "/"}))
+	require.Error(t, s.Enqueue(analytics.Track{UserId: "cluster"}))
+	require.NoError(t, s.Close())
+
+	d := json.NewDecoder(&b)
+	for _, expected := range []string{"track", "page"} {
+		var msg map[string]interface{}
+		require.NoError(t, d.Decode(&msg))
+		assert.Equal(t, expected, msg["type"])
+		assert.NotEmpty(t, msg["messageId"])
+		assert.NotEmpty(t, msg["timestamp"])
+	}
+	assert.False(t, d.More())
+}
+
+func TestHTTPSink(t *testing.T) {
+	var l sync.Mutex
+	var batches [][]map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var body struct {
+			Batch []map[string]interface{} `json:"batch"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		l.Lock()
+		defer l.Unlock()
+		batches = append(batches, body.Batch)
+	}))
+	t.Cleanup(ts.Close)
+
+	t.Run("case=sends full batches and flushes on close", func(t *testing.T) {
+		s := NewHTTPSink(ts.URL,
+			HTTPSinkWithHeader("Authorization", "Bearer token"),
+			HTTPSinkWithBatchSize(2),
+			HTTPSinkWithInterval(time.Hour),
+		)
+		for i := 0; i < 3; i++ {
+			require.NoError(t, s.Enqueue(analytics.Track{UserId: "cluster", Event: "memstats"}))
+		}
+		require.NoError(t, s.Close())
+
+		l.Lock()
+		defer l.Unlock()
+		require.Len(t, batches, 2)
+		assert.Len(t, batches[0], 2)
+		assert.Len(t, batches[1], 1)
+		assert.Equal(t, "track", batches[0][0]["type"])
+
+		assert.Equal(t, ErrSinkClosed, s.Enqueue(analytics.Track{UserId: "cluster", Event: "memstats"}))
+	})
+
+	t.Run("case=drops messages if the queue is full", func(t *testing.T) {
+		block := make(chan struct{})
+		blocking := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-block
+		}))
+		t.Cleanup(blocking.Close)
+
+		s := NewHTTPSink(blocking.URL, HTTPSinkWithBatchSize(1), HTTPSinkWithQueueSize(1))
+		var err error
+		for i := 0; i < 10 && err == nil; i++ {
+			err = s.Enqueue(analytics.Track{UserId: "cluster", Event: "memstats"})
+		}
+		assert.Equal(t, ErrSinkQueueFull, err)
+
+		close(block)
+		require.NoError(t, s.Close())
+	})
+
+	t.Run("case=reports delivery errors", func(t *testing.T) {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		t.Cleanup(failing.Close)
+
+		var errs []error
+		s := NewHTTPSink(failing.URL, HTTPSinkWithErrorHandler(func(err error) {
+			errs = append(errs, err)
+		}))
+		require.NoError(t, s.Enqueue(analytics.Track{UserId: "cluster", Event: "memstats"}))
+		require.NoError(t, s.Close())
+		require.Len(t, errs, 1)
+		assert.Contains(t, errs[0].Error(), "500")
+	})
+}
+
+func TestNewIsolated(t *testing.T) {
+	cmd := new(cobra.Command)
+	cmd.Flags().Bool("sqa-opt-out", true, "")
+
+	l := logrusx.New("", "")
+	a := New(cmd, l, nil, &Options{Sink: NoopSink{}, Isolated: true})
+	b := New(cmd, l, nil, &Options{Sink: NoopSink{}, Isolated: true})
+	assert.NotSame(t, a, b)
+	assert.Nil(t, instance)
+}
@@ -0,0 +1,18 @@
+package popx
+
+import (
+	"context"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/healthx"
+)
+
+// ReadyChecker returns a healthx.ReadyChecker which runs a trivial query on the connection. Unlike pinging the
+// underlying *sql.DB, this also works for connections which are in a transaction.
+func ReadyChecker(c *pop.Connection, opts ...healthx.CheckerOption) healthx.ReadyChecker {
+	return healthx.NewReadyChecker(func(ctx context.Context) error {
+		return errors.Wrap(c.WithContext(ctx).RawQuery("SELECT 1").Exec(), "unable to query the database")
+	}, opts...)
+}
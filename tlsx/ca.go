@@ -0,0 +1,418 @@
+package tlsx
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/josex"
+)
+
+// KeyType is the type of key generated for certificates.
+type KeyType string
+
+const (
+	// KeyTypeRSA generates 2048 bit RSA keys.
+	KeyTypeRSA KeyType = "rsa"
+	// KeyTypeECDSA generates ECDSA keys on the P-256 curve.
+	KeyTypeECDSA KeyType = "ecdsa"
+	// KeyTypeEd25519 generates Ed25519 keys.
+	KeyTypeEd25519 KeyType = "ed25519"
+)
+
+// GenerateKey generates a private key of the given type.
+func GenerateKey(t KeyType) (crypto.Signer, error) {
+	switch t {
+	case KeyTypeRSA:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		return key, errors.WithStack(err)
+	case KeyTypeECDSA:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		return key, errors.WithStack(err)
+	case KeyTypeEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, errors.WithStack(err)
+	}
+	return nil, errors.Errorf("unknown key type %q, expected one of rsa, ecdsa, ed25519", t)
+}
+
+// CA is a certificate authority for development and tests. It issues leaf certificates for servers and clients
+// and must never be used in production.
+type CA struct {
+	Certificate *x509.Certificate
+	Key         crypto.Signer
+}
+
+type caOptions struct {
+	commonName   string
+	organization string
+	keyType      KeyType
+	validity     time.Duration
+}
+
+// CAOption configures NewCA.
+type CAOption func(*caOptions)
+
+// CAWithCommonName sets the common name of the root certificate.
+func CAWithCommonName(name string) CAOption {
+	return func(o *caOptions) {
+		o.commonName = name
+	}
+}
+
+// CAWithOrganization sets the organization of the root certificate.
+func CAWithOrganization(organization string) CAOption {
+	return func(o *caOptions) {
+		o.organization = organization
+	}
+}
+
+// CAWithKeyType sets the type of the root key. The default is ECDSA.
+func CAWithKeyType(t KeyType) CAOption {
+	return func(o *caOptions) {
+		o.keyType = t
+	}
+}
+
+// CAWithValidity sets how long the root certificate is valid. The default is ten years.
+func CAWithValidity(d time.Duration) CAOption {
+	return func(o *caOptions) {
+		o.validity = d
+	}
+}
+
+// NewCA creates a new self-signed root certificate authority.
+func NewCA(opts ...CAOption) (*CA, error) {
+	o := &caOptions{
+		commonName:   "ORY Development CA",
+		organization: "ORY GmbH",
+		keyType:      KeyTypeECDSA,
+		validity:     10 * 365 * 24 * time.Hour,
+	}
+	for _, f := range opts {
+		f(o)
+	}
+
+	key, err := GenerateKey(o.keyType)
+	if err != nil {
+		return nil, err
+	}
+
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			Organization: []string{o.organization},
+			CommonName:   o.commonName,
+		},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(o.validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, errors.Errorf("failed to create certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &CA{Certificate: cert, Key: key}, nil
+}
+
+// LoadCA loads a certificate authority from its PEM encoded certificate and private key.
+func LoadCA(certPEM, keyPEM []byte) (*CA, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("unable to load the CA certificate: no PEM encoded certificate was found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load the CA certificate")
+	}
+	if !cert.IsCA {
+		return nil, errors.New("unable to load the CA certificate: the certificate is not a certificate authority")
+	}
+
+	key, err := josex.LoadPrivateKey(keyPEM)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load the CA private key")
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.Errorf("unable to load the CA private key: unsupported key type %T", key)
+	}
+	if !publicKeysEqual(cert.PublicKey, signer.Public()) {
+		return nil, errors.New("unable to load the CA: the private key does not match the certificate")
+	}
+
+	return &CA{Certificate: cert, Key: signer}, nil
+}
+
+// LoadOrCreateCA loads the certificate authority from the files or creates and writes a new one if the
+// certificate file does not exist.
+func LoadOrCreateCA(certPath, keyPath string, opts ...CAOption) (*CA, error) {
+	certPEM, err := ioutil.ReadFile(certPath)
+	if os.IsNotExist(err) {
+		ca, err := NewCA(opts...)
+		if err != nil {
+			return nil, err
+		}
+		if err := ca.WriteFiles(certPath, keyPath); err != nil {
+			return nil, err
+		}
+		return ca, nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	keyPEM, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return LoadCA(certPEM, keyPEM)
+}
+
+// CertificatePEM returns the PEM encoded root certificate.
+func (ca *CA) CertificatePEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Certificate.Raw})
+}
+
+// CertPool returns a pool containing the root certificate which can be used as tls.Config.RootCAs or ClientCAs.
+func (ca *CA) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Certificate)
+	return pool
+}
+
+// WriteFiles writes the PEM encoded root certificate and private key. The private key is only readable by the
+// current user.
+func (ca *CA) WriteFiles(certPath, keyPath string) error {
+	return writeKeyPairFiles(certPath, keyPath, ca.CertificatePEM(), ca.Key)
+}
+
+type leafOptions struct {
+	commonName  string
+	dnsNames    []string
+	ipAddresses []net.IP
+	keyType     KeyType
+	key         crypto.Signer
+	keyUsage    x509.KeyUsage
+	extKeyUsage []x509.ExtKeyUsage
+	validity    time.Duration
+}
+
+// LeafOption configures CA.Issue.
+type LeafOption func(*leafOptions)
+
+// LeafWithCommonName sets the common name. It defaults to the first host.
+func LeafWithCommonName(name string) LeafOption {
+	return func(o *leafOptions) {
+		o.commonName = name
+	}
+}
+
+// LeafWithHosts adds DNS names or IP addresses to the subject alternative names.
+func LeafWithHosts(hosts ...string) LeafOption {
+	return func(o *leafOptions) {
+		for _, h := range hosts {
+			if ip := net.ParseIP(h); ip != nil {
+				o.ipAddresses = append(o.ipAddresses, ip)
+			} else {
+				o.dnsNames = append(o.dnsNames, h)
+			}
+		}
+	}
+}
+
+// LeafWithDNSNames adds DNS names to the subject alternative names.
+func LeafWithDNSNames(names ...string) LeafOption {
+	return func(o *leafOptions) {
+		o.dnsNames = append(o.dnsNames, names...)
+	}
+}
+
+// LeafWithIPAddresses adds IP addresses to the subject alternative names.
+func LeafWithIPAddresses(ips ...net.IP) LeafOption {
+	return func(o *leafOptions) {
+		o.ipAddresses = append(o.ipAddresses, ips...)
+	}
+}
+
+// LeafWithKeyType sets the type of the generated key. The default is ECDSA.
+func LeafWithKeyType(t KeyType) LeafOption {
+	return func(o *leafOptions) {
+		o.keyType = t
+	}
+}
+
+// LeafWithKey uses an existing key instead of generating one.
+func LeafWithKey(key crypto.Signer) LeafOption {
+	return func(o *leafOptions) {
+		o.key = key
+	}
+}
+
+// LeafWithKeyUsage sets the key usage. The default is digital signature, and key encipherment for RSA keys.
+func LeafWithKeyUsage(usage x509.KeyUsage) LeafOption {
+	return func(o *leafOptions) {
+		o.keyUsage = usage
+	}
+}
+
+// LeafWithExtKeyUsage sets the extended key usages. The default is server authentication.
+func LeafWithExtKeyUsage(usages ...x509.ExtKeyUsage) LeafOption {
+	return func(o *leafOptions) {
+		o.extKeyUsage = usages
+	}
+}
+
+// LeafWithValidity sets how long the certificate is valid. The default is 90 days.
+func LeafWithValidity(d time.Duration) LeafOption {
+	return func(o *leafOptions) {
+		o.validity = d
+	}
+}
+
+// Issue issues a leaf certificate signed by the CA. The returned certificate contains the leaf and the root
+// certificate and can be used directly in a tls.Config.
+func (ca *CA) Issue(opts ...LeafOption) (*tls.Certificate, error) {
+	o := &leafOptions{
+		keyType:     KeyTypeECDSA,
+		extKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		validity:    90 * 24 * time.Hour,
+	}
+	for _, f := range opts {
+		f(o)
+	}
+
+	key := o.key
+	if key == nil {
+		var err error
+		if key, err = GenerateKey(o.keyType); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.keyUsage == 0 {
+		o.keyUsage = x509.KeyUsageDigitalSignature
+		if _, ok := key.(*rsa.PrivateKey); ok {
+			o.keyUsage |= x509.KeyUsageKeyEncipherment
+		}
+	}
+
+	if o.commonName == "" {
+		if len(o.dnsNames) > 0 {
+			o.commonName = o.dnsNames[0]
+		} else if len(o.ipAddresses) > 0 {
+			o.commonName = o.ipAddresses[0].String()
+		}
+	}
+
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	notAfter := now.Add(o.validity)
+	if notAfter.After(ca.Certificate.NotAfter) {
+		notAfter = ca.Certificate.NotAfter
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			Organization: ca.Certificate.Subject.Organization,
+			CommonName:   o.commonName,
+		},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              notAfter,
+		KeyUsage:              o.keyUsage,
+		ExtKeyUsage:           o.extKeyUsage,
+		BasicConstraintsValid: true,
+		DNSNames:              o.dnsNames,
+		IPAddresses:           o.ipAddresses,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Certificate, key.Public(), ca.Key)
+	if err != nil {
+		return nil, errors.Errorf("failed to create certificate: %s", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{der, ca.Certificate.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+// WriteCertificateFiles writes the PEM encoded certificate chain and private key of cert. The private key is
+// only readable by the current user.
+func WriteCertificateFiles(cert *tls.Certificate, certPath, keyPath string) error {
+	var chain []byte
+	for _, der := range cert.Certificate {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	return writeKeyPairFiles(certPath, keyPath, chain, cert.PrivateKey)
+}
+
+func writeKeyPairFiles(certPath, keyPath string, certPEM []byte, key interface{}) error {
+	block, err := PKCS8PEMBlockForKey(key)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range []string{certPath, keyPath} {
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if err := ioutil.WriteFile(certPath, certPEM, 0644); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(ioutil.WriteFile(keyPath, pem.EncodeToMemory(block), 0600))
+}
+
+func newSerialNumber() (*big.Int, error) {
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+	if err != nil {
+		return nil, errors.Errorf("failed to generate serial number: %s", err)
+	}
+	return serialNumber, nil
+}
+
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	k, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && k.Equal(b)
+}
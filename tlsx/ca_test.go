@@ -0,0 +1,107 @@
+package tlsx
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/x/cmdx"
+)
+
+func TestCA(t *testing.T) {
+	for _, caKeyType := range []KeyType{KeyTypeRSA, KeyTypeECDSA, KeyTypeEd25519} {
+		for _, leafKeyType := range []KeyType{KeyTypeRSA, KeyTypeECDSA, KeyTypeEd25519} {
+			t.Run(fmt.Sprintf("ca=%s/leaf=%s", caKeyType, leafKeyType), func(t *testing.T) {
+				ca, err := NewCA(CAWithKeyType(caKeyType))
+				require.NoError(t, err)
+
+				cert, err := ca.Issue(LeafWithHosts("localhost", "127.0.0.1"), LeafWithKeyType(leafKeyType), LeafWithValidity(time.Hour))
+				require.NoError(t, err)
+
+				assert.Equal(t, "localhost", cert.Leaf.Subject.CommonName)
+				assert.Equal(t, []string{"localhost"}, cert.Leaf.DNSNames)
+				require.Len(t, cert.Leaf.IPAddresses, 1)
+				assert.True(t, cert.Leaf.IPAddresses[0].Equal(net.ParseIP("127.0.0.1")))
+				assert.WithinDuration(t, time.Now().Add(time.Hour), cert.Leaf.NotAfter, time.Minute)
+
+				_, err = cert.Leaf.Verify(x509.VerifyOptions{Roots: ca.CertPool(), DNSName: "127.0.0.1"})
+				require.NoError(t, err)
+				_, err = cert.Leaf.Verify(x509.VerifyOptions{Roots: ca.CertPool(), KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+				require.Error(t, err)
+			})
+		}
+	}
+
+	t.Run("case=validity is capped by the CA", func(t *testing.T) {
+		ca, err := NewCA(CAWithValidity(time.Hour))
+		require.NoError(t, err)
+
+		cert, err := ca.Issue(LeafWithHosts("localhost"))
+		require.NoError(t, err)
+		assert.Equal(t, ca.Certificate.NotAfter, cert.Leaf.NotAfter)
+	})
+
+	t.Run("case=rejects unknown key types", func(t *testing.T) {
+		_, err := NewCA(CAWithKeyType("dsa"))
+		require.Error(t, err)
+	})
+
+	t.Run("case=load or create", func(t *testing.T) {
+		dir := t.TempDir()
+		certPath, keyPath := filepath.Join(dir, "ca", "ca.pem"), filepath.Join(dir, "ca", "ca.key.pem")
+
+		created, err := LoadOrCreateCA(certPath, keyPath)
+		require.NoError(t, err)
+		loaded, err := LoadOrCreateCA(certPath, keyPath)
+		require.NoError(t, err)
+		assert.True(t, created.Certificate.Equal(loaded.Certificate))
+
+		other, err := NewCA()
+		require.NoError(t, err)
+		block, err := PKCS8PEMBlockForKey(other.Key)
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(keyPath, pem.EncodeToMemory(block), 0600))
+
+		_, err = LoadOrCreateCA(certPath, keyPath)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "does not match")
+	})
+}
+
+func TestDevCACommand(t *testing.T) {
+	dir := t.TempDir()
+
+	out := cmdx.ExecNoErr(t, NewDevCACommand(), "--dir", dir, "--client", "--key-type", "ed25519", "localhost", "::1")
+	assert.True(t, strings.Contains(out, filepath.Join(dir, "localhost.pem")), out)
+
+	certs, err := Certificate("", "", filepath.Join(dir, "localhost.pem"), filepath.Join(dir, "localhost.key.pem"))
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(certs[0].Certificate[0])
+	require.NoError(t, err)
+	assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}, leaf.ExtKeyUsage)
+
+	caPEM, err := ioutil.ReadFile(filepath.Join(dir, "ca.pem"))
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(caPEM))
+	_, err = leaf.Verify(x509.VerifyOptions{Roots: pool, DNSName: "::1"})
+	require.NoError(t, err)
+
+	// The CA is reused.
+	cmdx.ExecNoErr(t, NewDevCACommand(), "--dir", dir, "--name", "other", "example.local")
+	caPEMAfter, err := ioutil.ReadFile(filepath.Join(dir, "ca.pem"))
+	require.NoError(t, err)
+	assert.Equal(t, caPEM, caPEMAfter)
+
+	stderr := cmdx.ExecExpectedErr(t, NewDevCACommand(), "--dir", dir, "--key-type", "dsa", "localhost")
+	assert.Contains(t, stderr, "unknown key type")
+}
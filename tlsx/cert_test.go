@@ -1,13 +1,23 @@
 package tlsx
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/ory/x/josex"
 )
 
 func TestHTTPSCertificate(t *testing.T) {
@@ -225,3 +235,83 @@ RHMZNMoDTRhmhQhj8M7N+FMtZAUOMddZ/1cvREtFW7+66w+XZvj9CQ/uectp/qb+
 	assert.Nil(t, cert)
 	assert.Error(t, err)
 }
+
+func TestPEMBlockForKey(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	for k, tc := range []struct {
+		key      interface{}
+		pkcs8    bool
+		expected string
+	}{
+		{key: edKey, expected: "PRIVATE KEY"},
+		{key: ecKey, expected: "EC PRIVATE KEY"},
+		{key: ecKey, pkcs8: true, expected: "PRIVATE KEY"},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			block, err := PEMBlockForKey(tc.key)
+			if tc.pkcs8 {
+				block, err = PKCS8PEMBlockForKey(tc.key)
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, block.Type)
+
+			cert, err := CreateSelfSignedTLSCertificate(tc.key)
+			require.NoError(t, err)
+			assert.NotNil(t, cert)
+		})
+	}
+}
+
+func TestEncryptedCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	c, err := CreateSelfSignedCertificate(key)
+	require.NoError(t, err)
+	block, err := josex.EncryptPKCS8PrivateKey(key, []byte("secret"))
+	require.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+	keyPEM := pem.EncodeToMemory(block)
+
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, ioutil.WriteFile(certPath, certPEM, 0600))
+	require.NoError(t, ioutil.WriteFile(keyPath, keyPEM, 0600))
+	certString, keyString := base64.StdEncoding.EncodeToString(certPEM), base64.StdEncoding.EncodeToString(keyPEM)
+
+	t.Run("case=fails without passphrase", func(t *testing.T) {
+		_, err := Certificate("", "", certPath, keyPath)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no passphrase")
+	})
+
+	t.Run("case=fails with the wrong passphrase", func(t *testing.T) {
+		_, err := Certificate(certString, keyString, "", "", CertificateWithPassphrase(josex.StaticPassphrase([]byte("not-secret"))))
+		require.Error(t, err)
+	})
+
+	t.Run("case=loads from files and strings", func(t *testing.T) {
+		for _, args := range [][4]string{{"", "", certPath, keyPath}, {certString, keyString, "", ""}} {
+			certs, err := Certificate(args[0], args[1], args[2], args[3], CertificateWithPassphrase(josex.StaticPassphrase([]byte("secret"))))
+			require.NoError(t, err)
+			require.Len(t, certs, 1)
+			assert.True(t, key.Equal(certs[0].PrivateKey))
+		}
+	})
+
+	t.Run("case=reads the passphrase from the environment", func(t *testing.T) {
+		passphrasePath := filepath.Join(dir, "passphrase")
+		require.NoError(t, ioutil.WriteFile(passphrasePath, []byte("secret\n"), 0600))
+
+		require.NoError(t, os.Setenv("TLSX_TEST_KEY_PASSPHRASE_PATH", passphrasePath))
+		defer os.Unsetenv("TLSX_TEST_KEY_PASSPHRASE_PATH")
+
+		certs, err := Certificate("", "", certPath, keyPath, CertificateWithPassphraseFromEnv("TLSX_TEST"))
+		require.NoError(t, err)
+		require.Len(t, certs, 1)
+	})
+}
@@ -0,0 +1,93 @@
+package tlsx
+
+import (
+	"crypto/x509"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ory/x/cmdx"
+	"github.com/ory/x/flagx"
+)
+
+// NewTLSCommand returns the `tls` command which groups the TLS helpers.
+func NewTLSCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tls",
+		Short: "Helpers for working with TLS certificates",
+	}
+	cmd.AddCommand(NewDevCACommand(), NewInspectCommand())
+	return cmd
+}
+
+// RegisterCommandRecursive adds the tls command and its subcommands to parent.
+func RegisterCommandRecursive(parent *cobra.Command) {
+	parent.AddCommand(NewTLSCommand())
+}
+
+// NewDevCACommand returns the `dev-ca` command.
+func NewDevCACommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dev-ca <host> [<host>...]",
+		Short: "Issue certificates from a local development certificate authority",
+		Long: `Issues a certificate for the given DNS names and IP addresses which is signed by a local development
+certificate authority. The certificate authority is created in the output directory (ca.pem and ca.key.pem) if it
+does not exist yet and reused otherwise. Add ca.pem to the trusted roots of your clients.
+
+The certificate and private key are written to <name>.pem and <name>.key.pem. The name defaults to the first host.
+
+Never use the development certificate authority in production.`,
+		Example: `tls dev-ca localhost 127.0.0.1 ::1
+tls dev-ca --dir ./certs --key-type rsa --validity 720h my-service.local
+tls dev-ca --client --name my-client my-client.internal`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := flagx.MustGetString(cmd, "dir")
+			ca, err := LoadOrCreateCA(filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca.key.pem"))
+			if err != nil {
+				_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "Unable to load or create the certificate authority: %s\n", err)
+				return cmdx.FailSilently(cmd)
+			}
+
+			usages := []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+			if flagx.MustGetBool(cmd, "client") {
+				usages = append(usages, x509.ExtKeyUsageClientAuth)
+			}
+
+			cert, err := ca.Issue(
+				LeafWithHosts(args...),
+				LeafWithKeyType(KeyType(flagx.MustGetString(cmd, "key-type"))),
+				LeafWithExtKeyUsage(usages...),
+				LeafWithValidity(flagx.MustGetDuration(cmd, "validity")),
+			)
+			if err != nil {
+				_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "Unable to issue the certificate: %s\n", err)
+				return cmdx.FailSilently(cmd)
+			}
+
+			name := flagx.MustGetString(cmd, "name")
+			if name == "" {
+				name = args[0]
+			}
+			certPath, keyPath := filepath.Join(dir, name+".pem"), filepath.Join(dir, name+".key.pem")
+			if err := WriteCertificateFiles(cert, certPath, keyPath); err != nil {
+				_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "Unable to write the certificate: %s\n", err)
+				return cmdx.FailSilently(cmd)
+			}
+
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Certificate:     %s\nPrivate key:     %s\nCA certificate:  %s\nValid until:     %s\n",
+				certPath, keyPath, filepath.Join(dir, "ca.pem"), cert.Leaf.NotAfter.Format("2006-01-02 15:04:05 MST"))
+			return nil
+		},
+	}
+
+	cmd.Flags().String("dir", ".", "The directory containing the certificate authority and the issued certificates.")
+	cmd.Flags().String("name", "", "The file name of the certificate without extension. Defaults to the first host.")
+	cmd.Flags().String("key-type", string(KeyTypeECDSA), "The key type, one of: rsa, ecdsa, ed25519.")
+	cmd.Flags().Duration("validity", 90*24*time.Hour, "How long the certificate is valid.")
+	cmd.Flags().Bool("client", false, "Also allow using the certificate for client authentication, e.g. for mutual TLS.")
+
+	return cmd
+}
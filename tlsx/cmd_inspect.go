@@ -0,0 +1,87 @@
+package tlsx
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ory/x/cmdx"
+	"github.com/ory/x/flagx"
+)
+
+// NewInspectCommand returns the `inspect` command.
+func NewInspectCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "inspect <path/to/cert.pem | env-prefix>",
+		Short: "Show the subject, SANs, issuer, validity, and key type of certificates",
+		Long: `Shows all certificates in a PEM file. If the argument is not a file, it is used as the prefix of the environment
+variables which configure the certificate, e.g. HTTPS_TLS reads HTTPS_TLS_CERT or HTTPS_TLS_CERT_PATH.
+
+Use --expires-within to fail if a certificate expires soon, e.g. in a cron job.`,
+		Example: `tls inspect cert.pem
+tls inspect --format json HTTPS_TLS
+tls inspect --expires-within 336h /etc/tls/tls.crt`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := ioutil.ReadFile(args[0])
+			if os.IsNotExist(err) {
+				data, err = certificatePEMFromEnv(args[0])
+			}
+			if err != nil {
+				_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "Unable to read the certificate: %s\n", err)
+				return cmdx.FailSilently(cmd)
+			}
+
+			infos, err := InspectPEM(data)
+			if err != nil {
+				_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "Unable to parse the certificate: %s\n", err)
+				return cmdx.FailSilently(cmd)
+			}
+
+			cmdx.PrintTable(cmd, infos)
+
+			if within := flagx.MustGetDuration(cmd, "expires-within"); within > 0 {
+				now := time.Now()
+				var expiring bool
+				for _, i := range infos {
+					if i.ExpiresWithin(now, within) {
+						_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "The certificate %q expires at %s.\n", i.Subject, i.NotAfter.Format(time.RFC3339))
+						expiring = true
+					}
+				}
+				if expiring {
+					return cmdx.FailSilently(cmd)
+				}
+			}
+			return nil
+		},
+	}
+
+	cmdx.RegisterFormatFlags(cmd.Flags())
+	cmd.Flags().Duration("expires-within", 0, "Fail if a certificate is expired or expires within this duration.")
+
+	return cmd
+}
+
+// certificatePEMFromEnv reads the PEM encoded certificate from <prefix>_CERT or <prefix>_CERT_PATH.
+func certificatePEMFromEnv(prefix string) ([]byte, error) {
+	if s := os.Getenv(prefix + "_CERT"); s != "" {
+		data, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("unable to base64 decode the TLS certificate: %v", err)
+		}
+		return data, nil
+	}
+
+	if p := os.Getenv(prefix + "_CERT_PATH"); p != "" {
+		data, err := ioutil.ReadFile(p)
+		return data, errors.WithStack(err)
+	}
+
+	return nil, errors.Errorf("%s is neither a file nor the prefix of the environment variables %s_CERT or %s_CERT_PATH", prefix, prefix, prefix)
+}
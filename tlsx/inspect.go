@@ -0,0 +1,225 @@
+package tlsx
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/cmdx"
+)
+
+// CertificateInfo describes a certificate.
+type CertificateInfo struct {
+	Subject           string    `json:"subject"`
+	Issuer            string    `json:"issuer"`
+	SerialNumber      string    `json:"serial_number"`
+	DNSNames          []string  `json:"dns_names,omitempty"`
+	IPAddresses       []string  `json:"ip_addresses,omitempty"`
+	EmailAddresses    []string  `json:"email_addresses,omitempty"`
+	URIs              []string  `json:"uris,omitempty"`
+	NotBefore         time.Time `json:"not_before"`
+	NotAfter          time.Time `json:"not_after"`
+	KeyType           string    `json:"key_type"`
+	IsCA              bool      `json:"is_ca"`
+	SHA256Fingerprint string    `json:"sha256_fingerprint"`
+}
+
+// CertificateInfos is a list of certificate descriptions. It implements cmdx.Table.
+type CertificateInfos []*CertificateInfo
+
+var _ cmdx.Table = (CertificateInfos)(nil)
+
+// Inspect describes the certificate.
+func Inspect(cert *x509.Certificate) *CertificateInfo {
+	fingerprint := sha256.Sum256(cert.Raw)
+	info := &CertificateInfo{
+		Subject:           cert.Subject.String(),
+		Issuer:            cert.Issuer.String(),
+		SerialNumber:      cert.SerialNumber.Text(16),
+		DNSNames:          cert.DNSNames,
+		EmailAddresses:    cert.EmailAddresses,
+		NotBefore:         cert.NotBefore,
+		NotAfter:          cert.NotAfter,
+		KeyType:           keyType(cert.PublicKey),
+		IsCA:              cert.IsCA,
+		SHA256Fingerprint: hex.EncodeToString(fingerprint[:]),
+	}
+	for _, ip := range cert.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	for _, u := range cert.URIs {
+		info.URIs = append(info.URIs, u.String())
+	}
+	return info
+}
+
+// InspectPEM describes all PEM encoded certificates in data. Other PEM blocks, e.g. private keys, are skipped.
+func InspectPEM(data []byte) (CertificateInfos, error) {
+	var infos CertificateInfos
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse certificate")
+		}
+		infos = append(infos, Inspect(cert))
+	}
+
+	if len(infos) == 0 {
+		return nil, errors.New("no PEM encoded certificate was found")
+	}
+	return infos, nil
+}
+
+// InspectTLSCertificates describes all certificates of the chains.
+func InspectTLSCertificates(certs ...tls.Certificate) (CertificateInfos, error) {
+	var infos CertificateInfos
+	for _, c := range certs {
+		for _, der := range c.Certificate {
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, errors.Wrap(err, "unable to parse certificate")
+			}
+			infos = append(infos, Inspect(cert))
+		}
+	}
+	return infos, nil
+}
+
+// ExpiresWithin returns true if the certificate is expired or expires within d from now.
+func (i *CertificateInfo) ExpiresWithin(now time.Time, d time.Duration) bool {
+	return !now.Add(d).Before(i.NotAfter)
+}
+
+func (i *CertificateInfo) sans() []string {
+	sans := make([]string, 0, len(i.DNSNames)+len(i.IPAddresses)+len(i.EmailAddresses)+len(i.URIs))
+	sans = append(sans, i.DNSNames...)
+	sans = append(sans, i.IPAddresses...)
+	sans = append(sans, i.EmailAddresses...)
+	return append(sans, i.URIs...)
+}
+
+func (CertificateInfos) Header() []string {
+	return []string{"SUBJECT", "ISSUER", "SANS", "NOT BEFORE", "NOT AFTER", "KEY TYPE"}
+}
+
+func (c CertificateInfos) Table() [][]string {
+	rows := make([][]string, len(c))
+	for k, i := range c {
+		sans := strings.Join(i.sans(), ", ")
+		if sans == "" {
+			sans = cmdx.None
+		}
+		rows[k] = []string{i.Subject, i.Issuer, sans, i.NotBefore.Format(time.RFC3339), i.NotAfter.Format(time.RFC3339), i.KeyType}
+	}
+	return rows
+}
+
+func (c CertificateInfos) Interface() interface{} {
+	return c
+}
+
+func (c CertificateInfos) Len() int {
+	return len(c)
+}
+
+func keyType(key interface{}) string {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", k.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA " + k.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return fmt.Sprintf("%T", key)
+}
+
+// CertificateSource returns the certificates which are currently in use.
+type CertificateSource func() []tls.Certificate
+
+// StaticCertificates returns a CertificateSource which always returns certs.
+func StaticCertificates(certs ...tls.Certificate) CertificateSource {
+	return func() []tls.Certificate {
+		return certs
+	}
+}
+
+// ExpiringCertificates returns all certificates of the chains which are expired or expire within d.
+func ExpiringCertificates(certs []tls.Certificate, d time.Duration) (CertificateInfos, error) {
+	infos, err := InspectTLSCertificates(certs...)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var expiring CertificateInfos
+	for _, i := range infos {
+		if i.ExpiresWithin(now, d) {
+			expiring = append(expiring, i)
+		}
+	}
+	return expiring, nil
+}
+
+// CheckExpiry returns an error if a certificate can not be parsed, is expired, or expires within d, for example
+// 14 * 24 * time.Hour. See the tlshealth package for a health check based on it.
+func CheckExpiry(certs []tls.Certificate, d time.Duration) error {
+	expiring, err := ExpiringCertificates(certs, d)
+	if err != nil {
+		return err
+	}
+	if len(expiring) > 0 {
+		return errors.Errorf("the certificate %q expires at %s", expiring[0].Subject, expiring[0].NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// WatchExpiry checks the certificates immediately and then in the given interval until the context is canceled.
+// onExpiring is called for every certificate that is expired or expires within d, onError is called if the
+// certificates can not be parsed.
+func WatchExpiry(ctx context.Context, certs CertificateSource, d, interval time.Duration, onExpiring func(*CertificateInfo), onError func(error)) {
+	check := func() {
+		expiring, err := ExpiringCertificates(certs(), d)
+		if err != nil {
+			onError(err)
+			return
+		}
+		for _, i := range expiring {
+			onExpiring(i)
+		}
+	}
+
+	check()
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				check()
+			}
+		}
+	}()
+}
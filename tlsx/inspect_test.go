@@ -0,0 +1,134 @@
+package tlsx
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/x/cmdx"
+)
+
+func TestInspect(t *testing.T) {
+	ca, err := NewCA(CAWithCommonName("Inspect CA"), CAWithKeyType(KeyTypeRSA))
+	require.NoError(t, err)
+	cert, err := ca.Issue(LeafWithHosts("example.local", "10.0.0.1"), LeafWithKeyType(KeyTypeEd25519), LeafWithValidity(48*time.Hour))
+	require.NoError(t, err)
+
+	infos, err := InspectTLSCertificates(*cert)
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+
+	assert.Equal(t, "CN=example.local,O=ORY GmbH", infos[0].Subject)
+	assert.Equal(t, "CN=Inspect CA,O=ORY GmbH", infos[0].Issuer)
+	assert.Equal(t, []string{"example.local"}, infos[0].DNSNames)
+	assert.Equal(t, []string{"10.0.0.1"}, infos[0].IPAddresses)
+	assert.Equal(t, "Ed25519", infos[0].KeyType)
+	assert.False(t, infos[0].IsCA)
+	assert.Equal(t, "RSA 2048", infos[1].KeyType)
+	assert.True(t, infos[1].IsCA)
+
+	t.Run("case=expiry", func(t *testing.T) {
+		expiring, err := ExpiringCertificates([]tls.Certificate{*cert}, 24*time.Hour)
+		require.NoError(t, err)
+		assert.Len(t, expiring, 0)
+
+		expiring, err = ExpiringCertificates([]tls.Certificate{*cert}, 72*time.Hour)
+		require.NoError(t, err)
+		require.Len(t, expiring, 1)
+		assert.Equal(t, infos[0].Subject, expiring[0].Subject)
+
+		assert.NoError(t, CheckExpiry([]tls.Certificate{*cert}, 24*time.Hour))
+		assert.Error(t, CheckExpiry([]tls.Certificate{*cert}, 72*time.Hour))
+		assert.Error(t, CheckExpiry([]tls.Certificate{{Certificate: [][]byte{[]byte("not a certificate")}}}, 24*time.Hour))
+	})
+
+	t.Run("case=watch expiry", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var l sync.Mutex
+		var calls int
+		WatchExpiry(ctx, StaticCertificates(*cert), 72*time.Hour, 10*time.Millisecond, func(i *CertificateInfo) {
+			l.Lock()
+			defer l.Unlock()
+			calls++
+		}, func(err error) {
+			t.Errorf("unexpected error: %+v", err)
+		})
+
+		assert.Eventually(t, func() bool {
+			l.Lock()
+			defer l.Unlock()
+			return calls >= 2
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("case=watch expiry reports broken certificates", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		errs := make(chan error, 1)
+		broken := tls.Certificate{Certificate: [][]byte{[]byte("not a certificate")}}
+		WatchExpiry(ctx, StaticCertificates(broken), 72*time.Hour, time.Hour, func(i *CertificateInfo) {
+			t.Errorf("unexpected expiring certificate: %s", i.Subject)
+		}, func(err error) {
+			errs <- err
+		})
+
+		select {
+		case err := <-errs:
+			assert.Error(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("the error was not reported")
+		}
+	})
+}
+
+func TestInspectCommand(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := NewCA()
+	require.NoError(t, err)
+	cert, err := ca.Issue(LeafWithHosts("inspect.local"), LeafWithValidity(48*time.Hour))
+	require.NoError(t, err)
+	certPath := filepath.Join(dir, "cert.pem")
+	require.NoError(t, WriteCertificateFiles(cert, certPath, filepath.Join(dir, "key.pem")))
+
+	t.Run("case=file", func(t *testing.T) {
+		out := cmdx.ExecNoErr(t, NewInspectCommand(), certPath)
+		assert.True(t, strings.Contains(out, "inspect.local"), out)
+		assert.True(t, strings.Contains(out, "ECDSA P-256"), out)
+	})
+
+	t.Run("case=env prefix", func(t *testing.T) {
+		require.NoError(t, os.Setenv("TLSX_INSPECT_CERT", base64.StdEncoding.EncodeToString(ca.CertificatePEM())))
+		defer os.Unsetenv("TLSX_INSPECT_CERT")
+
+		out := cmdx.ExecNoErr(t, NewInspectCommand(), "--format", "json", "TLSX_INSPECT")
+		var infos CertificateInfos
+		require.NoError(t, json.Unmarshal([]byte(out), &infos))
+		require.Len(t, infos, 1)
+		assert.True(t, infos[0].IsCA)
+	})
+
+	t.Run("case=expires within", func(t *testing.T) {
+		cmdx.ExecNoErr(t, NewInspectCommand(), "--expires-within", "24h", certPath)
+		_, stderr, err := cmdx.Exec(t, NewInspectCommand(), nil, "--expires-within", "72h", certPath)
+		require.Error(t, err)
+		assert.Contains(t, stderr, "inspect.local")
+	})
+
+	t.Run("case=unknown", func(t *testing.T) {
+		stderr := cmdx.ExecExpectedErr(t, NewInspectCommand(), "TLSX_INSPECT_UNSET")
+		assert.Contains(t, stderr, "neither a file")
+	})
+}
@@ -0,0 +1,109 @@
+package tlsx
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"strings"
+
+	"github.com/ory/herodot"
+)
+
+type contextKey int
+
+const clientCertificateContextKey contextKey = iota + 1
+
+// ClientCertificateMiddleware is a negroni middleware which only lets requests pass whose verified client
+// certificate matches an allow-list. It requires a TLS server configuration which verifies client certificates,
+// see NewServerConfig.
+type ClientCertificateMiddleware struct {
+	h          herodot.Writer
+	allowed    map[string]bool
+	allowedDNS map[string]bool
+	any        bool
+}
+
+// NewClientCertificateMiddleware returns a middleware which allows requests whose client certificate contains one
+// of the allowed identities. Identities are matched against the DNS, email, IP, and URI (e.g. SPIFFE IDs) subject
+// alternative names, or against the common name if the certificate has no subject alternative names, see
+// ClientCertificateIdentities. DNS names are matched case-insensitively, all other identities are matched exactly.
+// If no identity is given, any verified client certificate is allowed.
+func NewClientCertificateMiddleware(h herodot.Writer, allowed ...string) *ClientCertificateMiddleware {
+	m := &ClientCertificateMiddleware{
+		h:          h,
+		allowed:    make(map[string]bool, len(allowed)),
+		allowedDNS: make(map[string]bool, len(allowed)),
+		any:        len(allowed) == 0,
+	}
+	for _, a := range allowed {
+		m.allowed[a] = true
+		m.allowedDNS[strings.ToLower(a)] = true
+	}
+	return m
+}
+
+func (m *ClientCertificateMiddleware) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	// VerifiedChains is only populated if the certificate was verified against the client CAs.
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		m.h.WriteError(rw, r, herodot.ErrUnauthorized.WithReason("The request does not contain a verified client certificate."))
+		return
+	}
+
+	cert := r.TLS.VerifiedChains[0][0]
+	if !m.any && !m.isAllowed(cert) {
+		m.h.WriteError(rw, r, herodot.ErrForbidden.
+			WithReason("The client certificate is not allowed to access this resource.").
+			WithDebugf("The client certificate identities %v are not in the allow-list.", ClientCertificateIdentities(cert)))
+		return
+	}
+
+	next(rw, r.WithContext(ContextWithClientCertificate(r.Context(), cert)))
+}
+
+func (m *ClientCertificateMiddleware) isAllowed(cert *x509.Certificate) bool {
+	for _, name := range cert.DNSNames {
+		if m.allowedDNS[strings.ToLower(name)] {
+			return true
+		}
+	}
+	for _, id := range ClientCertificateIdentities(cert) {
+		if m.allowed[id] {
+			return true
+		}
+	}
+	return false
+}
+
+func hasSubjectAltNames(cert *x509.Certificate) bool {
+	return len(cert.DNSNames)+len(cert.EmailAddresses)+len(cert.IPAddresses)+len(cert.URIs) > 0
+}
+
+// ClientCertificateIdentities returns the DNS, email, IP, and URI subject alternative names of the certificate. The
+// common name is only returned if the certificate has no subject alternative names, as required by RFC 6125.
+func ClientCertificateIdentities(cert *x509.Certificate) []string {
+	ids := make([]string, 0, len(cert.DNSNames)+len(cert.EmailAddresses)+len(cert.IPAddresses)+len(cert.URIs)+1)
+	ids = append(ids, cert.DNSNames...)
+	ids = append(ids, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		ids = append(ids, ip.String())
+	}
+	for _, u := range cert.URIs {
+		ids = append(ids, u.String())
+	}
+	if cert.Subject.CommonName != "" && !hasSubjectAltNames(cert) {
+		ids = append(ids, cert.Subject.CommonName)
+	}
+	return ids
+}
+
+// ContextWithClientCertificate returns a context containing the client certificate.
+func ContextWithClientCertificate(ctx context.Context, cert *x509.Certificate) context.Context {
+	return context.WithValue(ctx, clientCertificateContextKey, cert)
+}
+
+// ClientCertificateFromContext returns the client certificate added by the ClientCertificateMiddleware or nil if
+// there is none.
+func ClientCertificateFromContext(ctx context.Context) *x509.Certificate {
+	cert, _ := ctx.Value(clientCertificateContextKey).(*x509.Certificate)
+	return cert
+}
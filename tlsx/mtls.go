@@ -0,0 +1,285 @@
+package tlsx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNoClientCAsConfigured is returned when client certificates should be verified but no client CAs were configured.
+var ErrNoClientCAsConfigured = errors.New("client certificates should be verified but no client certificate authorities were configured")
+
+// ClientAuthTypes maps the names accepted by ParseClientAuthType to their tls.ClientAuthType.
+var ClientAuthTypes = map[string]tls.ClientAuthType{
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require":            tls.RequireAnyClientCert,
+	"verify-if-given":    tls.VerifyClientCertIfGiven,
+	"require-and-verify": tls.RequireAndVerifyClientCert,
+}
+
+// TLSVersions maps the names accepted by ParseTLSVersion to their version constant.
+var TLSVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// DefaultCipherSuites are the TLS 1.2 cipher suites used by NewServerConfig unless configured otherwise. They all
+// provide forward secrecy and authenticated encryption. TLS 1.3 cipher suites are not configurable.
+var DefaultCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+}
+
+// ParseClientAuthType parses one of none, request, require, verify-if-given, and require-and-verify.
+func ParseClientAuthType(name string) (tls.ClientAuthType, error) {
+	t, ok := ClientAuthTypes[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return 0, errors.Errorf("unknown client authentication type %q, expected one of none, request, require, verify-if-given, require-and-verify", name)
+	}
+	return t, nil
+}
+
+// ParseTLSVersion parses a TLS version such as 1.2 or 1.3.
+func ParseTLSVersion(name string) (uint16, error) {
+	v, ok := TLSVersions[strings.TrimPrefix(strings.TrimSpace(name), "TLS")]
+	if !ok {
+		return 0, errors.Errorf("unknown TLS version %q, expected one of 1.0, 1.1, 1.2, 1.3", name)
+	}
+	return v, nil
+}
+
+// ParseCipherSuites parses cipher suite names as returned by tls.CipherSuiteName, e.g.
+// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. Insecure cipher suites are rejected.
+func ParseCipherSuites(names ...string) ([]uint16, error) {
+	known := make(map[string]uint16)
+	for _, s := range tls.CipherSuites() {
+		known[s.Name] = s.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		id, ok := known[name]
+		if !ok {
+			return nil, errors.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// ClientCAPool loads client certificate authorities from a base64 encoded PEM bundle or from the PEM bundle at
+// the path. Both may be set, in which case the pool contains the certificates of both bundles.
+func ClientCAPool(caString, caPath string) (*x509.CertPool, error) {
+	if caString == "" && caPath == "" {
+		return nil, errors.WithStack(ErrNoClientCAsConfigured)
+	}
+
+	pool := x509.NewCertPool()
+	if caString != "" {
+		bundle, err := base64.StdEncoding.DecodeString(caString)
+		if err != nil {
+			return nil, fmt.Errorf("unable to base64 decode the client certificate authorities: %v", err)
+		}
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, errors.New("unable to load the client certificate authorities: no PEM encoded certificate was found")
+		}
+	}
+
+	if caPath != "" {
+		bundle, err := ioutil.ReadFile(caPath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load the client certificate authorities from file: %v", err)
+		}
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("unable to load the client certificate authorities from file %s: no PEM encoded certificate was found", caPath)
+		}
+	}
+
+	return pool, nil
+}
+
+type serverConfigOptions struct {
+	certificates   []tls.Certificate
+	getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	clientCAs      *x509.CertPool
+	clientAuth     *tls.ClientAuthType
+	minVersion     uint16
+	cipherSuites   []uint16
+}
+
+// ServerConfigOption configures NewServerConfig.
+type ServerConfigOption func(*serverConfigOptions)
+
+// ServerConfigWithCertificates sets the server certificates.
+func ServerConfigWithCertificates(certs ...tls.Certificate) ServerConfigOption {
+	return func(o *serverConfigOptions) {
+		o.certificates = certs
+	}
+}
+
+// ServerConfigWithCertificateProvider serves the certificate of the provider which is reloaded when it changes.
+func ServerConfigWithCertificateProvider(p *CertificateProvider) ServerConfigOption {
+	return func(o *serverConfigOptions) {
+		o.getCertificate = p.GetCertificate
+	}
+}
+
+// ServerConfigWithClientCAs sets the certificate authorities used to verify client certificates. If the client
+// authentication type is not set explicitly, client certificates are required and verified.
+func ServerConfigWithClientCAs(pool *x509.CertPool) ServerConfigOption {
+	return func(o *serverConfigOptions) {
+		o.clientCAs = pool
+	}
+}
+
+// ServerConfigWithClientAuth sets the client authentication type.
+func ServerConfigWithClientAuth(t tls.ClientAuthType) ServerConfigOption {
+	return func(o *serverConfigOptions) {
+		o.clientAuth = &t
+	}
+}
+
+// ServerConfigWithMinVersion sets the minimum TLS version. The default is TLS 1.2.
+func ServerConfigWithMinVersion(v uint16) ServerConfigOption {
+	return func(o *serverConfigOptions) {
+		o.minVersion = v
+	}
+}
+
+// ServerConfigWithCipherSuites sets the allowed TLS 1.2 cipher suites. The default is DefaultCipherSuites.
+func ServerConfigWithCipherSuites(suites ...uint16) ServerConfigOption {
+	return func(o *serverConfigOptions) {
+		o.cipherSuites = suites
+	}
+}
+
+// NewServerConfig returns a TLS server configuration. Client certificates are required and verified if client
+// CAs are configured, which makes this a mutual TLS configuration.
+func NewServerConfig(opts ...ServerConfigOption) (*tls.Config, error) {
+	o := &serverConfigOptions{
+		minVersion:   tls.VersionTLS12,
+		cipherSuites: DefaultCipherSuites,
+	}
+	for _, f := range opts {
+		f(o)
+	}
+
+	if len(o.certificates) == 0 && o.getCertificate == nil {
+		return nil, errors.WithStack(ErrNoCertificatesConfigured)
+	}
+
+	clientAuth := tls.NoClientCert
+	if o.clientCAs != nil {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+	if o.clientAuth != nil {
+		clientAuth = *o.clientAuth
+	}
+	if (clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert) && o.clientCAs == nil {
+		return nil, errors.WithStack(ErrNoClientCAsConfigured)
+	}
+
+	return &tls.Config{
+		Certificates:   o.certificates,
+		GetCertificate: o.getCertificate,
+		ClientCAs:      o.clientCAs,
+		ClientAuth:     clientAuth,
+		MinVersion:     o.minVersion,
+		CipherSuites:   o.cipherSuites,
+	}, nil
+}
+
+// ServerConfigFromEnv returns a TLS server configuration using the certificate and client certificate settings
+// from the environment variables with the given prefix. See ServerConfigHelpMessage for the supported variables.
+// Additional options are applied after the environment variables and take precedence.
+func ServerConfigFromEnv(prefix string, opts ...ServerConfigOption) (*tls.Config, error) {
+	certs, err := Certificate(
+		os.Getenv(prefix+"_CERT"), os.Getenv(prefix+"_KEY"),
+		os.Getenv(prefix+"_CERT_PATH"), os.Getenv(prefix+"_KEY_PATH"),
+		CertificateWithPassphraseFromEnv(prefix),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	env := []ServerConfigOption{ServerConfigWithCertificates(certs...)}
+
+	if caString, caPath := os.Getenv(prefix+"_CLIENT_CA"), os.Getenv(prefix+"_CLIENT_CA_PATH"); caString != "" || caPath != "" {
+		pool, err := ClientCAPool(caString, caPath)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, ServerConfigWithClientCAs(pool))
+	}
+
+	if v := os.Getenv(prefix + "_CLIENT_AUTH"); v != "" {
+		t, err := ParseClientAuthType(v)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, ServerConfigWithClientAuth(t))
+	}
+
+	if v := os.Getenv(prefix + "_MIN_VERSION"); v != "" {
+		version, err := ParseTLSVersion(v)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, ServerConfigWithMinVersion(version))
+	}
+
+	if v := os.Getenv(prefix + "_CIPHER_SUITES"); v != "" {
+		suites, err := ParseCipherSuites(strings.Split(v, ",")...)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, ServerConfigWithCipherSuites(suites...))
+	}
+
+	return NewServerConfig(append(env, opts...)...)
+}
+
+// HTTPSServerConfig returns a TLS server configuration for HTTP over TLS by looking at environment variables.
+func HTTPSServerConfig(opts ...ServerConfigOption) (*tls.Config, error) {
+	return ServerConfigFromEnv("HTTPS_TLS", opts...)
+}
+
+// ServerConfigHelpMessage returns a help message for configuring TLS servers including mutual TLS.
+func ServerConfigHelpMessage(prefix string) string {
+	return CertificateHelpMessage(prefix) + `
+- ` + prefix + `_CLIENT_CA_PATH: The path to the certificate authorities (pem encoded) used to verify client certificates.
+	Setting this enables mutual TLS.
+	Example: ` + prefix + `_CLIENT_CA_PATH=~/ca.pem
+
+- ` + prefix + `_CLIENT_CA: Base64 encoded (without padding) string of the certificate authorities (PEM encoded) used to verify client certificates.
+	Setting this enables mutual TLS.
+	Example: ` + prefix + `_CLIENT_CA="-----BEGIN CERTIFICATE-----\nMIIDZTCCAk2gAwIBAgIEV5xOtDANBgkqhkiG9w0BAQ0FADA0MTIwMAYDVQQDDClP..."
+
+- ` + prefix + `_CLIENT_AUTH: One of none, request, require, verify-if-given, require-and-verify. Defaults to
+	require-and-verify if client certificate authorities are configured and to none otherwise.
+	Example: ` + prefix + `_CLIENT_AUTH=verify-if-given
+
+- ` + prefix + `_MIN_VERSION: The minimum TLS version, one of 1.0, 1.1, 1.2, 1.3. Defaults to 1.2.
+	Example: ` + prefix + `_MIN_VERSION=1.3
+
+- ` + prefix + `_CIPHER_SUITES: A comma separated list of the allowed TLS 1.2 cipher suites. Defaults to ECDHE with AES-GCM or ChaCha20-Poly1305.
+	Example: ` + prefix + `_CIPHER_SUITES=TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384
+`
+}
@@ -0,0 +1,240 @@
+package tlsx
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/negroni"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/logrusx"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})}
+}
+
+func (ca *testCA) issue(t *testing.T, cn string, usage x509.ExtKeyUsage, dnsNames ...string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		DNSNames:     dnsNames,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestParsers(t *testing.T) {
+	ca, err := ParseClientAuthType("Require-And-Verify")
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, ca)
+	_, err = ParseClientAuthType("always")
+	assert.Error(t, err)
+
+	v, err := ParseTLSVersion("1.3")
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), v)
+	_, err = ParseTLSVersion("2.0")
+	assert.Error(t, err)
+
+	suites, err := ParseCipherSuites("TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", " ")
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, suites)
+	_, err = ParseCipherSuites("TLS_RSA_WITH_RC4_128_SHA")
+	assert.Error(t, err)
+}
+
+func TestNewServerConfig(t *testing.T) {
+	ca := newTestCA(t)
+	server := ca.issue(t, "server", x509.ExtKeyUsageServerAuth, "localhost")
+
+	t.Run("case=requires certificates", func(t *testing.T) {
+		_, err := NewServerConfig()
+		assert.Error(t, err)
+	})
+
+	t.Run("case=requires client CAs for verification", func(t *testing.T) {
+		_, err := NewServerConfig(ServerConfigWithCertificates(server), ServerConfigWithClientAuth(tls.RequireAndVerifyClientCert))
+		assert.Error(t, err)
+	})
+
+	t.Run("case=defaults", func(t *testing.T) {
+		c, err := NewServerConfig(ServerConfigWithCertificates(server))
+		require.NoError(t, err)
+		assert.Equal(t, tls.NoClientCert, c.ClientAuth)
+		assert.Equal(t, uint16(tls.VersionTLS12), c.MinVersion)
+		assert.Equal(t, DefaultCipherSuites, c.CipherSuites)
+
+		pool := x509.NewCertPool()
+		pool.AddCert(ca.cert)
+		c, err = NewServerConfig(ServerConfigWithCertificates(server), ServerConfigWithClientCAs(pool))
+		require.NoError(t, err)
+		assert.Equal(t, tls.RequireAndVerifyClientCert, c.ClientAuth)
+	})
+
+	t.Run("case=from env", func(t *testing.T) {
+		dir := t.TempDir()
+		certPath, keyPath, caPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem")
+		writeKeyPair(t, certPath, keyPath)
+		require.NoError(t, ioutil.WriteFile(caPath, ca.pem, 0600))
+
+		for k, v := range map[string]string{
+			"TLSX_MTLS_CERT_PATH":     certPath,
+			"TLSX_MTLS_KEY_PATH":      keyPath,
+			"TLSX_MTLS_CLIENT_CA":     base64.StdEncoding.EncodeToString(ca.pem),
+			"TLSX_MTLS_CLIENT_AUTH":   "verify-if-given",
+			"TLSX_MTLS_MIN_VERSION":   "1.3",
+			"TLSX_MTLS_CIPHER_SUITES": "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+		} {
+			require.NoError(t, os.Setenv(k, v))
+			defer os.Unsetenv(k)
+		}
+
+		c, err := ServerConfigFromEnv("TLSX_MTLS")
+		require.NoError(t, err)
+		assert.Len(t, c.Certificates, 1)
+		assert.NotNil(t, c.ClientCAs)
+		assert.Equal(t, tls.VerifyClientCertIfGiven, c.ClientAuth)
+		assert.Equal(t, uint16(tls.VersionTLS13), c.MinVersion)
+		assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}, c.CipherSuites)
+
+		require.NoError(t, os.Setenv("TLSX_MTLS_CLIENT_CA_PATH", filepath.Join(dir, "does-not-exist")))
+		defer os.Unsetenv("TLSX_MTLS_CLIENT_CA_PATH")
+		_, err = ServerConfigFromEnv("TLSX_MTLS")
+		assert.Error(t, err)
+	})
+}
+
+func TestClientCertificateMiddleware(t *testing.T) {
+	ca := newTestCA(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	config, err := NewServerConfig(
+		ServerConfigWithCertificates(ca.issue(t, "server", x509.ExtKeyUsageServerAuth, "localhost")),
+		ServerConfigWithClientCAs(pool),
+		ServerConfigWithClientAuth(tls.VerifyClientCertIfGiven),
+	)
+	require.NoError(t, err)
+
+	n := negroni.New(NewClientCertificateMiddleware(herodot.NewJSONWriter(logrusx.New("", "")), "spiffe-service", "api.internal"))
+	n.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, ClientCertificateFromContext(r.Context()).Subject.CommonName)
+	})
+
+	ts := httptest.NewUnstartedServer(n)
+	ts.TLS = config
+	ts.StartTLS()
+	defer ts.Close()
+
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      pool,
+			Certificates: certs,
+			ServerName:   "localhost",
+		}}}
+	}
+
+	for k, tc := range []struct {
+		certs    []tls.Certificate
+		code     int
+		expected string
+	}{
+		{code: http.StatusUnauthorized},
+		{certs: []tls.Certificate{ca.issue(t, "other", x509.ExtKeyUsageClientAuth)}, code: http.StatusForbidden},
+		{certs: []tls.Certificate{ca.issue(t, "spiffe-service", x509.ExtKeyUsageClientAuth)}, code: http.StatusOK, expected: "spiffe-service"},
+		{certs: []tls.Certificate{ca.issue(t, "by-san", x509.ExtKeyUsageClientAuth, "API.internal")}, code: http.StatusOK, expected: "by-san"},
+		{certs: []tls.Certificate{ca.issue(t, "spiffe-service", x509.ExtKeyUsageClientAuth, "other.internal")}, code: http.StatusForbidden},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			res, err := client(tc.certs...).Get(ts.URL)
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			body, err := ioutil.ReadAll(res.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tc.code, res.StatusCode, "%s", body)
+			if tc.code == http.StatusOK {
+				assert.Equal(t, tc.expected, string(body))
+			}
+		})
+	}
+
+	t.Run("case=rejects certificates from other CAs", func(t *testing.T) {
+		other := newTestCA(t)
+		_, err := client(other.issue(t, "spiffe-service", x509.ExtKeyUsageClientAuth)).Get(ts.URL)
+		assert.Error(t, err)
+	})
+}
+
+func TestClientCertificateIdentities(t *testing.T) {
+	spiffe, err := url.Parse("spiffe://example.org/Service")
+	require.NoError(t, err)
+
+	m := NewClientCertificateMiddleware(nil, "spiffe://example.org/Service", "API.internal")
+	for k, tc := range []struct {
+		cert    *x509.Certificate
+		ids     []string
+		allowed bool
+	}{
+		{cert: &x509.Certificate{Subject: pkix.Name{CommonName: "API.internal"}}, ids: []string{"API.internal"}, allowed: true},
+		{cert: &x509.Certificate{Subject: pkix.Name{CommonName: "api.internal"}}, ids: []string{"api.internal"}},
+		{cert: &x509.Certificate{Subject: pkix.Name{CommonName: "API.internal"}, DNSNames: []string{"other.internal"}}, ids: []string{"other.internal"}},
+		{cert: &x509.Certificate{DNSNames: []string{"api.INTERNAL"}}, ids: []string{"api.INTERNAL"}, allowed: true},
+		{cert: &x509.Certificate{URIs: []*url.URL{spiffe}}, ids: []string{"spiffe://example.org/Service"}, allowed: true},
+		{cert: &x509.Certificate{URIs: []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: "/service"}}}, ids: []string{"spiffe://example.org/service"}},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			assert.Equal(t, tc.ids, ClientCertificateIdentities(tc.cert))
+			assert.Equal(t, tc.allowed, m.isAllowed(tc.cert))
+		})
+	}
+}
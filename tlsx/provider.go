@@ -0,0 +1,166 @@
+package tlsx
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/josex"
+	"github.com/ory/x/watcherx"
+)
+
+// CertificateProvider serves a TLS certificate from a certificate and key file and reloads it whenever one of
+// the files changes. This allows renewing certificates, e.g. using cert-manager, without restarting the process.
+type CertificateProvider struct {
+	certPath, keyPath string
+	passphrase        josex.PassphraseSource
+	onReload          func(*tls.Certificate)
+	onError           func(error)
+
+	cert atomic.Value
+	mu   sync.Mutex
+}
+
+// CertificateProviderOption configures a CertificateProvider.
+type CertificateProviderOption func(*CertificateProvider)
+
+// CertificateProviderWithPassphrase sets the source of the passphrase which is used if the private key is encrypted.
+func CertificateProviderWithPassphrase(passphrase josex.PassphraseSource) CertificateProviderOption {
+	return func(p *CertificateProvider) {
+		p.passphrase = passphrase
+	}
+}
+
+// CertificateProviderWithErrorHandler sets a callback which is called when the certificate could not be reloaded.
+// The previous certificate continues to be served in that case.
+func CertificateProviderWithErrorHandler(onError func(error)) CertificateProviderOption {
+	return func(p *CertificateProvider) {
+		p.onError = onError
+	}
+}
+
+// CertificateProviderWithReloadHandler sets a callback which is called after the certificate was reloaded.
+func CertificateProviderWithReloadHandler(onReload func(*tls.Certificate)) CertificateProviderOption {
+	return func(p *CertificateProvider) {
+		p.onReload = onReload
+	}
+}
+
+// NewCertificateProvider loads the certificate and key from the given paths and watches both files for changes
+// until the context is canceled. It fails if the initial key pair can not be loaded.
+func NewCertificateProvider(ctx context.Context, certPath, keyPath string, opts ...CertificateProviderOption) (*CertificateProvider, error) {
+	p := &CertificateProvider{
+		certPath: certPath,
+		keyPath:  keyPath,
+		onReload: func(*tls.Certificate) {},
+		onError:  func(error) {},
+	}
+	for _, o := range opts {
+		o(p)
+	}
+
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+
+	// Stops the certificate watcher if the key watcher can not be started.
+	ctx, cancel := context.WithCancel(ctx)
+
+	certEvents, keyEvents := make(watcherx.EventChannel), make(watcherx.EventChannel)
+	if _, err := watcherx.WatchFile(ctx, certPath, certEvents); err != nil {
+		cancel()
+		return nil, err
+	}
+	if _, err := watcherx.WatchFile(ctx, keyPath, keyEvents); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	go func() {
+		defer cancel()
+		p.watch(certEvents, keyEvents)
+	}()
+	return p, nil
+}
+
+func (p *CertificateProvider) watch(certEvents, keyEvents watcherx.EventChannel) {
+	// Both channels are closed by the watchers once the context is canceled.
+	for certEvents != nil || keyEvents != nil {
+		var e watcherx.Event
+		var ok bool
+		select {
+		case e, ok = <-certEvents:
+			if !ok {
+				certEvents = nil
+				continue
+			}
+		case e, ok = <-keyEvents:
+			if !ok {
+				keyEvents = nil
+				continue
+			}
+		}
+
+		switch et := e.(type) {
+		case *watcherx.ChangeEvent:
+			// Certificate and key are usually not replaced at the same time, so the first event might see a
+			// mismatching pair. It is reported and the second event will load the new pair.
+			if err := p.Reload(); err != nil {
+				p.onError(err)
+			}
+		case *watcherx.RemoveEvent:
+			p.onError(errors.Errorf("the file %s was removed, continuing to serve the previous certificate", et.Source()))
+		case *watcherx.ErrorEvent:
+			p.onError(et)
+		}
+	}
+}
+
+// Reload reads and validates the key pair and replaces the served certificate if it is valid. Otherwise the
+// previous certificate is kept and the error is returned.
+func (p *CertificateProvider) Reload() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	certPEM, err := ioutil.ReadFile(p.certPath)
+	if err != nil {
+		return errors.Wrap(err, "unable to read the TLS certificate")
+	}
+	keyPEM, err := ioutil.ReadFile(p.keyPath)
+	if err != nil {
+		return errors.Wrap(err, "unable to read the TLS private key")
+	}
+
+	cert, err := x509KeyPair(certPEM, keyPEM, p.passphrase)
+	if err != nil {
+		return errors.Wrap(err, "unable to load X509 key pair from files")
+	}
+
+	p.cert.Store(&cert)
+	p.onReload(&cert)
+	return nil
+}
+
+// Certificate returns the currently served certificate.
+func (p *CertificateProvider) Certificate() *tls.Certificate {
+	return p.cert.Load().(*tls.Certificate)
+}
+
+// Certificates returns the currently served certificate. It can be used as a CertificateSource.
+func (p *CertificateProvider) Certificates() []tls.Certificate {
+	return []tls.Certificate{*p.Certificate()}
+}
+
+// GetCertificate can be used as tls.Config.GetCertificate.
+func (p *CertificateProvider) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return p.Certificate(), nil
+}
+
+// TLSConfig returns a TLS configuration which serves the certificate of the provider.
+func (p *CertificateProvider) TLSConfig() *tls.Config {
+	return &tls.Config{GetCertificate: p.GetCertificate}
+}
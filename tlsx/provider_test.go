@@ -0,0 +1,82 @@
+package tlsx
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeKeyPair(t *testing.T, certPath, keyPath string) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	c, err := CreateSelfSignedCertificate(key)
+	require.NoError(t, err)
+	block, err := PEMBlockForKey(key)
+	require.NoError(t, err)
+
+	if certPath != "" {
+		require.NoError(t, ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}), 0600))
+	}
+	if keyPath != "" {
+		require.NoError(t, ioutil.WriteFile(keyPath, pem.EncodeToMemory(block), 0600))
+	}
+	return key
+}
+
+func TestCertificateProvider(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	t.Run("case=fails if the initial key pair is invalid", func(t *testing.T) {
+		_, err := NewCertificateProvider(ctx, certPath, keyPath)
+		require.Error(t, err)
+	})
+
+	first := writeKeyPair(t, certPath, keyPath)
+
+	var l sync.Mutex
+	var errs []error
+	p, err := NewCertificateProvider(ctx, certPath, keyPath, CertificateProviderWithErrorHandler(func(err error) {
+		l.Lock()
+		defer l.Unlock()
+		errs = append(errs, err)
+	}))
+	require.NoError(t, err)
+
+	cert, err := p.TLSConfig().GetCertificate(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	assert.True(t, first.Equal(cert.PrivateKey))
+
+	t.Run("case=keeps the certificate if the new pair is invalid", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(keyPath, []byte("not a key"), 0600))
+
+		assert.Eventually(t, func() bool {
+			l.Lock()
+			defer l.Unlock()
+			return len(errs) > 0
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.True(t, first.Equal(p.Certificate().PrivateKey))
+	})
+
+	t.Run("case=reloads the certificate", func(t *testing.T) {
+		second := writeKeyPair(t, certPath, keyPath)
+
+		assert.Eventually(t, func() bool {
+			return second.Equal(p.Certificate().PrivateKey)
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+}
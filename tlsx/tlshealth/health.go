@@ -0,0 +1,19 @@
+// Package tlshealth provides health checks for the certificates managed by tlsx. It is separate from tlsx so that
+// tlsx does not depend on healthx.
+package tlshealth
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ory/x/healthx"
+	"github.com/ory/x/tlsx"
+)
+
+// ExpiryReadyChecker returns a healthx.ReadyChecker which fails if a certificate can not be parsed, is expired, or
+// expires within d, for example 14 * 24 * time.Hour.
+func ExpiryReadyChecker(certs tlsx.CertificateSource, d time.Duration) healthx.ReadyChecker {
+	return func(*http.Request) error {
+		return tlsx.CheckExpiry(certs(), d)
+	}
+}
@@ -0,0 +1,24 @@
+package tlshealth
+
+import (
+	"crypto/tls"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/x/tlsx"
+)
+
+func TestExpiryReadyChecker(t *testing.T) {
+	ca, err := tlsx.NewCA()
+	require.NoError(t, err)
+	cert, err := ca.Issue(tlsx.LeafWithHosts("example.local"), tlsx.LeafWithValidity(48*time.Hour))
+	require.NoError(t, err)
+
+	assert.NoError(t, ExpiryReadyChecker(tlsx.StaticCertificates(*cert), 24*time.Hour)(new(http.Request)))
+	assert.Error(t, ExpiryReadyChecker(tlsx.StaticCertificates(*cert), 72*time.Hour)(new(http.Request)))
+	assert.Error(t, ExpiryReadyChecker(tlsx.StaticCertificates(tls.Certificate{Certificate: [][]byte{[]byte("not a certificate")}}), 24*time.Hour)(new(http.Request)))
+}
@@ -4,6 +4,10 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 type (
@@ -54,13 +58,33 @@ func (d *dispatcher) DispatchNow() (<-chan int, error) {
 	return d.done, nil
 }
 
+// Watch starts a watcher for the given URL. Supported schemes are `file`, `ws`, `wss`, `http`, and `https`.
+//
+// Files are watched using fsnotify unless the `poll` query parameter is set to a duration
+// (e.g. `file:///etc/config.yml?poll=5s`), in which case the file is polled in that interval. If the path is a
+// directory, it is polled using WatchDirectoryPolling.
+// HTTP(S) URLs are always polled, by default every 30 seconds. The `poll` query parameter is
+// removed from the URL before it is requested.
 func Watch(ctx context.Context, u *url.URL, c EventChannel) (Watcher, error) {
 	switch u.Scheme {
 	// see urlx.Parse for why the empty string is also file
 	case "file", "":
+		if poll := u.Query().Get("poll"); poll != "" {
+			interval, err := time.ParseDuration(poll)
+			if err != nil {
+				close(c)
+				return nil, errors.Wrapf(err, "unable to parse poll interval %q", poll)
+			}
+			if info, err := os.Stat(u.Path); err == nil && info.IsDir() {
+				return WatchDirectoryPolling(ctx, u.Path, interval, c)
+			}
+			return WatchFilePolling(ctx, u.Path, interval, c)
+		}
 		return WatchFile(ctx, u.Path, c)
-	case "ws":
+	case "ws", "wss":
 		return WatchWebsocket(ctx, u, c)
+	case "http", "https":
+		return watchHTTPURL(ctx, u, c)
 	}
 	return nil, &errSchemeUnknown{u.Scheme}
 }
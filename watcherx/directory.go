@@ -11,9 +11,16 @@ import (
 	"github.com/pkg/errors"
 )
 
-func WatchDirectory(ctx context.Context, dir string, c EventChannel) (Watcher, error) {
+func WatchDirectory(ctx context.Context, dir string, c EventChannel, opts ...DirectoryOption) (Watcher, error) {
+	o, err := newDirectoryOptions(opts)
+	if err != nil {
+		close(c)
+		return nil, err
+	}
+
 	w, err := fsnotify.NewWatcher()
 	if err != nil {
+		close(c)
 		return nil, errors.WithStack(err)
 	}
 	var subDirs []string
@@ -26,20 +33,24 @@ func WatchDirectory(ctx context.Context, dir string, c EventChannel) (Watcher, e
 		}
 		return nil
 	}); err != nil {
+		_ = w.Close()
+		close(c)
 		return nil, errors.WithStack(err)
 	}
 	for _, d := range append(subDirs, dir) {
 		if err := w.Add(d); err != nil {
+			_ = w.Close()
+			close(c)
 			return nil, errors.WithStack(err)
 		}
 	}
 
 	d := newDispatcher()
-	go streamDirectoryEvents(ctx, w, c, d.trigger, d.done, dir)
+	go streamDirectoryEvents(ctx, w, o.events(ctx, dir, c), c, d.trigger, d.done, dir, o)
 	return d, nil
 }
 
-func handleEvent(e fsnotify.Event, w *fsnotify.Watcher, c EventChannel) {
+func handleEvent(ctx context.Context, e fsnotify.Event, w *fsnotify.Watcher, c EventChannel) {
 	if e.Op&fsnotify.Remove != 0 {
 		// We cannot figure out anymore if it was a file or directory.
 		// If it was a directory it was added to the watchers as well as it's parent.
@@ -49,91 +60,105 @@ func handleEvent(e fsnotify.Event, w *fsnotify.Watcher, c EventChannel) {
 		// This means that file deletion events are delayed by 1ms.
 		select {
 		case <-time.After(time.Millisecond):
-			c <- &RemoveEvent{
+			send(ctx, c, &RemoveEvent{
 				source: source(e.Name),
-			}
+			})
 			return
 		case secondE := <-w.Events:
 			if (secondE.Name != "" && secondE.Name != e.Name) || secondE.Op&fsnotify.Remove == 0 {
 				// this is NOT the unix.IN_DELETE_SELF event => we have to handle the first explicitly
 				// and the second recursively because it might be the first event of a directory deletion
-				c <- &RemoveEvent{
+				if !send(ctx, c, &RemoveEvent{
 					source: source(e.Name),
+				}) {
+					return
 				}
-				handleEvent(secondE, w, c)
+				handleEvent(ctx, secondE, w, c)
 			} // else we do not want any event on deletion of a folder
 		}
 	} else if e.Op&(fsnotify.Write|fsnotify.Create) != 0 {
 		if stats, err := os.Stat(e.Name); err != nil {
-			c <- &ErrorEvent{
+			send(ctx, c, &ErrorEvent{
 				error:  errors.WithStack(err),
 				source: source(e.Name),
-			}
+			})
 			return
 		} else if stats.IsDir() {
 			if err := w.Add(e.Name); err != nil {
-				c <- &ErrorEvent{
+				send(ctx, c, &ErrorEvent{
 					error:  errors.WithStack(err),
 					source: source(e.Name),
-				}
+				})
 			}
 			return
 		}
 		data, err := ioutil.ReadFile(e.Name)
 		if err != nil {
-			c <- &ErrorEvent{
+			send(ctx, c, &ErrorEvent{
 				error:  err,
 				source: source(e.Name),
-			}
+			})
 		} else {
-			c <- &ChangeEvent{
+			send(ctx, c, &ChangeEvent{
 				data:   data,
 				source: source(e.Name),
-			}
+			})
 		}
 	}
 }
 
-func streamDirectoryEvents(ctx context.Context, w *fsnotify.Watcher, c EventChannel, sendNow <-chan struct{}, sendNowDone chan<- int, dir string) {
+// streamDirectoryEvents sends fsnotify events to events, which might be filtered and debounced, while
+// events requested through DispatchNow are sent to c directly.
+func streamDirectoryEvents(ctx context.Context, w *fsnotify.Watcher, events, c EventChannel, sendNow <-chan struct{}, sendNowDone chan<- int, dir string, o *directoryOptions) {
 	for {
 		select {
 		case <-ctx.Done():
 			_ = w.Close()
 			return
 		case e := <-w.Events:
-			handleEvent(e, w, c)
+			handleEvent(ctx, e, w, events)
 		case <-sendNow:
-			var eventsSent int
+			sendNowDone <- sendDirectoryContent(ctx, dir, c, o)
+		}
+	}
+}
 
-			if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-				if err != nil {
-					return err
-				}
-				if !info.IsDir() {
-					data, err := ioutil.ReadFile(path)
-					if err != nil {
-						c <- &ErrorEvent{
-							error:  err,
-							source: source(path),
-						}
-					} else {
-						c <- &ChangeEvent{
-							data:   data,
-							source: source(path),
-						}
-					}
-					eventsSent++
-				}
-				return nil
-			}); err != nil {
-				c <- &ErrorEvent{
+// sendDirectoryContent sends a ChangeEvent for every matching file in the directory and returns the number of events sent.
+func sendDirectoryContent(ctx context.Context, dir string, c EventChannel, o *directoryOptions) int {
+	var eventsSent int
+
+	if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && o.matches(dir, path) {
+			var e Event
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				e = &ErrorEvent{
 					error:  err,
-					source: source(dir),
+					source: source(path),
+				}
+			} else {
+				e = &ChangeEvent{
+					data:   data,
+					source: source(path),
 				}
-				eventsSent++
 			}
-
-			sendNowDone <- eventsSent
+			if !send(ctx, c, e) {
+				return ctx.Err()
+			}
+			eventsSent++
+		}
+		return nil
+	}); err != nil && ctx.Err() == nil {
+		if send(ctx, c, &ErrorEvent{
+			error:  err,
+			source: source(dir),
+		}) {
+			eventsSent++
 		}
 	}
+
+	return eventsSent
 }
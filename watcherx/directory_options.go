@@ -0,0 +1,200 @@
+package watcherx
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v2"
+	"github.com/pkg/errors"
+)
+
+type (
+	directoryOptions struct {
+		debounce time.Duration
+		coalesce bool
+		include  []string
+		exclude  []string
+	}
+
+	// DirectoryOption configures WatchDirectory and WatchDirectoryPolling.
+	DirectoryOption func(*directoryOptions)
+)
+
+// DirectoryWithDebounce delays events until no further event was observed for the given window.
+// All events collected in the window are sent at once. This is useful because editors or a `git checkout`
+// cause a storm of events.
+func DirectoryWithDebounce(window time.Duration) DirectoryOption {
+	return func(o *directoryOptions) {
+		o.debounce = window
+	}
+}
+
+// DirectoryWithCoalescing only sends the most recent event per file that was observed in the debounce window.
+// It has no effect without DirectoryWithDebounce.
+func DirectoryWithCoalescing() DirectoryOption {
+	return func(o *directoryOptions) {
+		o.coalesce = true
+	}
+}
+
+// DirectoryWithIncludeGlobs only sends events for files that match at least one of the patterns. The patterns
+// use the doublestar syntax (e.g. `**/*.yml`) and are matched against the slash separated path relative to the
+// watched directory.
+func DirectoryWithIncludeGlobs(patterns ...string) DirectoryOption {
+	return func(o *directoryOptions) {
+		o.include = append(o.include, patterns...)
+	}
+}
+
+// DirectoryWithExcludeGlobs drops events for files that match any of the patterns. Excludes take precedence
+// over includes. See DirectoryWithIncludeGlobs for the pattern syntax.
+func DirectoryWithExcludeGlobs(patterns ...string) DirectoryOption {
+	return func(o *directoryOptions) {
+		o.exclude = append(o.exclude, patterns...)
+	}
+}
+
+func newDirectoryOptions(opts []DirectoryOption) (*directoryOptions, error) {
+	o := new(directoryOptions)
+	for _, f := range opts {
+		f(o)
+	}
+
+	// doublestar parses patterns lazily, matching a pattern against itself makes it parse all components.
+	for _, pattern := range append(o.include, o.exclude...) {
+		if _, err := doublestar.Match(pattern, pattern); err != nil {
+			return nil, errors.Wrapf(err, "invalid glob pattern %q", pattern)
+		}
+	}
+
+	return o, nil
+}
+
+// matches returns true if the file at path should be reported.
+func (o *directoryOptions) matches(dir, path string) bool {
+	if len(o.include) == 0 && len(o.exclude) == 0 {
+		return true
+	}
+
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+
+	for _, pattern := range o.exclude {
+		if ok, _ := doublestar.Match(pattern, rel); ok {
+			return false
+		}
+	}
+
+	if len(o.include) == 0 {
+		return true
+	}
+
+	for _, pattern := range o.include {
+		if ok, _ := doublestar.Match(pattern, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// keep returns false if the event should be dropped. Errors are never dropped.
+func (o *directoryOptions) keep(dir string, e Event) bool {
+	if _, ok := e.(*ErrorEvent); ok {
+		return true
+	}
+	return o.matches(dir, e.Source())
+}
+
+// events returns the channel the directory watcher should send events to. If filtering or debouncing is
+// configured, the events are forwarded to c in the background.
+func (o *directoryOptions) events(ctx context.Context, dir string, c EventChannel) EventChannel {
+	if o.debounce == 0 && len(o.include) == 0 && len(o.exclude) == 0 {
+		return c
+	}
+
+	in := make(EventChannel)
+	go o.forward(ctx, dir, in, c)
+	return in
+}
+
+func (o *directoryOptions) forward(ctx context.Context, dir string, in <-chan Event, c EventChannel) {
+	var (
+		pending []Event
+		flush   <-chan time.Time
+		timer   *time.Timer
+	)
+
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-in:
+			if !o.keep(dir, e) {
+				continue
+			}
+
+			if o.debounce == 0 {
+				if !send(ctx, c, e) {
+					return
+				}
+				continue
+			}
+
+			pending = o.add(pending, e)
+			if timer == nil {
+				timer = time.NewTimer(o.debounce)
+			} else {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(o.debounce)
+			}
+			flush = timer.C
+		case <-flush:
+			for _, e := range pending {
+				if !send(ctx, c, e) {
+					return
+				}
+			}
+			pending, flush = nil, nil
+		}
+	}
+}
+
+func (o *directoryOptions) add(pending []Event, e Event) []Event {
+	if !o.coalesce {
+		return append(pending, e)
+	}
+
+	for i, p := range pending {
+		if p.Source() == e.Source() {
+			// the previous event for this file is superseded
+			pending = append(pending[:i], pending[i+1:]...)
+			break
+		}
+	}
+	return append(pending, e)
+}
+
+// send sends the event unless the context is done first. It returns false if the event was not sent.
+func send(ctx context.Context, c EventChannel, e Event) bool {
+	select {
+	case c <- e:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
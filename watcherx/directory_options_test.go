@@ -0,0 +1,143 @@
+package watcherx
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirectoryOptions(t *testing.T) {
+	t.Run("case=matches globs", func(t *testing.T) {
+		for k, tc := range []struct {
+			opts     []DirectoryOption
+			path     string
+			expected bool
+		}{
+			{path: "foo.yml", expected: true},
+			{opts: []DirectoryOption{DirectoryWithIncludeGlobs("*.yml")}, path: "foo.yml", expected: true},
+			{opts: []DirectoryOption{DirectoryWithIncludeGlobs("*.yml")}, path: "sub/foo.yml", expected: false},
+			{opts: []DirectoryOption{DirectoryWithIncludeGlobs("**/*.yml")}, path: "sub/foo.yml", expected: true},
+			{opts: []DirectoryOption{DirectoryWithIncludeGlobs("**/*.{yml,yaml}")}, path: "foo.yaml", expected: true},
+			{opts: []DirectoryOption{DirectoryWithExcludeGlobs("**/.git/**")}, path: ".git/HEAD", expected: false},
+			{opts: []DirectoryOption{DirectoryWithExcludeGlobs("**/*.swp")}, path: "foo.yml", expected: true},
+			{opts: []DirectoryOption{DirectoryWithIncludeGlobs("**/*.yml"), DirectoryWithExcludeGlobs("tmp/**")}, path: "tmp/foo.yml", expected: false},
+		} {
+			o, err := newDirectoryOptions(tc.opts)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, o.matches("/dir", filepath.Join("/dir", filepath.FromSlash(tc.path))), "%d", k)
+		}
+	})
+
+	t.Run("case=rejects invalid globs", func(t *testing.T) {
+		c := make(EventChannel)
+		_, err := WatchDirectory(context.Background(), t.TempDir(), c, DirectoryWithIncludeGlobs("[a-"))
+		require.Error(t, err)
+		_, ok := <-c
+		assert.False(t, ok)
+	})
+
+	t.Run("case=filters events", func(t *testing.T) {
+		ctx, c, dir, cancel := setup(t)
+		defer cancel()
+
+		_, err := WatchDirectory(ctx, dir, c, DirectoryWithIncludeGlobs("*.yml"))
+		require.NoError(t, err)
+
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "example.swp"), []byte("ignored"), 0600))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "example.yml"), []byte("foo"), 0600))
+
+		e := <-c
+		require.IsType(t, &ChangeEvent{}, e)
+		assert.Equal(t, filepath.Join(dir, "example.yml"), e.Source())
+	})
+
+	t.Run("case=filters events on DispatchNow", func(t *testing.T) {
+		ctx, c, dir, cancel := setup(t)
+		defer cancel()
+
+		c = make(EventChannel, 2)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a.yml"), []byte("foo"), 0600))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "b.json"), []byte("bar"), 0600))
+
+		w, err := WatchDirectory(ctx, dir, c, DirectoryWithExcludeGlobs("*.json"))
+		require.NoError(t, err)
+
+		done, err := w.DispatchNow()
+		require.NoError(t, err)
+		assert.Equal(t, 1, <-done)
+		assertChange(t, <-c, "foo", filepath.Join(dir, "a.yml"))
+	})
+
+	t.Run("case=debounces and coalesces events", func(t *testing.T) {
+		ctx, c, dir, cancel := setup(t)
+		defer cancel()
+
+		fileName := filepath.Join(dir, "example.yml")
+		_, err := WatchDirectoryPolling(ctx, dir, testPollInterval, c,
+			DirectoryWithDebounce(10*testPollInterval), DirectoryWithCoalescing())
+		require.NoError(t, err)
+
+		for _, content := range []string{"a", "ab", "abc"} {
+			writeFileAtomic(t, fileName, content)
+			time.Sleep(2 * testPollInterval)
+		}
+
+		assertChange(t, <-c, "abc", fileName)
+
+		select {
+		case e := <-c:
+			t.Fatalf("unexpected event %s", e)
+		case <-time.After(15 * testPollInterval):
+		}
+	})
+
+	t.Run("case=debounces without coalescing", func(t *testing.T) {
+		ctx, c, dir, cancel := setup(t)
+		defer cancel()
+
+		fileName := filepath.Join(dir, "example.yml")
+		_, err := WatchDirectoryPolling(ctx, dir, testPollInterval, c, DirectoryWithDebounce(10*testPollInterval))
+		require.NoError(t, err)
+
+		writeFileAtomic(t, fileName, "a")
+		time.Sleep(2 * testPollInterval)
+		require.NoError(t, os.Remove(fileName))
+
+		assertChange(t, <-c, "a", fileName)
+		assertRemove(t, <-c, fileName)
+	})
+	t.Run("case=stops forwarding when the consumer stops reading", func(t *testing.T) {
+		for _, opts := range [][]DirectoryOption{
+			{DirectoryWithExcludeGlobs("*.swp")},
+			{DirectoryWithDebounce(time.Millisecond)},
+		} {
+			o, err := newDirectoryOptions(opts)
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			in := make(EventChannel)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				o.forward(ctx, "/dir", in, make(EventChannel))
+			}()
+
+			in <- &RemoveEvent{source("/dir/a.yml")}
+			time.Sleep(10 * time.Millisecond)
+			cancel()
+
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("forward did not return after the context was canceled")
+			}
+			assert.False(t, send(ctx, in, &RemoveEvent{source("/dir/b.yml")}))
+		}
+	})
+}
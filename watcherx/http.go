@@ -0,0 +1,214 @@
+package watcherx
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/httpx"
+)
+
+type httpPoller struct {
+	hc       *retryablehttp.Client
+	u        string
+	interval time.Duration
+
+	etag         string
+	lastModified string
+	hash         []byte
+	exists       bool
+	failures     int
+}
+
+// DefaultHTTPPollInterval is used by Watch for http and https URLs without a `poll` query parameter.
+const DefaultHTTPPollInterval = 30 * time.Second
+
+// WatchHTTP polls the URL every interval and sends a ChangeEvent whenever the response body changes. Requests are
+// conditional (If-None-Match and If-Modified-Since) if the server sent an ETag or Last-Modified header. A RemoveEvent
+// is sent when the server responds with 404 Not Found or 410 Gone.
+//
+// Requests time out after 10 seconds and are not retried, because the next poll retries anyway and DispatchNow
+// would otherwise block for the whole retry cycle. Use opts to customize the httpx.NewResilientClient. If a poll
+// fails, the next poll is delayed using the backoff of that client.
+func WatchHTTP(ctx context.Context, u *url.URL, interval time.Duration, c EventChannel, opts ...httpx.ResilientOptions) (Watcher, error) {
+	if interval <= 0 {
+		close(c)
+		return nil, errors.WithStack(ErrInvalidPollInterval)
+	}
+
+	p := &httpPoller{
+		hc: httpx.NewResilientClient(append([]httpx.ResilientOptions{
+			httpx.ResilientClientWithMaxRetry(0),
+			httpx.ResilientClientWithConnectionTimeout(10 * time.Second),
+		}, opts...)...),
+		u:        u.String(),
+		interval: interval,
+	}
+
+	d := newDispatcher()
+	go p.streamEvents(ctx, c, d.trigger, d.done)
+	return d, nil
+}
+
+// watchHTTPURL is used by Watch and takes the poll interval from the `poll` query parameter.
+func watchHTTPURL(ctx context.Context, u *url.URL, c EventChannel) (Watcher, error) {
+	interval := DefaultHTTPPollInterval
+
+	q := u.Query()
+	if poll := q.Get("poll"); poll != "" {
+		var err error
+		interval, err = time.ParseDuration(poll)
+		if err != nil {
+			close(c)
+			return nil, errors.Wrapf(err, "unable to parse poll interval %q", poll)
+		}
+
+		q.Del("poll")
+		uu := *u
+		uu.RawQuery = q.Encode()
+		u = &uu
+	}
+
+	return WatchHTTP(ctx, u, interval, c)
+}
+
+// fetch requests the URL and returns the event to send, if any.
+func (p *httpPoller) fetch(ctx context.Context, conditional bool) (Event, error) {
+	req, err := retryablehttp.NewRequest("GET", p.u, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+
+	if conditional {
+		if p.etag != "" {
+			req.Header.Set("If-None-Match", p.etag)
+		}
+		if p.lastModified != "" {
+			req.Header.Set("If-Modified-Since", p.lastModified)
+		}
+	}
+
+	res, err := p.hc.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	eventSource := source(p.u)
+	switch res.StatusCode {
+	case http.StatusNotModified:
+		return nil, nil
+	case http.StatusNotFound, http.StatusGone:
+		existed := p.exists
+		p.exists, p.hash, p.etag, p.lastModified = false, nil, "", ""
+		if existed || !conditional {
+			return &RemoveEvent{eventSource}, nil
+		}
+		return nil, nil
+	case http.StatusOK:
+	default:
+		return nil, errors.Errorf("expected http response status code 200 but got %d when fetching: %s", res.StatusCode, p.u)
+	}
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	p.etag = res.Header.Get("ETag")
+	p.lastModified = res.Header.Get("Last-Modified")
+
+	hash := sha256.Sum256(data)
+	if conditional && p.exists && bytes.Equal(p.hash, hash[:]) {
+		return nil, nil
+	}
+
+	p.exists, p.hash = true, hash[:]
+	return &ChangeEvent{
+		data:   data,
+		source: eventSource,
+	}, nil
+}
+
+// nextPoll returns how long to wait for the next poll, taking into account backoff after failures.
+func (p *httpPoller) nextPoll() time.Duration {
+	if p.failures == 0 {
+		return p.interval
+	}
+
+	if wait := p.hc.Backoff(p.hc.RetryWaitMin, p.hc.RetryWaitMax, p.failures, nil); wait > p.interval {
+		return wait
+	}
+	return p.interval
+}
+
+func (p *httpPoller) streamEvents(ctx context.Context, c EventChannel, sendNow <-chan struct{}, sendNowDone chan<- int) {
+	defer close(c)
+	eventSource := source(p.u)
+
+	// The first request only establishes the current state.
+	if _, err := p.fetch(ctx, true); err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+
+		p.failures++
+		c <- &ErrorEvent{
+			error:  err,
+			source: eventSource,
+		}
+	}
+
+	timer := time.NewTimer(p.nextPoll())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sendNow:
+			e, err := p.fetch(ctx, false)
+			if err != nil {
+				e = &ErrorEvent{
+					error:  err,
+					source: eventSource,
+				}
+			}
+			if e == nil {
+				// the server answered 304 Not Modified although the request was not conditional
+				sendNowDone <- 0
+				continue
+			}
+			c <- e
+			sendNowDone <- 1
+		case <-timer.C:
+			e, err := p.fetch(ctx, true)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+
+				p.failures++
+				c <- &ErrorEvent{
+					error:  err,
+					source: eventSource,
+				}
+			} else {
+				p.failures = 0
+				if e != nil {
+					c <- e
+				}
+			}
+
+			timer.Reset(p.nextPoll())
+		}
+	}
+}
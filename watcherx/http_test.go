@@ -0,0 +1,193 @@
+package watcherx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/x/httpx"
+)
+
+type httpDocument struct {
+	sync.Mutex
+	status      int
+	content     string
+	etag        string
+	requests    int
+	conditional int
+}
+
+func (d *httpDocument) set(status int, content, etag string) {
+	d.Lock()
+	defer d.Unlock()
+	d.status, d.content, d.etag = status, content, etag
+}
+
+func (d *httpDocument) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.requests++
+	if r.Header.Get("If-None-Match") != "" {
+		d.conditional++
+		if r.Header.Get("If-None-Match") == d.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	if d.etag != "" {
+		w.Header().Set("ETag", d.etag)
+	}
+	w.WriteHeader(d.status)
+	_, _ = w.Write([]byte(d.content))
+}
+
+// waitForBaseline waits until the watcher fetched the document once.
+func (d *httpDocument) waitForBaseline(t *testing.T) {
+	require.Eventually(t, func() bool {
+		d.Lock()
+		defer d.Unlock()
+		return d.requests > 0
+	}, time.Second, time.Millisecond)
+}
+
+func setupHTTP(t *testing.T, status int, content, etag string) (*httpDocument, *url.URL) {
+	doc := &httpDocument{status: status, content: content, etag: etag}
+	ts := httptest.NewServer(doc)
+	t.Cleanup(ts.Close)
+
+	u, err := url.Parse(ts.URL + "/config.yml")
+	require.NoError(t, err)
+	return doc, u
+}
+
+func TestWatchHTTP(t *testing.T) {
+	t.Run("case=notifies about changes only", func(t *testing.T) {
+		ctx, c, _, cancel := setup(t)
+		defer cancel()
+
+		doc, u := setupHTTP(t, http.StatusOK, "foo", `"1"`)
+		_, err := WatchHTTP(ctx, u, testPollInterval, c)
+		require.NoError(t, err)
+		doc.waitForBaseline(t)
+
+		doc.set(http.StatusOK, "bar", `"2"`)
+		assertChange(t, <-c, "bar", u.String())
+
+		// same content with a different etag must not cause an event
+		doc.set(http.StatusOK, "bar", `"3"`)
+		doc.set(http.StatusNotFound, "", "")
+		assertRemove(t, <-c, u.String())
+
+		doc.set(http.StatusOK, "baz", "")
+		assertChange(t, <-c, "baz", u.String())
+
+		doc.Lock()
+		defer doc.Unlock()
+		assert.True(t, doc.conditional > 0)
+	})
+
+	t.Run("case=does not send events for unmodified documents", func(t *testing.T) {
+		ctx, c, _, cancel := setup(t)
+		defer cancel()
+
+		doc, u := setupHTTP(t, http.StatusOK, "foo", "")
+		_, err := WatchHTTP(ctx, u, testPollInterval, c)
+		require.NoError(t, err)
+
+		select {
+		case e := <-c:
+			t.Fatalf("unexpected event %s", e)
+		case <-time.After(5 * testPollInterval):
+		}
+
+		doc.Lock()
+		defer doc.Unlock()
+		assert.True(t, doc.requests > 1)
+	})
+
+	t.Run("case=sends error events", func(t *testing.T) {
+		ctx, c, _, cancel := setup(t)
+		defer cancel()
+
+		doc, u := setupHTTP(t, http.StatusOK, "foo", "")
+		_, err := WatchHTTP(ctx, u, testPollInterval, c, httpx.ResilientClientWithMaxRetry(0))
+		require.NoError(t, err)
+		doc.waitForBaseline(t)
+
+		doc.set(http.StatusInternalServerError, "", "")
+		e := <-c
+		require.IsType(t, &ErrorEvent{}, e)
+		assert.Equal(t, u.String(), e.Source())
+	})
+
+	t.Run("case=sends an error event if the first request fails", func(t *testing.T) {
+		ctx, c, _, cancel := setup(t)
+		defer cancel()
+
+		_, u := setupHTTP(t, http.StatusInternalServerError, "", "")
+		_, err := WatchHTTP(ctx, u, time.Hour, c)
+		require.NoError(t, err)
+
+		e := <-c
+		require.IsType(t, &ErrorEvent{}, e)
+		assert.Equal(t, u.String(), e.Source())
+	})
+
+	t.Run("case=does not send an empty event on DispatchNow if the document is not modified", func(t *testing.T) {
+		ctx, c, _, cancel := setup(t)
+		defer cancel()
+
+		_, u := setupHTTP(t, http.StatusNotModified, "", "")
+		w, err := WatchHTTP(ctx, u, time.Hour, c)
+		require.NoError(t, err)
+
+		done, err := w.DispatchNow()
+		require.NoError(t, err)
+		assert.Equal(t, 0, <-done)
+
+		select {
+		case e := <-c:
+			t.Fatalf("unexpected event %s", e)
+		default:
+		}
+	})
+
+	t.Run("case=sends event on DispatchNow", func(t *testing.T) {
+		ctx, c, _, cancel := setup(t)
+		defer cancel()
+
+		_, u := setupHTTP(t, http.StatusOK, "foo", `"1"`)
+		w, err := WatchHTTP(ctx, u, time.Hour, c)
+		require.NoError(t, err)
+
+		done, err := w.DispatchNow()
+		require.NoError(t, err)
+
+		assertChange(t, <-c, "foo", u.String())
+		assert.Equal(t, 1, <-done)
+	})
+
+	t.Run("case=is used by Watch and strips the poll parameter", func(t *testing.T) {
+		ctx, c, _, cancel := setup(t)
+		defer cancel()
+
+		doc, u := setupHTTP(t, http.StatusOK, "foo", "")
+		withPoll := *u
+		withPoll.RawQuery = "poll=10ms"
+
+		_, err := Watch(ctx, &withPoll, c)
+		require.NoError(t, err)
+		doc.waitForBaseline(t)
+
+		doc.set(http.StatusOK, "bar", "")
+		assertChange(t, <-c, "bar", u.String())
+	})
+}
@@ -0,0 +1,242 @@
+package watcherx
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// polledFile is the state of a file as seen by the last poll.
+	polledFile struct {
+		modTime time.Time
+		size    int64
+		hash    []byte
+	}
+	polledFiles map[string]*polledFile
+)
+
+// ErrInvalidPollInterval is returned when a polling watcher is started with an interval that is not positive.
+var ErrInvalidPollInterval = errors.New("the poll interval must be greater than zero")
+
+// WatchFilePolling works like WatchFile but checks the file for changes every interval instead of relying on fsnotify.
+// This is useful for filesystems that do not support inotify like NFS, some FUSE mounts, or container overlay filesystems.
+//
+// A change is detected by comparing the modification time and size of the file, and confirmed by comparing the
+// SHA-256 hash of its content. Symlinks are followed.
+func WatchFilePolling(ctx context.Context, file string, interval time.Duration, c EventChannel) (Watcher, error) {
+	if interval <= 0 {
+		close(c)
+		return nil, errors.WithStack(ErrInvalidPollInterval)
+	}
+
+	state, _, err := pollFile(file, nil)
+	if err != nil {
+		close(c)
+		return nil, errors.WithStack(err)
+	}
+
+	d := newDispatcher()
+	go streamPolledFileEvents(ctx, c, d.trigger, d.done, interval, file, state)
+	return d, nil
+}
+
+// WatchDirectoryPolling works like WatchDirectory but checks all files in the directory for changes every interval
+// instead of relying on fsnotify. See WatchFilePolling for details on how changes are detected.
+func WatchDirectoryPolling(ctx context.Context, dir string, interval time.Duration, c EventChannel, opts ...DirectoryOption) (Watcher, error) {
+	if interval <= 0 {
+		close(c)
+		return nil, errors.WithStack(ErrInvalidPollInterval)
+	}
+
+	o, err := newDirectoryOptions(opts)
+	if err != nil {
+		close(c)
+		return nil, err
+	}
+
+	state := polledFiles{}
+	if err := state.walk(ctx, dir, nil); err != nil {
+		close(c)
+		return nil, errors.WithStack(err)
+	}
+
+	d := newDispatcher()
+	go streamPolledDirectoryEvents(ctx, o.events(ctx, dir, c), c, d.trigger, d.done, interval, dir, state, o)
+	return d, nil
+}
+
+// pollFile returns the current state of the file and its content if it changed compared to the previous state.
+// A nil state means that the file does not exist.
+func pollFile(path string, previous *polledFile) (*polledFile, []byte, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	} else if err != nil {
+		return previous, nil, errors.WithStack(err)
+	}
+
+	if previous != nil && previous.modTime.Equal(info.ModTime()) && previous.size == info.Size() {
+		return previous, nil, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	} else if err != nil {
+		return previous, nil, errors.WithStack(err)
+	}
+
+	hash := sha256.Sum256(data)
+	next := &polledFile{modTime: info.ModTime(), size: info.Size(), hash: hash[:]}
+	if previous != nil && bytes.Equal(previous.hash, next.hash) {
+		// The file was touched but the content is the same.
+		return next, nil, nil
+	}
+
+	return next, data, nil
+}
+
+func streamPolledFileEvents(ctx context.Context, c EventChannel, sendNow <-chan struct{}, sendNowDone chan<- int, interval time.Duration, file string, state *polledFile) {
+	defer close(c)
+	eventSource := source(file)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sendNow:
+			next, data, err := pollFile(file, nil)
+			switch {
+			case err != nil:
+				c <- &ErrorEvent{
+					error:  err,
+					source: eventSource,
+				}
+			case next == nil:
+				c <- &RemoveEvent{eventSource}
+				state = nil
+			default:
+				c <- &ChangeEvent{
+					data:   data,
+					source: eventSource,
+				}
+				state = next
+			}
+
+			// in any of the above cases we send exactly one event
+			sendNowDone <- 1
+		case <-ticker.C:
+			next, data, err := pollFile(file, state)
+			switch {
+			case err != nil:
+				c <- &ErrorEvent{
+					error:  err,
+					source: eventSource,
+				}
+			case next == nil && state != nil:
+				c <- &RemoveEvent{eventSource}
+			case data != nil:
+				c <- &ChangeEvent{
+					data:   data,
+					source: eventSource,
+				}
+			}
+			state = next
+		}
+	}
+}
+
+// walk updates the state with all files in dir. If c is not nil, events for created, changed and removed files are sent.
+func (s polledFiles) walk(ctx context.Context, dir string, c EventChannel) error {
+	seen := map[string]bool{}
+	if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				// removed while walking, or the directory itself is gone
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		seen[path] = true
+		next, data, err := pollFile(path, s[path])
+		if err != nil {
+			if c != nil && !send(ctx, c, &ErrorEvent{
+				error:  err,
+				source: source(path),
+			}) {
+				return ctx.Err()
+			}
+			return nil
+		}
+
+		if next == nil {
+			// removed while walking, will be handled below
+			delete(seen, path)
+			return nil
+		}
+
+		s[path] = next
+		if data != nil && c != nil && !send(ctx, c, &ChangeEvent{
+			data:   data,
+			source: source(path),
+		}) {
+			return ctx.Err()
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	var removed []string
+	for path := range s {
+		if !seen[path] {
+			removed = append(removed, path)
+		}
+	}
+	sort.Strings(removed)
+
+	for _, path := range removed {
+		delete(s, path)
+		if c != nil && !send(ctx, c, &RemoveEvent{source(path)}) {
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func streamPolledDirectoryEvents(ctx context.Context, events, c EventChannel, sendNow <-chan struct{}, sendNowDone chan<- int, interval time.Duration, dir string, state polledFiles, o *directoryOptions) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := state.walk(ctx, dir, events); err != nil && ctx.Err() == nil {
+				send(ctx, events, &ErrorEvent{
+					error:  errors.WithStack(err),
+					source: source(dir),
+				})
+			}
+		case <-sendNow:
+			sendNowDone <- sendDirectoryContent(ctx, dir, c, o)
+		}
+	}
+}
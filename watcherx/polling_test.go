@@ -0,0 +1,198 @@
+package watcherx
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPollInterval = 10 * time.Millisecond
+
+// writeFileAtomic makes sure that the poller never observes a partially written file.
+func writeFileAtomic(t *testing.T, file, content string) {
+	tmp := filepath.Join(t.TempDir(), filepath.Base(file))
+	require.NoError(t, ioutil.WriteFile(tmp, []byte(content), 0600))
+	require.NoError(t, os.Rename(tmp, file))
+}
+
+func TestWatchFilePolling(t *testing.T) {
+	t.Run("case=notifies on file write", func(t *testing.T) {
+		ctx, c, dir, cancel := setup(t)
+		defer cancel()
+
+		exampleFile := filepath.Join(dir, "example.file")
+		writeFileAtomic(t, exampleFile, "foo")
+
+		_, err := WatchFilePolling(ctx, exampleFile, testPollInterval, c)
+		require.NoError(t, err)
+
+		writeFileAtomic(t, exampleFile, "foobar")
+		assertChange(t, <-c, "foobar", exampleFile)
+	})
+
+	t.Run("case=notifies about create, remove, and recreate", func(t *testing.T) {
+		ctx, c, dir, cancel := setup(t)
+		defer cancel()
+
+		exampleFile := filepath.Join(dir, "example.file")
+		_, err := WatchFilePolling(ctx, exampleFile, testPollInterval, c)
+		require.NoError(t, err)
+
+		writeFileAtomic(t, exampleFile, "foo")
+		assertChange(t, <-c, "foo", exampleFile)
+
+		require.NoError(t, os.Remove(exampleFile))
+		assertRemove(t, <-c, exampleFile)
+
+		writeFileAtomic(t, exampleFile, "bar")
+		assertChange(t, <-c, "bar", exampleFile)
+	})
+
+	t.Run("case=does not notify if only the modification time changed", func(t *testing.T) {
+		ctx, c, dir, cancel := setup(t)
+		defer cancel()
+
+		exampleFile := filepath.Join(dir, "example.file")
+		writeFileAtomic(t, exampleFile, "foo")
+
+		_, err := WatchFilePolling(ctx, exampleFile, testPollInterval, c)
+		require.NoError(t, err)
+
+		future := time.Now().Add(time.Hour)
+		require.NoError(t, os.Chtimes(exampleFile, future, future))
+
+		select {
+		case e := <-c:
+			t.Fatalf("unexpected event %s", e)
+		case <-time.After(5 * testPollInterval):
+		}
+	})
+
+	t.Run("case=sends event on DispatchNow", func(t *testing.T) {
+		ctx, c, dir, cancel := setup(t)
+		defer cancel()
+
+		exampleFile := filepath.Join(dir, "example.file")
+		writeFileAtomic(t, exampleFile, "foo")
+
+		w, err := WatchFilePolling(ctx, exampleFile, time.Hour, c)
+		require.NoError(t, err)
+
+		done, err := w.DispatchNow()
+		require.NoError(t, err)
+
+		assertChange(t, <-c, "foo", exampleFile)
+		assert.Equal(t, 1, <-done)
+
+		require.NoError(t, os.Remove(exampleFile))
+		done, err = w.DispatchNow()
+		require.NoError(t, err)
+
+		assertRemove(t, <-c, exampleFile)
+		assert.Equal(t, 1, <-done)
+	})
+
+	t.Run("case=closes channel on context cancel", func(t *testing.T) {
+		ctx, c, dir, cancel := setup(t)
+
+		_, err := WatchFilePolling(ctx, filepath.Join(dir, "example.file"), testPollInterval, c)
+		require.NoError(t, err)
+
+		cancel()
+		_, ok := <-c
+		assert.False(t, ok)
+	})
+
+	t.Run("case=rejects invalid interval", func(t *testing.T) {
+		_, err := WatchFilePolling(context.Background(), "foo", 0, make(EventChannel))
+		assert.True(t, errors.Is(err, ErrInvalidPollInterval))
+	})
+
+	t.Run("case=is used by Watch with poll parameter", func(t *testing.T) {
+		ctx, c, dir, cancel := setup(t)
+		defer cancel()
+
+		exampleFile := filepath.Join(dir, "example.file")
+		_, err := Watch(ctx, &url.URL{Scheme: "file", Path: exampleFile, RawQuery: "poll=10ms"}, c)
+		require.NoError(t, err)
+
+		writeFileAtomic(t, exampleFile, "foo")
+		assertChange(t, <-c, "foo", exampleFile)
+	})
+
+	t.Run("case=Watch fails on invalid poll parameter", func(t *testing.T) {
+		_, err := Watch(context.Background(), &url.URL{Scheme: "file", Path: "foo", RawQuery: "poll=often"}, make(EventChannel))
+		require.Error(t, err)
+	})
+}
+
+func TestWatchDirectoryPolling(t *testing.T) {
+	t.Run("case=notifies about file creation, change, and removal", func(t *testing.T) {
+		ctx, c, dir, cancel := setup(t)
+		defer cancel()
+
+		_, err := WatchDirectoryPolling(ctx, dir, testPollInterval, c)
+		require.NoError(t, err)
+
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0700))
+		fileName := filepath.Join(dir, "sub", "example")
+		writeFileAtomic(t, fileName, "foo")
+		assertChange(t, <-c, "foo", fileName)
+
+		writeFileAtomic(t, fileName, "foobar")
+		assertChange(t, <-c, "foobar", fileName)
+
+		require.NoError(t, os.RemoveAll(filepath.Join(dir, "sub")))
+		assertRemove(t, <-c, fileName)
+	})
+
+	t.Run("case=sends event on DispatchNow", func(t *testing.T) {
+		ctx, c, dir, cancel := setup(t)
+		defer cancel()
+
+		fileName := filepath.Join(dir, "example")
+		writeFileAtomic(t, fileName, "foo")
+
+		w, err := WatchDirectoryPolling(ctx, dir, time.Hour, c)
+		require.NoError(t, err)
+
+		done, err := w.DispatchNow()
+		require.NoError(t, err)
+
+		assertChange(t, <-c, "foo", fileName)
+		assert.Equal(t, 1, <-done)
+	})
+	t.Run("case=is used by Watch for directories with the poll parameter", func(t *testing.T) {
+		ctx, c, dir, cancel := setup(t)
+		defer cancel()
+
+		_, err := Watch(ctx, &url.URL{Scheme: "file", Path: dir, RawQuery: "poll=10ms"}, c)
+		require.NoError(t, err)
+
+		fileName := filepath.Join(dir, "example")
+		writeFileAtomic(t, fileName, "foo")
+		assertChange(t, <-c, "foo", fileName)
+	})
+
+	t.Run("case=closes channel if it fails to start", func(t *testing.T) {
+		c := make(EventChannel)
+		_, err := WatchDirectoryPolling(context.Background(), "foo", 0, c)
+		assert.True(t, errors.Is(err, ErrInvalidPollInterval))
+		_, ok := <-c
+		assert.False(t, ok)
+
+		c = make(EventChannel)
+		_, err = WatchDirectoryPolling(context.Background(), t.TempDir(), testPollInterval, c, DirectoryWithIncludeGlobs("[a-"))
+		require.Error(t, err)
+		_, ok = <-c
+		assert.False(t, ok)
+	})
+}
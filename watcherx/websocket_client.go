@@ -3,111 +3,282 @@ package watcherx
 import (
 	"context"
 	"fmt"
-	"net"
+	"net/http"
 	"net/url"
-	"strings"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/hashicorp/go-retryablehttp"
 	"github.com/pkg/errors"
 )
 
-func WatchWebsocket(ctx context.Context, u *url.URL, c EventChannel) (Watcher, error) {
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
-	if err != nil {
-		return nil, errors.WithStack(err)
+type (
+	websocketClientOptions struct {
+		dialer       *websocket.Dialer
+		header       http.Header
+		reconnect    bool
+		retryWaitMin time.Duration
+		retryWaitMax time.Duration
 	}
 
-	wsClosed := make(chan struct{})
-	go cleanupOnDone(ctx, conn, c, wsClosed)
+	// WebsocketClientOption configures WatchWebsocket.
+	WebsocketClientOption func(*websocketClientOptions)
 
-	d := newDispatcher()
+	websocketClient struct {
+		u *url.URL
+		c EventChannel
+		o *websocketClientOptions
+	}
+)
+
+// WebsocketClientWithDialer sets the dialer used to connect to the server. Use the dialer's TLSClientConfig
+// to configure trusted CAs or client certificates for `wss` URLs.
+func WebsocketClientWithDialer(dialer *websocket.Dialer) WebsocketClientOption {
+	return func(o *websocketClientOptions) {
+		o.dialer = dialer
+	}
+}
+
+// WebsocketClientWithHeader sets additional HTTP headers sent when connecting to the server.
+func WebsocketClientWithHeader(header http.Header) WebsocketClientOption {
+	return func(o *websocketClientOptions) {
+		for k, v := range header {
+			o.header[k] = append(o.header[k], v...)
+		}
+	}
+}
 
-	go forwardWebsocketEvents(conn, c, u, wsClosed, d.done)
+// WebsocketClientWithBearerToken authenticates at the server using the given bearer token.
+func WebsocketClientWithBearerToken(token string) WebsocketClientOption {
+	return func(o *websocketClientOptions) {
+		o.header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// WebsocketClientWithReconnect makes the client reconnect with exponential backoff when the connection breaks,
+// instead of closing the event channel.
+func WebsocketClientWithReconnect() WebsocketClientOption {
+	return func(o *websocketClientOptions) {
+		o.reconnect = true
+	}
+}
+
+// WebsocketClientWithReconnectBackoff sets the minimum and maximum time to wait between reconnect attempts, see
+// WebsocketClientWithReconnect. Defaults are 100ms and 30s.
+func WebsocketClientWithReconnectBackoff(retryWaitMin, retryWaitMax time.Duration) WebsocketClientOption {
+	return func(o *websocketClientOptions) {
+		o.retryWaitMin = retryWaitMin
+		o.retryWaitMax = retryWaitMax
+	}
+}
+
+func newWebsocketClientOptions(opts []WebsocketClientOption) *websocketClientOptions {
+	o := &websocketClientOptions{
+		dialer:       websocket.DefaultDialer,
+		header:       http.Header{},
+		retryWaitMin: 100 * time.Millisecond,
+		retryWaitMax: 30 * time.Second,
+	}
+	for _, f := range opts {
+		f(o)
+	}
+	return o
+}
 
-	go forwardDispatchNow(ctx, conn, c, d.trigger, u.String())
+// WatchWebsocket connects to a server created by WatchAndServeWS and forwards its events to c. Both `ws` and `wss`
+// URLs are supported.
+//
+// If the connection breaks, an ErrorEvent is sent and the channel is closed. Use WebsocketClientWithReconnect to
+// reconnect with exponential backoff instead, the server then replays the last known state so that no update is
+// lost. The channel is always closed when the context is canceled or the server closes the connection gracefully.
+func WatchWebsocket(ctx context.Context, u *url.URL, c EventChannel, opts ...WebsocketClientOption) (Watcher, error) {
+	wc := &websocketClient{u: u, c: c, o: newWebsocketClientOptions(opts)}
 
+	conn, err := wc.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	d := newDispatcher()
+	go wc.run(ctx, conn, d.trigger, d.done)
 	return d, nil
 }
 
-func cleanupOnDone(ctx context.Context, conn *websocket.Conn, c EventChannel, wsClosed <-chan struct{}) {
-	// wait for one of the events to occur
+func (wc *websocketClient) dial(ctx context.Context) (*websocket.Conn, error) {
+	conn, _, err := wc.o.dialer.DialContext(ctx, wc.u.String(), wc.o.header)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return conn, nil
+}
+
+func (wc *websocketClient) sendError(ctx context.Context, err error) {
 	select {
 	case <-ctx.Done():
-	case <-wsClosed:
+	case wc.c <- &ErrorEvent{
+		error:  err,
+		source: source(wc.u.String()),
+	}:
 	}
+}
 
+func (wc *websocketClient) run(ctx context.Context, conn *websocket.Conn, sendNow <-chan struct{}, sendNowDone chan<- int) {
 	// clean up channel
-	close(c)
-	// attempt to close the websocket
-	// ignore errors as we are closing everything anyway
-	_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "context canceled by server"))
-	_ = conn.Close()
+	defer close(wc.c)
+
+	for {
+		err := wc.serve(ctx, conn, sendNow, sendNowDone)
+		if err == nil {
+			return
+		}
+
+		// While disconnected nothing can be dispatched, so triggers are answered right away.
+		stop := wc.answerSendNow(ctx, sendNow, sendNowDone)
+		conn, err = wc.reconnect(ctx, err)
+		stop()
+		if err != nil {
+			return
+		}
+	}
 }
 
-func forwardWebsocketEvents(ws *websocket.Conn, c EventChannel, u *url.URL, wsClosed chan<- struct{}, sendNowDone chan<- int) {
-	serverURL := source(u.String())
+// reconnect reports the error and dials the server with exponential backoff until it succeeds. It returns an error
+// if reconnecting is disabled or the context is canceled.
+func (wc *websocketClient) reconnect(ctx context.Context, err error) (*websocket.Conn, error) {
+	wc.sendError(ctx, err)
+	if !wc.o.reconnect {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(retryablehttp.DefaultBackoff(wc.o.retryWaitMin, wc.o.retryWaitMax, attempt, nil)):
+		}
+
+		conn, err := wc.dial(ctx)
+		if err == nil {
+			return conn, nil
+		} else if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		wc.sendError(ctx, err)
+	}
+}
 
-	defer func() {
-		// this triggers the cleanupOnDone subroutine
-		close(wsClosed)
+// answerSendNow reports that no events were sent for every trigger until the returned function is called.
+func (wc *websocketClient) answerSendNow(ctx context.Context, sendNow <-chan struct{}, sendNowDone chan<- int) (stop func()) {
+	quit, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-quit:
+				return
+			case <-sendNow:
+				select {
+				case <-ctx.Done():
+					return
+				case <-quit:
+					return
+				case sendNowDone <- 0:
+				}
+			}
+		}
 	}()
+	return func() {
+		close(quit)
+		<-stopped
+	}
+}
+
+// serve forwards events until the context is canceled or the connection is closed. It returns an error only if the
+// connection broke unexpectedly.
+func (wc *websocketClient) serve(ctx context.Context, conn *websocket.Conn, sendNow <-chan struct{}, sendNowDone chan<- int) error {
+	readErr, done := make(chan error, 1), make(chan int)
+	go wc.forwardWebsocketEvents(ctx, conn, done, readErr)
 
+	// the number of triggers sent to the server which it did not answer yet
+	var pending int
 	for {
-		// receive messages, this call is blocking
-		_, msg, err := ws.ReadMessage()
-		if err != nil {
-			if closeErr, ok := err.(*websocket.CloseError); ok && closeErr.Code == websocket.CloseNormalClosure {
-				return
+		select {
+		case <-ctx.Done():
+			// attempt to close the websocket
+			// ignore errors as we are closing everything anyway
+			_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "context canceled by server"))
+			_ = conn.Close()
+			<-readErr
+			return nil
+		case n := <-done:
+			if pending > 0 {
+				pending--
 			}
-			// assuming the connection got closed through context canceling
-			if opErr, ok := err.(*net.OpError); ok && opErr.Op == "read" && strings.Contains(opErr.Err.Error(), "closed") {
-				return
+			select {
+			case <-ctx.Done():
+			case sendNowDone <- n:
 			}
-			c <- &ErrorEvent{
-				error:  errors.WithStack(err),
-				source: serverURL,
+		case err := <-readErr:
+			_ = conn.Close()
+			// The server will never answer the pending triggers, so the callers have to be told that nothing was sent.
+			for ; pending > 0; pending-- {
+				select {
+				case <-ctx.Done():
+				case sendNowDone <- 0:
+				}
 			}
+			if closeErr, ok := err.(*websocket.CloseError); ok && closeErr.Code == websocket.CloseNormalClosure {
+				return nil
+			}
+			return errors.WithStack(err)
+		case <-sendNow:
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(messageSendNow)); err != nil {
+				// The server will never answer, so the caller has to be told that nothing was sent.
+				select {
+				case <-ctx.Done():
+				case sendNowDone <- 0:
+				}
+				wc.sendError(ctx, err)
+				continue
+			}
+			pending++
+		}
+	}
+}
+
+func (wc *websocketClient) forwardWebsocketEvents(ctx context.Context, ws *websocket.Conn, sendNowDone chan<- int, readErr chan<- error) {
+	for {
+		// receive messages, this call is blocking
+		_, msg, err := ws.ReadMessage()
+		if err != nil {
+			readErr <- err
 			return
 		}
 
 		var eventsSend int
 		_, err = fmt.Sscanf(string(msg), messageSendNowDone, &eventsSend)
 		if err == nil {
-			sendNowDone <- eventsSend
+			select {
+			case <-ctx.Done():
+			case sendNowDone <- eventsSend:
+			}
 			continue
 		}
 
 		e, err := unmarshalEvent(msg)
 		if err != nil {
-			c <- &ErrorEvent{
-				error:  err,
-				source: serverURL,
-			}
+			wc.sendError(ctx, err)
 			continue
 		}
-		localURL := *u
+		localURL := *wc.u
 		localURL.Path = e.Source()
 		e.setSource(localURL.String())
-		c <- e
-	}
-}
 
-func forwardDispatchNow(ctx context.Context, ws *websocket.Conn, c EventChannel, sendNow <-chan struct{}, serverURL string) {
-	for {
 		select {
 		case <-ctx.Done():
-			return
-		case _, ok := <-sendNow:
-			if !ok {
-				return
-			}
-
-			if err := ws.WriteMessage(websocket.TextMessage, []byte(messageSendNow)); err != nil {
-				c <- &ErrorEvent{
-					source: source(serverURL),
-					error:  err,
-				}
-			}
+		case wc.c <- e:
 		}
 	}
 }
@@ -2,6 +2,7 @@ package watcherx
 
 import (
 	"context"
+	"crypto/x509"
 	"fmt"
 	"net"
 	"net/http"
@@ -10,6 +11,7 @@ import (
 	"sync"
 
 	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
 
 	"github.com/ory/herodot"
 )
@@ -23,7 +25,23 @@ type (
 		wsWriteLock      sync.Mutex
 		wsReadLock       sync.Mutex
 		wsClientChannels eventChannelSlice
+		o                *websocketServerOptions
+
+		// state is the last change or remove event per source. It is protected by the wsClientChannels lock.
+		state      map[string]Event
+		stateOrder []string
+	}
+
+	websocketServerOptions struct {
+		authenticators []WebsocketAuthenticator
 	}
+
+	// WebsocketServerOption configures WatchAndServeWS.
+	WebsocketServerOption func(*websocketServerOptions)
+
+	// WebsocketAuthenticator authenticates the HTTP request before it is upgraded to a websocket connection.
+	// A returned error rejects the request.
+	WebsocketAuthenticator func(r *http.Request) error
 )
 
 const (
@@ -31,7 +49,47 @@ const (
 	messageSendNowDone = "done sending %d values"
 )
 
-func WatchAndServeWS(ctx context.Context, u *url.URL, writer herodot.Writer) (http.HandlerFunc, error) {
+// WebsocketServerWithAuthenticator adds an authenticator that all requests must pass. See
+// BearerTokenAuthenticator and ClientCertificateAuthenticator.
+func WebsocketServerWithAuthenticator(authenticator WebsocketAuthenticator) WebsocketServerOption {
+	return func(o *websocketServerOptions) {
+		o.authenticators = append(o.authenticators, authenticator)
+	}
+}
+
+// BearerTokenAuthenticator requires requests to send a bearer token in the Authorization header which
+// is accepted by validate.
+func BearerTokenAuthenticator(validate func(r *http.Request, token string) error) WebsocketAuthenticator {
+	return func(r *http.Request) error {
+		auth := r.Header.Get("Authorization")
+		if len(auth) <= len("bearer ") || !strings.EqualFold(auth[:len("bearer ")], "bearer ") {
+			return errors.New("the request did not include a bearer token")
+		}
+		return validate(r, auth[len("bearer "):])
+	}
+}
+
+// ClientCertificateAuthenticator requires requests to present a verified TLS client certificate which is
+// accepted by verify. The server's tls.Config must request and verify client certificates, e.g. using
+// tls.RequireAndVerifyClientCert.
+func ClientCertificateAuthenticator(verify func(cert *x509.Certificate) error) WebsocketAuthenticator {
+	return func(r *http.Request) error {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			return errors.New("the request did not include a verified client certificate")
+		}
+		return verify(r.TLS.VerifiedChains[0][0])
+	}
+}
+
+// WatchAndServeWS watches the URL and returns a handler that serves the events to clients using WatchWebsocket.
+// Clients that connect or reconnect first receive the current state of every source, which is initialized by
+// dispatching the watched URL before the handler is returned. Removed sources are not replayed.
+func WatchAndServeWS(ctx context.Context, u *url.URL, writer herodot.Writer, opts ...WebsocketServerOption) (http.HandlerFunc, error) {
+	o := new(websocketServerOptions)
+	for _, f := range opts {
+		f(o)
+	}
+
 	c := make(EventChannel)
 	watcher, err := Watch(ctx, u, c)
 	if err != nil {
@@ -39,8 +97,22 @@ func WatchAndServeWS(ctx context.Context, u *url.URL, writer herodot.Writer) (ht
 	}
 	w := &websocketWatcher{
 		wsClientChannels: eventChannelSlice{},
+		o:                o,
+		state:            map[string]Event{},
 	}
 	go w.broadcaster(ctx, c)
+
+	// The broadcaster records the dispatched events as the initial state.
+	done, err := watcher.DispatchNow()
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, errors.WithStack(ctx.Err())
+	case <-done:
+	}
+
 	return w.serveWS(ctx, writer, watcher), nil
 }
 
@@ -54,11 +126,57 @@ func (ww *websocketWatcher) broadcaster(ctx context.Context, c EventChannel) {
 			for _, cc := range ww.wsClientChannels.cs {
 				cc <- e
 			}
+			ww.remember(e)
 			ww.wsClientChannels.Unlock()
 		}
 	}
 }
 
+// remember stores the event as the last known state of its source, or forgets the source if it was removed. The
+// caller must hold the wsClientChannels lock.
+func (ww *websocketWatcher) remember(e Event) {
+	switch e.(type) {
+	case *ChangeEvent:
+	case *RemoveEvent:
+		if _, ok := ww.state[e.Source()]; !ok {
+			return
+		}
+		delete(ww.state, e.Source())
+		for i, src := range ww.stateOrder {
+			if src == e.Source() {
+				ww.stateOrder = append(ww.stateOrder[:i], ww.stateOrder[i+1:]...)
+				break
+			}
+		}
+		return
+	default:
+		return
+	}
+
+	if _, ok := ww.state[e.Source()]; !ok {
+		ww.stateOrder = append(ww.stateOrder, e.Source())
+	}
+	ww.state[e.Source()] = e
+}
+
+// snapshot returns the last known state. The caller must hold the wsClientChannels lock.
+func (ww *websocketWatcher) snapshot() []Event {
+	events := make([]Event, len(ww.stateOrder))
+	for i, src := range ww.stateOrder {
+		events[i] = ww.state[src]
+	}
+	return events
+}
+
+func (ww *websocketWatcher) authenticate(r *http.Request) error {
+	for _, a := range ww.o.authenticators {
+		if err := a(r); err != nil {
+			return errors.WithStack(herodot.ErrUnauthorized.WithReason("The request could not be authenticated.").WithDebug(err.Error()))
+		}
+	}
+	return nil
+}
+
 func (ww *websocketWatcher) readWebsocket(ws *websocket.Conn, c chan<- struct{}, watcher Watcher) {
 	for {
 		// blocking call to ReadMessage that waits for a close message
@@ -110,6 +228,11 @@ func (ww *websocketWatcher) readWebsocket(ws *websocket.Conn, c chan<- struct{},
 
 func (ww *websocketWatcher) serveWS(ctx context.Context, writer herodot.Writer, watcher Watcher) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if err := ww.authenticate(r); err != nil {
+			writer.WriteError(w, r, err)
+			return
+		}
+
 		ws, err := (&websocket.Upgrader{
 			ReadBufferSize:  256, // the only message we expect is the close message
 			WriteBufferSize: 1024,
@@ -122,6 +245,7 @@ func (ww *websocketWatcher) serveWS(ctx context.Context, writer herodot.Writer,
 		// make channel and register it at broadcaster
 		c := make(EventChannel)
 		ww.wsClientChannels.Lock()
+		replay := ww.snapshot()
 		ww.wsClientChannels.cs = append(ww.wsClientChannels.cs, c)
 		ww.wsClientChannels.Unlock()
 
@@ -149,6 +273,17 @@ func (ww *websocketWatcher) serveWS(ctx context.Context, writer herodot.Writer,
 			close(c)
 		}()
 
+		// replay the last known state, the broadcaster waits for us until we read from c
+		for _, e := range replay {
+			ww.wsWriteLock.Lock()
+			err := ws.WriteJSON(e)
+			ww.wsWriteLock.Unlock()
+
+			if err != nil {
+				return
+			}
+		}
+
 		for {
 			select {
 			case <-ctx.Done():
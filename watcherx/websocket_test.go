@@ -2,15 +2,28 @@ package watcherx
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/gorilla/websocket"
+
 	"github.com/ory/x/logrusx"
 
 	"github.com/sirupsen/logrus/hooks/test"
@@ -44,6 +57,9 @@ func TestWatchWebsocket(t *testing.T) {
 		_, err = WatchWebsocket(ctx, u, c)
 		require.NoError(t, err)
 
+		// the current state is replayed on connect
+		assertChange(t, <-c, "", u.String()+fn)
+
 		_, err = fmt.Fprint(f, "content here")
 		require.NoError(t, err)
 		require.NoError(t, f.Close())
@@ -205,6 +221,10 @@ func TestWatchWebsocket(t *testing.T) {
 		u := urlx.ParseOrPanic("ws" + strings.TrimLeft(s.URL, "http"))
 		d, err := WatchWebsocket(ctxClient, u, c)
 		require.NoError(t, err)
+
+		// the current state is replayed on connect
+		assertChange(t, <-c, initialContent, u.String()+fn)
+
 		done, err := d.DispatchNow()
 		require.NoError(t, err)
 
@@ -221,4 +241,313 @@ func TestWatchWebsocket(t *testing.T) {
 
 		assert.Len(t, hook.Entries, 0, "%+v", hook.Entries)
 	})
+
+	t.Run("case=replays last known state to new clients", func(t *testing.T) {
+		ctxServer, c1, dir, cancel := setup(t)
+		defer cancel()
+
+		fn := filepath.Join(dir, "some.file")
+
+		handler, err := WatchAndServeWS(ctxServer, urlx.ParseOrPanic("file://"+fn), herodot.NewJSONWriter(logrusx.New("", "")))
+		require.NoError(t, err)
+		s := httptest.NewServer(handler)
+		t.Cleanup(s.Close)
+
+		u := urlx.ParseOrPanic("ws" + strings.TrimLeft(s.URL, "http"))
+		_, err = WatchWebsocket(ctxServer, u, c1)
+		require.NoError(t, err)
+
+		touch(t, fn)
+		assertChange(t, <-c1, "", u.String()+fn)
+
+		c2 := make(EventChannel)
+		_, err = WatchWebsocket(ctxServer, u, c2)
+		require.NoError(t, err)
+		assertChange(t, <-c2, "", u.String()+fn)
+	})
+
+	t.Run("case=replays the initial state and forgets removed sources", func(t *testing.T) {
+		ctx, c1, dir, cancel := setup(t)
+		defer cancel()
+
+		fn := filepath.Join(dir, "some.file")
+		require.NoError(t, ioutil.WriteFile(fn, []byte("initial"), 0600))
+
+		handler, err := WatchAndServeWS(ctx, urlx.ParseOrPanic("file://"+fn), herodot.NewJSONWriter(logrusx.New("", "")))
+		require.NoError(t, err)
+		s := httptest.NewServer(handler)
+		t.Cleanup(s.Close)
+
+		u := urlx.ParseOrPanic("ws" + strings.TrimLeft(s.URL, "http"))
+		_, err = WatchWebsocket(ctx, u, c1)
+		require.NoError(t, err)
+		assertChange(t, <-c1, "initial", u.String()+fn)
+
+		require.NoError(t, os.Remove(fn))
+		assertRemove(t, <-c1, u.String()+fn)
+
+		c2 := make(EventChannel)
+		_, err = WatchWebsocket(ctx, u, c2)
+		require.NoError(t, err)
+		select {
+		case e := <-c2:
+			t.Fatalf("unexpected replay of %s", e)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("case=reconnects after the connection broke", func(t *testing.T) {
+		ctx, c, dir, cancel := setup(t)
+		defer cancel()
+
+		fn := filepath.Join(dir, "some.file")
+
+		handler, err := WatchAndServeWS(ctx, urlx.ParseOrPanic("file://"+fn), herodot.NewJSONWriter(logrusx.New("", "")))
+		require.NoError(t, err)
+
+		s := httptest.NewUnstartedServer(handler)
+		l := &trackingListener{Listener: s.Listener}
+		s.Listener = l
+		s.Start()
+		t.Cleanup(s.Close)
+
+		u := urlx.ParseOrPanic("ws" + strings.TrimLeft(s.URL, "http"))
+		_, err = WatchWebsocket(ctx, u, c, WebsocketClientWithReconnect(), WebsocketClientWithReconnectBackoff(time.Millisecond, 10*time.Millisecond))
+		require.NoError(t, err)
+
+		touch(t, fn)
+		assertChange(t, <-c, "", u.String()+fn)
+
+		l.closeAll()
+
+		e := <-c
+		require.IsType(t, &ErrorEvent{}, e)
+
+		// the server replays the state after reconnecting
+		assertChange(t, <-c, "", u.String()+fn)
+
+		require.NoError(t, os.Remove(fn))
+		assertRemove(t, <-c, u.String()+fn)
+	})
+
+	t.Run("case=answers dispatch requests while reconnecting", func(t *testing.T) {
+		ctx, c, dir, cancel := setup(t)
+		defer cancel()
+
+		handler, err := WatchAndServeWS(ctx, urlx.ParseOrPanic("file://"+filepath.Join(dir, "some.file")), herodot.NewJSONWriter(logrusx.New("", "")))
+		require.NoError(t, err)
+
+		s := httptest.NewUnstartedServer(handler)
+		l := &trackingListener{Listener: s.Listener}
+		s.Listener = l
+		s.Start()
+		t.Cleanup(s.Close)
+
+		u := urlx.ParseOrPanic("ws" + strings.TrimLeft(s.URL, "http"))
+		d, err := WatchWebsocket(ctx, u, c, WebsocketClientWithReconnect(), WebsocketClientWithReconnectBackoff(time.Hour, time.Hour))
+		require.NoError(t, err)
+
+		l.closeAll()
+		require.IsType(t, &ErrorEvent{}, <-c)
+
+		dispatched := make(chan int)
+		go func() {
+			done, err := d.DispatchNow()
+			require.NoError(t, err)
+			dispatched <- <-done
+		}()
+
+		select {
+		case n := <-dispatched:
+			assert.Equal(t, 0, n)
+		case <-time.After(time.Second):
+			t.Fatal("DispatchNow blocked while the client was reconnecting")
+		}
+	})
+
+	t.Run("case=answers dispatch requests if the connection breaks before the server answered", func(t *testing.T) {
+		ctx, c, _, cancel := setup(t)
+		defer cancel()
+
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ws, err := new(websocket.Upgrader).Upgrade(w, r, nil)
+			require.NoError(t, err)
+			_, msg, err := ws.ReadMessage()
+			require.NoError(t, err)
+			assert.Equal(t, messageSendNow, string(msg))
+			_ = ws.Close()
+		}))
+		t.Cleanup(s.Close)
+
+		u := urlx.ParseOrPanic("ws" + strings.TrimLeft(s.URL, "http"))
+		d, err := WatchWebsocket(ctx, u, c)
+		require.NoError(t, err)
+
+		dispatched := make(chan int)
+		go func() {
+			done, err := d.DispatchNow()
+			require.NoError(t, err)
+			dispatched <- <-done
+		}()
+
+		select {
+		case n := <-dispatched:
+			assert.Equal(t, 0, n)
+		case <-time.After(time.Second):
+			t.Fatal("DispatchNow blocked after the connection broke")
+		}
+		require.IsType(t, &ErrorEvent{}, <-c)
+	})
+
+	t.Run("case=quits after the connection broke by default", func(t *testing.T) {
+		ctx, c, dir, cancel := setup(t)
+		defer cancel()
+
+		handler, err := WatchAndServeWS(ctx, urlx.ParseOrPanic("file://"+filepath.Join(dir, "some.file")), herodot.NewJSONWriter(logrusx.New("", "")))
+		require.NoError(t, err)
+
+		s := httptest.NewUnstartedServer(handler)
+		l := &trackingListener{Listener: s.Listener}
+		s.Listener = l
+		s.Start()
+		t.Cleanup(s.Close)
+
+		u := urlx.ParseOrPanic("ws" + strings.TrimLeft(s.URL, "http"))
+		_, err = WatchWebsocket(ctx, u, c)
+		require.NoError(t, err)
+
+		l.closeAll()
+
+		e := <-c
+		require.IsType(t, &ErrorEvent{}, e)
+		_, ok := <-c
+		assert.False(t, ok)
+	})
+
+	t.Run("case=authenticates bearer tokens", func(t *testing.T) {
+		ctx, c, dir, cancel := setup(t)
+		defer cancel()
+
+		fn := filepath.Join(dir, "some.file")
+		handler, err := WatchAndServeWS(ctx, urlx.ParseOrPanic("file://"+fn), herodot.NewJSONWriter(logrusx.New("", "")),
+			WebsocketServerWithAuthenticator(BearerTokenAuthenticator(func(_ *http.Request, token string) error {
+				if token != "secret" {
+					return errors.New("invalid token")
+				}
+				return nil
+			})))
+		require.NoError(t, err)
+		s := httptest.NewServer(handler)
+		t.Cleanup(s.Close)
+
+		u := urlx.ParseOrPanic("ws" + strings.TrimLeft(s.URL, "http"))
+		_, err = WatchWebsocket(ctx, u, make(EventChannel))
+		require.Error(t, err)
+
+		_, err = WatchWebsocket(ctx, u, make(EventChannel), WebsocketClientWithBearerToken("wrong"))
+		require.Error(t, err)
+
+		_, err = WatchWebsocket(ctx, u, c, WebsocketClientWithBearerToken("secret"))
+		require.NoError(t, err)
+
+		touch(t, fn)
+		assertChange(t, <-c, "", u.String()+fn)
+	})
+
+	t.Run("case=authenticates client certificates over wss", func(t *testing.T) {
+		ctx, c, dir, cancel := setup(t)
+		defer cancel()
+
+		clientCert, clientPool := newClientCertificate(t, "trusted-client")
+
+		fn := filepath.Join(dir, "some.file")
+		handler, err := WatchAndServeWS(ctx, urlx.ParseOrPanic("file://"+fn), herodot.NewJSONWriter(logrusx.New("", "")),
+			WebsocketServerWithAuthenticator(ClientCertificateAuthenticator(func(cert *x509.Certificate) error {
+				if cert.Subject.CommonName != "trusted-client" {
+					return errors.New("unknown client")
+				}
+				return nil
+			})))
+		require.NoError(t, err)
+
+		s := httptest.NewUnstartedServer(handler)
+		s.TLS = &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven, ClientCAs: clientPool}
+		s.StartTLS()
+		t.Cleanup(s.Close)
+
+		u := urlx.ParseOrPanic("wss" + strings.TrimLeft(s.URL, "https"))
+		rootCAs := s.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+		_, err = WatchWebsocket(ctx, u, make(EventChannel), WebsocketClientWithDialer(&websocket.Dialer{
+			TLSClientConfig: &tls.Config{RootCAs: rootCAs},
+		}))
+		require.Error(t, err)
+
+		_, err = Watch(ctx, u, make(EventChannel))
+		require.Error(t, err, "the server certificate is not trusted by default")
+
+		_, err = WatchWebsocket(ctx, u, c, WebsocketClientWithDialer(&websocket.Dialer{
+			TLSClientConfig: &tls.Config{RootCAs: rootCAs, Certificates: []tls.Certificate{clientCert}},
+		}))
+		require.NoError(t, err)
+
+		touch(t, fn)
+		assertChange(t, <-c, "", u.String()+fn)
+	})
+}
+
+// trackingListener allows to break all connections, including hijacked ones.
+type trackingListener struct {
+	net.Listener
+	sync.Mutex
+	conns []net.Conn
+}
+
+func (l *trackingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.Lock()
+		l.conns = append(l.conns, conn)
+		l.Unlock()
+	}
+	return conn, err
+}
+
+func (l *trackingListener) closeAll() {
+	l.Lock()
+	defer l.Unlock()
+	for _, conn := range l.conns {
+		_ = conn.Close()
+	}
+	l.conns = nil
+}
+
+func touch(t *testing.T, fn string) {
+	f, err := os.Create(fn)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
+
+func newClientCertificate(t *testing.T, commonName string) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, pool
 }